@@ -0,0 +1,699 @@
+package sysstat
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/hnakamur/ascii"
+	"github.com/hnakamur/bytesconv"
+)
+
+// CgroupStat is a statistics about a cgroup.
+// Values of a controller which is not enabled for the cgroup are zero.
+type CgroupStat struct {
+	// CPUUsagePercent, CPUUserPercent and CPUSystemPercent are percentages
+	// of CPU time relative to one CPU, so they can exceed 100. They are
+	// relative to the number of CPUs determined by the mode instead for
+	// a reader created with WithCPUNormalization.
+	CPUUsagePercent  float64
+	CPUUserPercent   float64
+	CPUSystemPercent float64
+	// CPUPeriodsPerSec is enforcement periods elapsed per second.
+	CPUPeriodsPerSec float64
+	// CPUThrottledPeriodsPerSec is periods in which the cgroup is throttled
+	// per second.
+	CPUThrottledPeriodsPerSec float64
+	// CPUThrottledPercent is throttled periods over elapsed periods in percent.
+	CPUThrottledPercent float64
+	// CPUThrottledMicrosPerSec is the time in microseconds in which the
+	// cgroup is throttled per second.
+	CPUThrottledMicrosPerSec float64
+
+	// MemoryUsageBytes is the total memory usage of the cgroup and its
+	// descendants in bytes.
+	MemoryUsageBytes         uint64
+	MemoryAnonBytes          uint64
+	MemoryFileBytes          uint64
+	MemoryShmemBytes         uint64
+	MemoryFileDirtyBytes     uint64
+	MemoryFileWritebackBytes uint64
+	MemoryPageFaultsPerSec   float64
+	MemoryMajorFaultsPerSec  float64
+	// MemoryEvents is the cumulative numbers of memory events.
+	MemoryEvents CgroupMemoryEvents
+
+	// IO is the statistics for each device. It is reused by Read, so it
+	// does not allocate memory when the number of devices does not grow.
+	IO []CgroupIOStat
+
+	// The pressure statistics are zero when PSI is not available.
+	CPUPressure    PressureStat
+	MemoryPressure PressureStat
+	IOPressure     PressureStat
+}
+
+// CgroupMemoryEvents is the cumulative numbers of memory events of a cgroup
+// in memory.events.
+type CgroupMemoryEvents struct {
+	Low     uint64
+	High    uint64
+	Max     uint64
+	OOM     uint64
+	OOMKill uint64
+}
+
+// CgroupIOStat is an IO statistics of a cgroup for a device.
+type CgroupIOStat struct {
+	Major              uint32
+	Minor              uint32
+	ReadCountPerSec    float64
+	ReadBytesPerSec    float64
+	WrittenCountPerSec float64
+	WrittenBytesPerSec float64
+	DiscardCountPerSec float64
+	DiscardBytesPerSec float64
+}
+
+// rawCgroupStat represents values in files of a cgroup.
+// https://docs.kernel.org/admin-guide/cgroup-v2.html
+type rawCgroupStat struct {
+	// cpu.stat
+	UsageUsec     uint64
+	UserUsec      uint64
+	SystemUsec    uint64
+	NrPeriods     uint64
+	NrThrottled   uint64
+	ThrottledUsec uint64
+
+	// memory.current
+	MemoryCurrent uint64
+
+	// memory.stat
+	Anon          uint64
+	File          uint64
+	Shmem         uint64
+	FileDirty     uint64
+	FileWriteback uint64
+	PgFault       uint64
+	PgMajFault    uint64
+
+	MemoryEvents CgroupMemoryEvents
+
+	CPUPressure    PressureStat
+	MemoryPressure PressureStat
+	IOPressure     PressureStat
+}
+
+// rawCgroupIOStat represents values for a device in io.stat.
+type rawCgroupIOStat struct {
+	RBytes uint64
+	WBytes uint64
+	RIOs   uint64
+	WIOs   uint64
+	DBytes uint64
+	DIOs   uint64
+}
+
+type lastTwoRawCgroupIOStats struct {
+	major uint32
+	minor uint32
+	stats [2]rawCgroupIOStat
+	// seen is true if the device is found in the current read.
+	seen bool
+	// samples is the number of reads of the device, saturated at 2.
+	samples int
+}
+
+// CgroupStatReader reads statistics of a cgroup.
+// CgroupStatReader is not safe for concurrent accesses from multiple goroutines.
+type CgroupStatReader struct {
+	buf      []byte
+	curr     int
+	stats    [2]rawCgroupStat
+	io       []lastTwoRawCgroupIOStats
+	prevTime time.Time
+	// v1 is true if the cgroup is in cgroup v1 hierarchies.
+	v1 bool
+	// counter counts CPUs for normalizing CPU percentages. It is nil for
+	// CPUNormalizationNone.
+	counter *cpuCounter
+
+	cpuStatPath        []byte
+	memoryCurrentPath  []byte
+	memoryStatPath     []byte
+	memoryEventsPath   []byte
+	ioStatPath         []byte
+	cpuPressurePath    []byte
+	memoryPressurePath []byte
+	ioPressurePath     []byte
+
+	// The following paths are used only for cgroup v1.
+	cpuacctUsagePath []byte
+	cpuacctStatPath  []byte
+	ioServicedPath   []byte
+}
+
+// cgroupRoot is the directory where cgroup v2 is mounted relative to
+// the sysfs root.
+const cgroupRoot = "fs/cgroup"
+
+// NewCgroupStatReader creates a CgroupStatReader for the cgroup v2 at path
+// and does an initial read. path is the path of the cgroup relative to the
+// cgroup v2 mount point /sys/fs/cgroup, like ones in /proc/[pid]/cgroup,
+// for example, "/system.slice/sshd.service".
+func NewCgroupStatReader(path string, opts ...Option) (*CgroupStatReader, error) {
+	o := newOptions(opts)
+	r := &CgroupStatReader{
+		cpuStatPath:        o.sysPath(cgroupRoot, path, "cpu.stat"),
+		memoryCurrentPath:  o.sysPath(cgroupRoot, path, "memory.current"),
+		memoryStatPath:     o.sysPath(cgroupRoot, path, "memory.stat"),
+		memoryEventsPath:   o.sysPath(cgroupRoot, path, "memory.events"),
+		ioStatPath:         o.sysPath(cgroupRoot, path, "io.stat"),
+		cpuPressurePath:    o.sysPath(cgroupRoot, path, "cpu.pressure"),
+		memoryPressurePath: o.sysPath(cgroupRoot, path, "memory.pressure"),
+		ioPressurePath:     o.sysPath(cgroupRoot, path, "io.pressure"),
+		counter:            newCPUCounter(o, path, nil),
+	}
+	err := r.readCgroupStat(nil)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// CgroupMode is the mode of cgroup hierarchies which a process belongs to.
+type CgroupMode int
+
+const (
+	// CgroupModeV1 is the mode where the process belongs to cgroup v1
+	// hierarchies only.
+	CgroupModeV1 CgroupMode = iota + 1
+	// CgroupModeHybrid is the mode where the process belongs to both of
+	// cgroup v1 hierarchies and the cgroup v2 hierarchy, and controllers
+	// are in cgroup v1 hierarchies.
+	CgroupModeHybrid
+	// CgroupModeV2 is the mode where the process belongs to the cgroup v2
+	// hierarchy only.
+	CgroupModeV2
+)
+
+// String returns the name of the mode.
+func (m CgroupMode) String() string {
+	switch m {
+	case CgroupModeV1:
+		return "v1"
+	case CgroupModeHybrid:
+		return "hybrid"
+	case CgroupModeV2:
+		return "v2"
+	default:
+		return "unknown"
+	}
+}
+
+// selfCgroup is the cgroups which the current process belongs to.
+type selfCgroup struct {
+	mode    CgroupMode
+	v2Path  string
+	v1Paths cgroupV1Paths
+}
+
+// DetectCgroupMode detects the mode of cgroup hierarchies which the current
+// process belongs to from /proc/self/cgroup.
+func DetectCgroupMode(opts ...Option) (CgroupMode, error) {
+	c, err := readSelfCgroup(newOptions(opts))
+	if err != nil {
+		return 0, err
+	}
+	return c.mode, nil
+}
+
+// NewSelfCgroupStatReader creates a CgroupStatReader for the cgroup which
+// the current process belongs to, that is, the container when the process
+// runs in a container. The cgroup version is detected with DetectCgroupMode,
+// and cgroup v1 hierarchies are used in CgroupModeHybrid.
+func NewSelfCgroupStatReader(opts ...Option) (*CgroupStatReader, error) {
+	o := newOptions(opts)
+	c, err := readSelfCgroup(o)
+	if err != nil {
+		return nil, err
+	}
+	if c.mode == CgroupModeV2 {
+		return NewCgroupStatReader(c.v2Path, opts...)
+	}
+	return newCgroupV1StatReader(&c.v1Paths, o)
+}
+
+func readSelfCgroup(o *options) (*selfCgroup, error) {
+	var buf []byte
+	b, err := readFile(o.procPath("self", "cgroup"), &buf)
+	if err != nil {
+		return nil, err
+	}
+	return parseSelfCgroup(b)
+}
+
+// parseSelfCgroup parses /proc/self/cgroup, whose lines are
+// hierarchy-ID:controller-list:cgroup-path like below.
+//
+//	4:memory:/docker/0123456789ab
+//	2:cpu,cpuacct:/docker/0123456789ab
+//	0::/system.slice/docker.service
+func parseSelfCgroup(buf []byte) (*selfCgroup, error) {
+	c := &selfCgroup{}
+	var hasV1, hasV2 bool
+	for len(buf) > 0 {
+		line := ascii.GetLine(buf)
+		buf = buf[len(line):]
+		line = bytes.TrimRight(line, "\n")
+		i := bytes.IndexByte(line, ':')
+		if i == -1 {
+			continue
+		}
+		j := bytes.IndexByte(line[i+1:], ':')
+		if j == -1 {
+			return nil, ErrUnexpectedFormat
+		}
+		j += i + 1
+		id, controllers, path := line[:i], line[i+1:j], line[j+1:]
+		if string(id) == "0" && len(controllers) == 0 {
+			hasV2 = true
+			c.v2Path = string(path)
+			continue
+		}
+		hasV1 = true
+		for len(controllers) > 0 {
+			k := bytes.IndexByte(controllers, ',')
+			var name []byte
+			if k == -1 {
+				name, controllers = controllers, nil
+			} else {
+				name, controllers = controllers[:k], controllers[k+1:]
+			}
+			switch string(name) {
+			case "cpu":
+				c.v1Paths.cpu = string(path)
+			case "cpuacct":
+				c.v1Paths.cpuacct = string(path)
+			case "memory":
+				c.v1Paths.memory = string(path)
+			case "blkio":
+				c.v1Paths.blkio = string(path)
+			case "cpuset":
+				c.v1Paths.cpuset = string(path)
+			}
+		}
+	}
+	switch {
+	case hasV1 && hasV2:
+		c.mode = CgroupModeHybrid
+	case hasV1:
+		c.mode = CgroupModeV1
+	case hasV2:
+		c.mode = CgroupModeV2
+	default:
+		return nil, ErrUnexpectedFormat
+	}
+	return c, nil
+}
+
+// Read reads statistics of the cgroup.
+// Statistics of a device in s.IO are available from the second read after
+// the device appears.
+func (r *CgroupStatReader) Read(s *CgroupStat) error {
+	return r.readCgroupStat(s)
+}
+
+func (r *CgroupStatReader) readCgroupStat(s *CgroupStat) error {
+	var err error
+	if r.v1 {
+		err = r.readV1Files(&r.stats[r.curr])
+	} else {
+		err = r.readFiles(&r.stats[r.curr])
+	}
+	if err != nil {
+		return err
+	}
+	numCPU := 1.0
+	if r.counter != nil {
+		numCPU, err = r.counter.count()
+		if err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	if s != nil {
+		intervalSeconds := float64(now.Sub(r.prevTime)) / float64(time.Second)
+		calcCgroupStat(s, &r.stats[r.curr], &r.stats[1-r.curr], intervalSeconds, numCPU)
+		s.IO = r.appendCgroupIOStats(s.IO[:0], intervalSeconds)
+	}
+	r.prevTime = now
+	r.switchCurr()
+	return nil
+}
+
+func (r *CgroupStatReader) switchCurr() {
+	r.curr = 1 - r.curr
+}
+
+func (r *CgroupStatReader) readFiles(s *rawCgroupStat) error {
+	*s = rawCgroupStat{}
+
+	// cpu.stat exists for every cgroup, so an error is returned for it.
+	b, err := readFile(r.cpuStatPath, &r.buf)
+	if err != nil {
+		return err
+	}
+	err = parseKeyValueLines(b, s.cpuStatField)
+	if err != nil {
+		return err
+	}
+
+	// Files of the memory controller does not exist if the controller is
+	// not enabled for the cgroup, and memory.current does not exist for
+	// the root cgroup.
+	b, err = readOptionalFile(r.memoryCurrentPath, &r.buf)
+	if err != nil {
+		return err
+	}
+	if b != nil {
+		s.MemoryCurrent, err = readUint64Field(&b)
+		if err != nil {
+			return err
+		}
+	}
+	b, err = readOptionalFile(r.memoryStatPath, &r.buf)
+	if err != nil {
+		return err
+	}
+	err = parseKeyValueLines(b, s.memoryStatField)
+	if err != nil {
+		return err
+	}
+	b, err = readOptionalFile(r.memoryEventsPath, &r.buf)
+	if err != nil {
+		return err
+	}
+	err = parseKeyValueLines(b, s.MemoryEvents.field)
+	if err != nil {
+		return err
+	}
+
+	r.beginIODevices()
+	b, err = readOptionalFile(r.ioStatPath, &r.buf)
+	if err != nil {
+		return err
+	}
+	err = r.parseIOStat(b)
+	if err != nil {
+		return err
+	}
+	r.removeUnseenIODevices()
+
+	err = readOptionalPressure(r.cpuPressurePath, &r.buf, &s.CPUPressure)
+	if err != nil {
+		return err
+	}
+	err = readOptionalPressure(r.memoryPressurePath, &r.buf, &s.MemoryPressure)
+	if err != nil {
+		return err
+	}
+	return readOptionalPressure(r.ioPressurePath, &r.buf, &s.IOPressure)
+}
+
+func readOptionalPressure(path []byte, buf *[]byte, p *PressureStat) error {
+	err := readPressure(path, buf, p)
+	if err == ErrPSIUnavailable {
+		return nil
+	}
+	return err
+}
+
+// parseKeyValueLines parses lines of a key and a value separated by
+// a space, which is the flat keyed format of cgroup files.
+// field returns the pointer to the value for the key, or nil for keys
+// not interested in.
+func parseKeyValueLines(buf []byte, field func(key []byte) *uint64) error {
+	for len(buf) > 0 {
+		line := ascii.GetLine(buf)
+		buf = buf[len(line):]
+		start, end := ascii.NextField(line)
+		ptr := field(line[start:end])
+		if ptr == nil {
+			continue
+		}
+		rest := line[end:]
+		val, err := readUint64Field(&rest)
+		if err != nil {
+			return err
+		}
+		*ptr = val
+	}
+	return nil
+}
+
+func (s *rawCgroupStat) cpuStatField(key []byte) *uint64 {
+	switch string(key) {
+	case "usage_usec":
+		return &s.UsageUsec
+	case "user_usec":
+		return &s.UserUsec
+	case "system_usec":
+		return &s.SystemUsec
+	case "nr_periods":
+		return &s.NrPeriods
+	case "nr_throttled":
+		return &s.NrThrottled
+	case "throttled_usec":
+		return &s.ThrottledUsec
+	default:
+		return nil
+	}
+}
+
+func (s *rawCgroupStat) memoryStatField(key []byte) *uint64 {
+	switch string(key) {
+	case "anon":
+		return &s.Anon
+	case "file":
+		return &s.File
+	case "shmem":
+		return &s.Shmem
+	case "file_dirty":
+		return &s.FileDirty
+	case "file_writeback":
+		return &s.FileWriteback
+	case "pgfault":
+		return &s.PgFault
+	case "pgmajfault":
+		return &s.PgMajFault
+	default:
+		return nil
+	}
+}
+
+func (e *CgroupMemoryEvents) field(key []byte) *uint64 {
+	switch string(key) {
+	case "low":
+		return &e.Low
+	case "high":
+		return &e.High
+	case "max":
+		return &e.Max
+	case "oom":
+		return &e.OOM
+	case "oom_kill":
+		return &e.OOMKill
+	default:
+		return nil
+	}
+}
+
+// parseIOStat parses io.stat.
+//
+//	8:0 rbytes=90430464 wbytes=299008000 rios=8950 wios=1252 dbytes=50331648 dios=3021
+func (r *CgroupStatReader) parseIOStat(buf []byte) error {
+	for len(buf) > 0 {
+		line := ascii.GetLine(buf)
+		buf = buf[len(line):]
+		start, end := ascii.NextField(line)
+		if start == end {
+			continue
+		}
+		major, minor, err := parseMajorMinor(line[start:end])
+		if err != nil {
+			return err
+		}
+		s := &r.ioDevice(major, minor).stats[r.curr]
+		line = line[end:]
+		for {
+			start, end = ascii.NextField(line)
+			if start == end {
+				break
+			}
+			err = s.parseKeyValue(line[start:end])
+			if err != nil {
+				return err
+			}
+			line = line[end:]
+		}
+	}
+	return nil
+}
+
+// parseMajorMinor parses a device number like "8:0".
+func parseMajorMinor(b []byte) (major, minor uint32, err error) {
+	i := bytes.IndexByte(b, ':')
+	if i == -1 {
+		return 0, 0, ErrUnexpectedFormat
+	}
+	v, err := bytesconv.ParseUint(b[:i], 10, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	major = uint32(v)
+	v, err = bytesconv.ParseUint(b[i+1:], 10, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	return major, uint32(v), nil
+}
+
+func (s *rawCgroupIOStat) parseKeyValue(field []byte) error {
+	i := bytes.IndexByte(field, '=')
+	if i == -1 {
+		return ErrUnexpectedFormat
+	}
+	var ptr *uint64
+	switch string(field[:i]) {
+	case "rbytes":
+		ptr = &s.RBytes
+	case "wbytes":
+		ptr = &s.WBytes
+	case "rios":
+		ptr = &s.RIOs
+	case "wios":
+		ptr = &s.WIOs
+	case "dbytes":
+		ptr = &s.DBytes
+	case "dios":
+		ptr = &s.DIOs
+	default:
+		return nil
+	}
+	val, err := bytesconv.ParseUint(field[i+1:], 10, 64)
+	if err != nil {
+		return err
+	}
+	*ptr = val
+	return nil
+}
+
+// beginIODevices marks all the tracked devices unseen before parsing
+// IO statistics files.
+func (r *CgroupStatReader) beginIODevices() {
+	for i := 0; i < len(r.io); i++ {
+		r.io[i].seen = false
+	}
+}
+
+// ioDevice returns the tracked device, which is added if not tracked yet.
+// The current sample of the device is cleared when the device is first
+// seen in the current read.
+func (r *CgroupStatReader) ioDevice(major, minor uint32) *lastTwoRawCgroupIOStats {
+	i := r.indexOfIODevice(major, minor)
+	if i == -1 {
+		r.io = append(r.io, lastTwoRawCgroupIOStats{major: major, minor: minor})
+		i = len(r.io) - 1
+	}
+	lastTwo := &r.io[i]
+	if !lastTwo.seen {
+		lastTwo.seen = true
+		lastTwo.stats[r.curr] = rawCgroupIOStat{}
+		if lastTwo.samples < 2 {
+			lastTwo.samples++
+		}
+	}
+	return lastTwo
+}
+
+func (r *CgroupStatReader) indexOfIODevice(major, minor uint32) int {
+	for i := 0; i < len(r.io); i++ {
+		if r.io[i].major == major && r.io[i].minor == minor {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *CgroupStatReader) removeUnseenIODevices() {
+	j := 0
+	for i := 0; i < len(r.io); i++ {
+		if r.io[i].seen {
+			r.io[j] = r.io[i]
+			j++
+		}
+	}
+	for i := j; i < len(r.io); i++ {
+		r.io[i] = lastTwoRawCgroupIOStats{}
+	}
+	r.io = r.io[:j]
+}
+
+func (r *CgroupStatReader) appendCgroupIOStats(stats []CgroupIOStat, intervalSeconds float64) []CgroupIOStat {
+	for i := 0; i < len(r.io); i++ {
+		lastTwo := &r.io[i]
+		if lastTwo.samples < 2 {
+			continue
+		}
+		c := &lastTwo.stats[r.curr]
+		p := &lastTwo.stats[1-r.curr]
+		stats = append(stats, CgroupIOStat{
+			Major:              lastTwo.major,
+			Minor:              lastTwo.minor,
+			ReadCountPerSec:    counterRate(p.RIOs, c.RIOs, intervalSeconds),
+			ReadBytesPerSec:    counterRate(p.RBytes, c.RBytes, intervalSeconds),
+			WrittenCountPerSec: counterRate(p.WIOs, c.WIOs, intervalSeconds),
+			WrittenBytesPerSec: counterRate(p.WBytes, c.WBytes, intervalSeconds),
+			DiscardCountPerSec: counterRate(p.DIOs, c.DIOs, intervalSeconds),
+			DiscardBytesPerSec: counterRate(p.DBytes, c.DBytes, intervalSeconds),
+		})
+	}
+	return stats
+}
+
+// calcCgroupStat calculates statistics of a cgroup. The CPU percentages are
+// divided by numCPU.
+func calcCgroupStat(s *CgroupStat, c, p *rawCgroupStat, intervalSeconds, numCPU float64) {
+	// Microseconds per second divided by 10^4 is percent.
+	const usecPerSecToPercent = 1e4
+	s.CPUUsagePercent = counterRate(p.UsageUsec, c.UsageUsec, intervalSeconds) / usecPerSecToPercent / numCPU
+	s.CPUUserPercent = counterRate(p.UserUsec, c.UserUsec, intervalSeconds) / usecPerSecToPercent / numCPU
+	s.CPUSystemPercent = counterRate(p.SystemUsec, c.SystemUsec, intervalSeconds) / usecPerSecToPercent / numCPU
+	s.CPUPeriodsPerSec = counterRate(p.NrPeriods, c.NrPeriods, intervalSeconds)
+	s.CPUThrottledPeriodsPerSec = counterRate(p.NrThrottled, c.NrThrottled, intervalSeconds)
+	if s.CPUPeriodsPerSec > 0 {
+		s.CPUThrottledPercent = s.CPUThrottledPeriodsPerSec / s.CPUPeriodsPerSec * 100
+	} else {
+		s.CPUThrottledPercent = 0
+	}
+	s.CPUThrottledMicrosPerSec = counterRate(p.ThrottledUsec, c.ThrottledUsec, intervalSeconds)
+
+	s.MemoryUsageBytes = c.MemoryCurrent
+	s.MemoryAnonBytes = c.Anon
+	s.MemoryFileBytes = c.File
+	s.MemoryShmemBytes = c.Shmem
+	s.MemoryFileDirtyBytes = c.FileDirty
+	s.MemoryFileWritebackBytes = c.FileWriteback
+	s.MemoryPageFaultsPerSec = counterRate(p.PgFault, c.PgFault, intervalSeconds)
+	s.MemoryMajorFaultsPerSec = counterRate(p.PgMajFault, c.PgMajFault, intervalSeconds)
+	s.MemoryEvents = c.MemoryEvents
+
+	s.CPUPressure = c.CPUPressure
+	calcPressureStat(&s.CPUPressure, &p.CPUPressure, intervalSeconds)
+	s.MemoryPressure = c.MemoryPressure
+	calcPressureStat(&s.MemoryPressure, &p.MemoryPressure, intervalSeconds)
+	s.IOPressure = c.IOPressure
+	calcPressureStat(&s.IOPressure, &p.IOPressure, intervalSeconds)
+}
@@ -0,0 +1,240 @@
+package sysstat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFiles(t testing.TB, dir string, files map[string]string) {
+	t.Helper()
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		err = os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCgroupStatReader(t *testing.T) {
+	sysRoot := t.TempDir()
+	dir := filepath.Join(sysRoot, "fs/cgroup/system.slice/app.service")
+	writeFiles(t, dir, map[string]string{
+		"cpu.stat": `usage_usec 1000000
+user_usec 600000
+system_usec 400000
+nr_periods 100
+nr_throttled 10
+throttled_usec 50000
+`,
+		"memory.current": "104857600\n",
+		"memory.stat": `anon 52428800
+file 41943040
+kernel_stack 163840
+shmem 4096
+file_dirty 8192
+file_writeback 0
+pgfault 1000
+pgmajfault 10
+`,
+		"memory.events": "low 0\nhigh 0\nmax 3\noom 1\noom_kill 1\n",
+		"io.stat":       "8:0 rbytes=1000 wbytes=2000 rios=10 wios=20 dbytes=0 dios=0\n",
+		"cpu.pressure":  "some avg10=0.00 avg60=0.00 avg300=0.00 total=1000\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=500\n",
+	})
+	r, err := NewCgroupStatReader("/system.slice/app.service", WithSysRoot(sysRoot))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFiles(t, dir, map[string]string{
+		"cpu.stat": `usage_usec 2000000
+user_usec 1200000
+system_usec 800000
+nr_periods 200
+nr_throttled 60
+throttled_usec 150000
+`,
+		"io.stat": "8:0 rbytes=3000 wbytes=2000 rios=30 wios=20 dbytes=0 dios=0\n" +
+			"8:16 rbytes=1000 wbytes=1000 rios=1 wios=1\n",
+		"cpu.pressure": "some avg10=0.50 avg60=0.00 avg300=0.00 total=3000\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=500\n",
+	})
+	var s CgroupStat
+	err = r.Read(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.CPUUsagePercent <= 0 || s.CPUUserPercent <= s.CPUSystemPercent {
+		t.Errorf("CPU percentages unmatch, got usage=%g, user=%g, system=%g", s.CPUUsagePercent, s.CPUUserPercent, s.CPUSystemPercent)
+	}
+	if s.CPUThrottledPercent != 50 {
+		t.Errorf("CPUThrottledPercent unmatch, got %g, want %g", s.CPUThrottledPercent, 50.0)
+	}
+	if s.MemoryUsageBytes != 104857600 || s.MemoryAnonBytes != 52428800 || s.MemoryFileDirtyBytes != 8192 {
+		t.Errorf("memory unmatch, got %+v", s)
+	}
+	if want := (CgroupMemoryEvents{Max: 3, OOM: 1, OOMKill: 1}); s.MemoryEvents != want {
+		t.Errorf("memory events unmatch, got %+v, want %+v", s.MemoryEvents, want)
+	}
+	if len(s.IO) != 1 || s.IO[0].Major != 8 || s.IO[0].Minor != 0 || s.IO[0].ReadBytesPerSec <= 0 || s.IO[0].WrittenBytesPerSec != 0 {
+		t.Errorf("IO unmatch, got %+v", s.IO)
+	}
+	if s.CPUPressure.Some.Avg10 != 0.5 || s.CPUPressure.Some.StallMicrosPerSec <= 0 {
+		t.Errorf("CPU pressure unmatch, got %+v", s.CPUPressure)
+	}
+	if s.IOPressure != (PressureStat{}) {
+		t.Errorf("IO pressure must be zero, got %+v", s.IOPressure)
+	}
+
+	err = r.Read(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.IO) != 2 {
+		t.Errorf("number of IO devices unmatch, got %d, want %d", len(s.IO), 2)
+	}
+}
+
+func TestNewCgroupStatReader_notFound(t *testing.T) {
+	_, err := NewCgroupStatReader("/no/such/cgroup", WithSysRoot(t.TempDir()))
+	if err == nil {
+		t.Error("got nil error for nonexistent cgroup")
+	}
+}
+
+func BenchmarkCgroupStatReader_Read(b *testing.B) {
+	sysRoot := b.TempDir()
+	writeFiles(b, filepath.Join(sysRoot, "fs/cgroup/app"), map[string]string{
+		"cpu.stat":       "usage_usec 1000000\nuser_usec 600000\nsystem_usec 400000\n",
+		"memory.current": "104857600\n",
+		"memory.stat":    "anon 52428800\nfile 41943040\npgfault 1000\npgmajfault 10\n",
+		"memory.events":  "low 0\nhigh 0\nmax 3\noom 1\noom_kill 1\n",
+		"io.stat":        "8:0 rbytes=1000 wbytes=2000 rios=10 wios=20 dbytes=0 dios=0\n",
+	})
+	r, err := NewCgroupStatReader("/app", WithSysRoot(sysRoot))
+	if err != nil {
+		b.Fatal(err)
+	}
+	var s CgroupStat
+	for i := 0; i < b.N; i++ {
+		err = r.Read(&s)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestParseSelfCgroup(t *testing.T) {
+	testCases := []struct {
+		input   string
+		mode    CgroupMode
+		v2Path  string
+		v1Paths cgroupV1Paths
+	}{
+		{
+			input:  "0::/system.slice/app.service\n",
+			mode:   CgroupModeV2,
+			v2Path: "/system.slice/app.service",
+		},
+		{
+			input: `12:memory:/docker/abc
+4:cpu,cpuacct:/docker/abc
+3:blkio:/docker/abc
+1:name=systemd:/docker/abc
+0::/system.slice/docker.service
+`,
+			mode:    CgroupModeHybrid,
+			v2Path:  "/system.slice/docker.service",
+			v1Paths: cgroupV1Paths{cpu: "/docker/abc", cpuacct: "/docker/abc", memory: "/docker/abc", blkio: "/docker/abc"},
+		},
+		{
+			input:   "4:memory:/a\n2:cpuacct:/b\n1:cpu:/c\n",
+			mode:    CgroupModeV1,
+			v1Paths: cgroupV1Paths{cpu: "/c", cpuacct: "/b", memory: "/a"},
+		},
+	}
+	for _, c := range testCases {
+		got, err := parseSelfCgroup([]byte(c.input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.mode != c.mode || got.v2Path != c.v2Path || got.v1Paths != c.v1Paths {
+			t.Errorf("cgroup unmatch for %q, got %+v", c.input, got)
+		}
+	}
+}
+
+func TestCgroupV1StatReader(t *testing.T) {
+	sysRoot := t.TempDir()
+	root := filepath.Join(sysRoot, "fs/cgroup")
+	writeFiles(t, filepath.Join(root, "cpuacct/docker/abc"), map[string]string{
+		"cpuacct.usage": "1000000000\n",
+		"cpuacct.stat":  "user 60\nsystem 40\n",
+	})
+	writeFiles(t, filepath.Join(root, "cpu/docker/abc"), map[string]string{
+		"cpu.stat": "nr_periods 100\nnr_throttled 10\nthrottled_time 50000000\n",
+	})
+	writeFiles(t, filepath.Join(root, "memory/docker/abc"), map[string]string{
+		"memory.usage_in_bytes": "104857600\n",
+		"memory.stat":           "cache 1\nrss 2\ntotal_cache 41943040\ntotal_rss 52428800\ntotal_pgfault 1000\n",
+		"memory.oom_control":    "oom_kill_disable 0\nunder_oom 0\noom_kill 2\n",
+	})
+	writeFiles(t, filepath.Join(root, "blkio/docker/abc"), map[string]string{
+		"blkio.throttle.io_service_bytes": "8:0 Read 1000\n8:0 Write 2000\n8:0 Sync 3000\n8:0 Async 0\n8:0 Total 3000\nTotal 3000\n",
+		"blkio.throttle.io_serviced":      "8:0 Read 10\n8:0 Write 20\n8:0 Sync 30\n8:0 Async 0\n8:0 Total 30\nTotal 30\n",
+	})
+	procRoot := t.TempDir()
+	writeFiles(t, filepath.Join(procRoot, "self"), map[string]string{
+		"cgroup": "4:memory:/docker/abc\n3:blkio:/docker/abc\n2:cpu,cpuacct:/docker/abc\n",
+	})
+
+	mode, err := DetectCgroupMode(WithProcRoot(procRoot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode != CgroupModeV1 {
+		t.Errorf("mode unmatch, got %s, want %s", mode, CgroupModeV1)
+	}
+	r, err := NewSelfCgroupStatReader(WithProcRoot(procRoot), WithSysRoot(sysRoot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.v1 {
+		t.Fatal("reader must be for cgroup v1")
+	}
+
+	writeFiles(t, filepath.Join(root, "cpuacct/docker/abc"), map[string]string{
+		"cpuacct.usage": "2000000000\n",
+		"cpuacct.stat":  "user 120\nsystem 80\n",
+	})
+	writeFiles(t, filepath.Join(root, "cpu/docker/abc"), map[string]string{
+		"cpu.stat": "nr_periods 200\nnr_throttled 60\nthrottled_time 150000000\n",
+	})
+	writeFiles(t, filepath.Join(root, "blkio/docker/abc"), map[string]string{
+		"blkio.throttle.io_service_bytes": "8:0 Read 3000\n8:0 Write 2000\n8:0 Sync 5000\n8:0 Async 0\n8:0 Total 5000\nTotal 5000\n",
+		"blkio.throttle.io_serviced":      "8:0 Read 30\n8:0 Write 20\n8:0 Sync 50\n8:0 Async 0\n8:0 Total 50\nTotal 50\n",
+	})
+	var s CgroupStat
+	err = r.Read(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.CPUUsagePercent <= 0 || s.CPUUserPercent <= s.CPUSystemPercent {
+		t.Errorf("CPU percentages unmatch, got usage=%g, user=%g, system=%g", s.CPUUsagePercent, s.CPUUserPercent, s.CPUSystemPercent)
+	}
+	if s.CPUThrottledPercent != 50 || s.CPUThrottledMicrosPerSec <= 0 {
+		t.Errorf("CPU throttling unmatch, got percent=%g, micros/s=%g", s.CPUThrottledPercent, s.CPUThrottledMicrosPerSec)
+	}
+	if s.MemoryUsageBytes != 104857600 || s.MemoryAnonBytes != 52428800 || s.MemoryFileBytes != 41943040 {
+		t.Errorf("memory unmatch, got %+v", s)
+	}
+	if s.MemoryEvents.OOMKill != 2 {
+		t.Errorf("OOMKill unmatch, got %d, want %d", s.MemoryEvents.OOMKill, 2)
+	}
+	if len(s.IO) != 1 || s.IO[0].ReadBytesPerSec <= 0 || s.IO[0].ReadCountPerSec <= 0 || s.IO[0].WrittenBytesPerSec != 0 {
+		t.Errorf("IO unmatch, got %+v", s.IO)
+	}
+}
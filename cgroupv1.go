@@ -0,0 +1,256 @@
+package sysstat
+
+import (
+	"time"
+
+	"github.com/hnakamur/ascii"
+)
+
+// cgroupV1Paths is the paths of a cgroup in cgroup v1 hierarchies relative
+// to the mount point of each controller.
+type cgroupV1Paths struct {
+	cpu     string
+	cpuacct string
+	memory  string
+	blkio   string
+	cpuset  string
+}
+
+// NewCgroupV1StatReader creates a CgroupStatReader for the cgroup v1 at path
+// and does an initial read. path is the path of the cgroup relative to
+// the mount point of each controller like /sys/fs/cgroup/cpuacct,
+// for example, "/docker/0123456789ab".
+//
+// The statistics are read from cpuacct.usage, cpuacct.stat, cpu.stat,
+// memory.usage_in_bytes, memory.stat, memory.oom_control,
+// blkio.throttle.io_service_bytes and blkio.throttle.io_serviced.
+// MemoryEvents other than OOMKill and the pressure statistics, which are
+// not available in cgroup v1, are zero.
+func NewCgroupV1StatReader(path string, opts ...Option) (*CgroupStatReader, error) {
+	paths := cgroupV1Paths{cpu: path, cpuacct: path, memory: path, blkio: path, cpuset: path}
+	return newCgroupV1StatReader(&paths, newOptions(opts))
+}
+
+func newCgroupV1StatReader(paths *cgroupV1Paths, o *options) (*CgroupStatReader, error) {
+	r := &CgroupStatReader{
+		v1:                true,
+		cpuacctUsagePath:  o.sysPath(cgroupRoot, "cpuacct", paths.cpuacct, "cpuacct.usage"),
+		cpuacctStatPath:   o.sysPath(cgroupRoot, "cpuacct", paths.cpuacct, "cpuacct.stat"),
+		cpuStatPath:       o.sysPath(cgroupRoot, "cpu", paths.cpu, "cpu.stat"),
+		memoryCurrentPath: o.sysPath(cgroupRoot, "memory", paths.memory, "memory.usage_in_bytes"),
+		memoryStatPath:    o.sysPath(cgroupRoot, "memory", paths.memory, "memory.stat"),
+		memoryEventsPath:  o.sysPath(cgroupRoot, "memory", paths.memory, "memory.oom_control"),
+		ioStatPath:        o.sysPath(cgroupRoot, "blkio", paths.blkio, "blkio.throttle.io_service_bytes"),
+		ioServicedPath:    o.sysPath(cgroupRoot, "blkio", paths.blkio, "blkio.throttle.io_serviced"),
+		counter:           newCPUCounter(o, "", paths),
+	}
+	err := r.readCgroupStat(nil)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// readV1Files reads files of a cgroup v1 and converts values to ones
+// in the same units as cgroup v2.
+func (r *CgroupStatReader) readV1Files(s *rawCgroupStat) error {
+	*s = rawCgroupStat{}
+
+	// cpuacct.usage exists for every cgroup, so an error is returned for it.
+	b, err := readFile(r.cpuacctUsagePath, &r.buf)
+	if err != nil {
+		return err
+	}
+	usageNsec, err := readUint64Field(&b)
+	if err != nil {
+		return err
+	}
+	s.UsageUsec = usageNsec / uint64(time.Microsecond)
+
+	b, err = readOptionalFile(r.cpuacctStatPath, &r.buf)
+	if err != nil {
+		return err
+	}
+	err = parseKeyValueLines(b, s.cpuacctStatField)
+	if err != nil {
+		return err
+	}
+	s.UserUsec = userHZToUsec(s.UserUsec)
+	s.SystemUsec = userHZToUsec(s.SystemUsec)
+
+	b, err = readOptionalFile(r.cpuStatPath, &r.buf)
+	if err != nil {
+		return err
+	}
+	err = parseKeyValueLines(b, s.cpuStatV1Field)
+	if err != nil {
+		return err
+	}
+	s.ThrottledUsec /= uint64(time.Microsecond)
+
+	b, err = readOptionalFile(r.memoryCurrentPath, &r.buf)
+	if err != nil {
+		return err
+	}
+	if b != nil {
+		s.MemoryCurrent, err = readUint64Field(&b)
+		if err != nil {
+			return err
+		}
+	}
+	b, err = readOptionalFile(r.memoryStatPath, &r.buf)
+	if err != nil {
+		return err
+	}
+	err = parseKeyValueLines(b, s.memoryStatV1Field)
+	if err != nil {
+		return err
+	}
+	b, err = readOptionalFile(r.memoryEventsPath, &r.buf)
+	if err != nil {
+		return err
+	}
+	err = parseKeyValueLines(b, s.oomControlField)
+	if err != nil {
+		return err
+	}
+
+	r.beginIODevices()
+	b, err = readOptionalFile(r.ioStatPath, &r.buf)
+	if err != nil {
+		return err
+	}
+	err = r.parseBlkioThrottle(b, false)
+	if err != nil {
+		return err
+	}
+	b, err = readOptionalFile(r.ioServicedPath, &r.buf)
+	if err != nil {
+		return err
+	}
+	err = r.parseBlkioThrottle(b, true)
+	if err != nil {
+		return err
+	}
+	r.removeUnseenIODevices()
+	return nil
+}
+
+// userHZToUsec converts a time in USER_HZ to microseconds.
+func userHZToUsec(v uint64) uint64 {
+	const usecPerUserHZ = 10000
+	return v * usecPerUserHZ
+}
+
+// cpuacctStatField stores values in USER_HZ into the fields for
+// microseconds, which are converted later.
+func (s *rawCgroupStat) cpuacctStatField(key []byte) *uint64 {
+	switch string(key) {
+	case "user":
+		return &s.UserUsec
+	case "system":
+		return &s.SystemUsec
+	default:
+		return nil
+	}
+}
+
+// cpuStatV1Field stores throttled_time in nanoseconds into ThrottledUsec,
+// which is converted later.
+func (s *rawCgroupStat) cpuStatV1Field(key []byte) *uint64 {
+	switch string(key) {
+	case "nr_periods":
+		return &s.NrPeriods
+	case "nr_throttled":
+		return &s.NrThrottled
+	case "throttled_time":
+		return &s.ThrottledUsec
+	default:
+		return nil
+	}
+}
+
+// memoryStatV1Field returns fields for the total_ values, which include
+// descendant cgroups like values in memory.stat of cgroup v2.
+func (s *rawCgroupStat) memoryStatV1Field(key []byte) *uint64 {
+	switch string(key) {
+	case "total_rss":
+		return &s.Anon
+	case "total_cache":
+		return &s.File
+	case "total_shmem":
+		return &s.Shmem
+	case "total_dirty":
+		return &s.FileDirty
+	case "total_writeback":
+		return &s.FileWriteback
+	case "total_pgfault":
+		return &s.PgFault
+	case "total_pgmajfault":
+		return &s.PgMajFault
+	default:
+		return nil
+	}
+}
+
+func (s *rawCgroupStat) oomControlField(key []byte) *uint64 {
+	if string(key) == "oom_kill" {
+		return &s.MemoryEvents.OOMKill
+	}
+	return nil
+}
+
+// parseBlkioThrottle parses blkio.throttle.io_service_bytes, or
+// blkio.throttle.io_serviced if serviced is true.
+//
+//	8:0 Read 90430464
+//	8:0 Write 299008000
+//	8:0 Sync 389438464
+//	8:0 Async 0
+//	8:0 Discard 0
+//	8:0 Total 389438464
+//	Total 389438464
+func (r *CgroupStatReader) parseBlkioThrottle(buf []byte, serviced bool) error {
+	for len(buf) > 0 {
+		line := ascii.GetLine(buf)
+		buf = buf[len(line):]
+		start, end := ascii.NextField(line)
+		dev := line[start:end]
+		if len(dev) == 0 || dev[0] < '0' || dev[0] > '9' {
+			continue
+		}
+		major, minor, err := parseMajorMinor(dev)
+		if err != nil {
+			return err
+		}
+		rest := line[end:]
+		start, end = ascii.NextField(rest)
+		s := &r.ioDevice(major, minor).stats[r.curr]
+		var ptr *uint64
+		switch string(rest[start:end]) {
+		case "Read":
+			ptr = &s.RBytes
+			if serviced {
+				ptr = &s.RIOs
+			}
+		case "Write":
+			ptr = &s.WBytes
+			if serviced {
+				ptr = &s.WIOs
+			}
+		case "Discard":
+			ptr = &s.DBytes
+			if serviced {
+				ptr = &s.DIOs
+			}
+		default:
+			continue
+		}
+		rest = rest[end:]
+		*ptr, err = readUint64Field(&rest)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,396 @@
+package sysstat
+
+import (
+	"bytes"
+	"syscall"
+	"time"
+
+	"github.com/hnakamur/ascii"
+	"github.com/hnakamur/bytesconv"
+)
+
+// CIFSShareStat is a statistics about a CIFS share, which is similar to
+// the one reported by cifsiostat.
+type CIFSShareStat struct {
+	// Share is the UNC name of the share like `\\server\share`.
+	Share string
+	// Disconnected is true if the connection to the share is lost and
+	// waiting for reconnection.
+	Disconnected bool
+	// OpenFiles is the number of files opened locally on the share.
+	OpenFiles uint64
+
+	// SMBsPerSec is the number of SMB requests sent per second.
+	SMBsPerSec float64
+	// ReadBytesPerSec and WriteBytesPerSec are the bytes read from and
+	// written to the server per second.
+	ReadBytesPerSec  float64
+	WriteBytesPerSec float64
+
+	// Ops is the statistics per command like Reads or Writes in the order
+	// of /proc/fs/cifs/Stats.
+	Ops []CIFSOpStat
+}
+
+// CIFSOpStat is a statistics about a command like Reads or Writes of
+// a CIFS share.
+type CIFSOpStat struct {
+	// Op is the name of the command like "Reads".
+	Op        string
+	OpsPerSec float64
+	// FailedPerSec is the number of failed commands per second.
+	FailedPerSec float64
+}
+
+// rawCIFSShareStat is the values of a share in /proc/fs/cifs/Stats.
+type rawCIFSShareStat struct {
+	SMBs         uint64
+	BytesRead    uint64
+	BytesWritten uint64
+	OpenFiles    uint64
+}
+
+// rawCIFSOpStat is the values of a command line of a share.
+type rawCIFSOpStat struct {
+	Total  uint64
+	Failed uint64
+}
+
+type cifsShare struct {
+	name         string
+	disconnected bool
+	stats        [2]rawCIFSShareStat
+	ops          []cifsOp
+	// seen is true if the share is found in the current read.
+	seen bool
+	// samples is the number of reads of the share, saturated at 2.
+	samples int
+}
+
+type cifsOp struct {
+	name  string
+	stats [2]rawCIFSOpStat
+	// samples is the number of reads of the command, saturated at 2.
+	samples int
+}
+
+// CIFSStatReader is used for reading statistics of CIFS shares from
+// /proc/fs/cifs/Stats. The statistics are kept per share, not per mount,
+// since the kernel shares the connection among mounts of the same share.
+// Only the format for SMB2 and SMB3 is supported, and the commands of
+// shares mounted with SMB1 are not reported.
+// CIFSStatReader is not safe for concurrent accesses from multiple goroutines.
+type CIFSStatReader struct {
+	buf      []byte
+	curr     int
+	shares   []cifsShare
+	prevTime time.Time
+	path     []byte
+}
+
+// NewCIFSStatReader creates a CIFSStatReader and does an initial read.
+func NewCIFSStatReader(opts ...Option) (*CIFSStatReader, error) {
+	o := newOptions(opts)
+	r := &CIFSStatReader{path: o.procPath("fs", "cifs", "Stats")}
+	err := r.readAndParse()
+	if err != nil {
+		return nil, err
+	}
+	r.prevTime = time.Now()
+	r.switchCurr()
+	return r, nil
+}
+
+// Read reads statistics of CIFS shares and appends them to stats[:0].
+// The capacity of stats and Ops of its elements are reused, so no memory
+// is allocated once they have grown enough. Shares which appeared after
+// the previous read are included from the next read since rates need
+// two samples. If the cifs module is not loaded, no shares are reported.
+func (r *CIFSStatReader) Read(stats []CIFSShareStat) ([]CIFSShareStat, error) {
+	err := r.readAndParse()
+	if err != nil {
+		return stats, err
+	}
+
+	now := time.Now()
+	intervalSeconds := float64(now.Sub(r.prevTime)) / float64(time.Second)
+	stats = stats[:0]
+	for i := 0; i < len(r.shares); i++ {
+		sh := &r.shares[i]
+		if sh.samples < 2 {
+			continue
+		}
+		if len(stats) < cap(stats) {
+			stats = stats[:len(stats)+1]
+		} else {
+			stats = append(stats, CIFSShareStat{})
+		}
+		r.fillCIFSShareStat(&stats[len(stats)-1], sh, intervalSeconds)
+	}
+	r.prevTime = now
+	r.switchCurr()
+	return stats, nil
+}
+
+func (r *CIFSStatReader) readAndParse() error {
+	buf, err := readFile(r.path, &r.buf)
+	if err == syscall.ENOENT {
+		// The cifs module is not loaded, so there are no shares.
+		buf, err = nil, nil
+	}
+	if err != nil {
+		return err
+	}
+	return r.parse(buf)
+}
+
+func (r *CIFSStatReader) switchCurr() {
+	r.curr = 1 - r.curr
+}
+
+func (r *CIFSStatReader) fillCIFSShareStat(s *CIFSShareStat, sh *cifsShare, intervalSeconds float64) {
+	c, p := &sh.stats[r.curr], &sh.stats[1-r.curr]
+	s.Share = sh.name
+	s.Disconnected = sh.disconnected
+	s.OpenFiles = c.OpenFiles
+	s.SMBsPerSec = counterRate(p.SMBs, c.SMBs, intervalSeconds)
+	s.ReadBytesPerSec = counterRate(p.BytesRead, c.BytesRead, intervalSeconds)
+	s.WriteBytesPerSec = counterRate(p.BytesWritten, c.BytesWritten, intervalSeconds)
+
+	s.Ops = s.Ops[:0]
+	for i := 0; i < len(sh.ops); i++ {
+		op := &sh.ops[i]
+		if op.samples < 2 {
+			continue
+		}
+		oc, opp := &op.stats[r.curr], &op.stats[1-r.curr]
+		s.Ops = append(s.Ops, CIFSOpStat{
+			Op:           op.name,
+			OpsPerSec:    counterRate(opp.Total, oc.Total, intervalSeconds),
+			FailedPerSec: counterRate(opp.Failed, oc.Failed, intervalSeconds),
+		})
+	}
+}
+
+// parse parses /proc/fs/cifs/Stats like below. The lines before the first
+// share are global statistics and ignored.
+//
+//	Resources in use
+//	CIFS Session: 1
+//	...
+//	Total vfs operations: 16 maximum at one time: 2
+//
+//	1) \\fileserver\share
+//	SMBs: 20
+//	Bytes read: 4096  Bytes written: 0
+//	Open files: 1 total (local), 1 open on server
+//	TreeConnects: 1 total 0 failed
+//	...
+//	Reads: 1 total 0 failed
+//	Writes: 0 total 0 failed
+//	...
+//	OplockBreaks: 0 sent 0 failed
+//	2) \\fileserver\home	DISCONNECTED
+//	...
+func (r *CIFSStatReader) parse(buf []byte) error {
+	for i := 0; i < len(r.shares); i++ {
+		r.shares[i].seen = false
+	}
+	var sh *cifsShare
+	shareHint, opHint := 0, 0
+	for len(buf) > 0 {
+		line := ascii.GetLine(buf)
+		buf = buf[len(line):]
+		start, end := ascii.NextField(line)
+		key := line[start:end]
+		rest := line[end:]
+		switch {
+		case isCIFSShareNumber(key):
+			i := r.parseShareLine(rest, shareHint)
+			sh = &r.shares[i]
+			shareHint = i + 1
+			opHint = 0
+		case sh == nil:
+		case bytes.Equal(key, []byte("SMBs:")):
+			start, end := ascii.NextField(rest)
+			v, err := bytesconv.ParseUint(rest[start:end], 10, 64)
+			if err != nil {
+				return err
+			}
+			sh.stats[r.curr].SMBs = v
+		case bytes.Equal(key, []byte("Bytes")):
+			err := parseCIFSBytes(rest, &sh.stats[r.curr])
+			if err != nil {
+				return err
+			}
+		case bytes.Equal(key, []byte("Open")):
+			// Open files: 1 total (local), 1 open on server
+			start, end := ascii.NthField(rest, 1)
+			v, err := bytesconv.ParseUint(rest[start:end], 10, 64)
+			if err != nil {
+				return err
+			}
+			sh.stats[r.curr].OpenFiles = v
+		case len(key) > 1 && key[len(key)-1] == ':':
+			var raw rawCIFSOpStat
+			if !parseCIFSOp(rest, &raw) {
+				// Lines of SMB1 shares have different formats.
+				continue
+			}
+			i := sh.opIndex(key[:len(key)-1], opHint)
+			if i == -1 {
+				sh.ops = append(sh.ops, cifsOp{name: string(key[:len(key)-1])})
+				i = len(sh.ops) - 1
+			}
+			opHint = i + 1
+			op := &sh.ops[i]
+			op.stats[r.curr] = raw
+			if op.samples < 2 {
+				op.samples++
+			}
+		}
+	}
+	for i := 0; i < len(r.shares); i++ {
+		sh := &r.shares[i]
+		if sh.seen && sh.samples < 2 {
+			sh.samples++
+		}
+	}
+	r.removeUnseen()
+	return nil
+}
+
+// isCIFSShareNumber returns true if key is the number of a share like "1)".
+func isCIFSShareNumber(key []byte) bool {
+	if len(key) < 2 || key[len(key)-1] != ')' {
+		return false
+	}
+	for _, c := range key[:len(key)-1] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseShareLine parses the rest of the first line of a share and returns
+// the index of the tracked share.
+func (r *CIFSStatReader) parseShareLine(line []byte, hint int) int {
+	name := bytes.TrimSpace(line)
+	disconnected := false
+	if n := bytes.TrimSuffix(name, []byte("DISCONNECTED")); len(n) < len(name) {
+		name = bytes.TrimSpace(n)
+		disconnected = true
+	}
+
+	i := r.indexOfShare(name, hint)
+	if i == -1 {
+		r.shares = append(r.shares, cifsShare{name: string(name)})
+		i = len(r.shares) - 1
+	}
+	sh := &r.shares[i]
+	sh.seen = true
+	sh.disconnected = disconnected
+	// Clear values in case some lines are missing.
+	sh.stats[r.curr] = rawCIFSShareStat{}
+	return i
+}
+
+// indexOfShare returns the index of the share in r.shares which is not
+// seen yet in the current read, or -1 if not found. The same share can be
+// listed more than once for sessions of different users, and they are
+// matched in order. Shares in r.shares are usually in the same order as
+// in Stats, so the search starts at hint.
+func (r *CIFSStatReader) indexOfShare(name []byte, hint int) int {
+	for i := hint; i < len(r.shares); i++ {
+		if !r.shares[i].seen && string(name) == r.shares[i].name {
+			return i
+		}
+	}
+	for i := 0; i < hint && i < len(r.shares); i++ {
+		if !r.shares[i].seen && string(name) == r.shares[i].name {
+			return i
+		}
+	}
+	return -1
+}
+
+// opIndex returns the index of the command in sh.ops, or -1 if not found.
+func (sh *cifsShare) opIndex(name []byte, hint int) int {
+	for i := hint; i < len(sh.ops); i++ {
+		if string(name) == sh.ops[i].name {
+			return i
+		}
+	}
+	for i := 0; i < hint && i < len(sh.ops); i++ {
+		if string(name) == sh.ops[i].name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *CIFSStatReader) removeUnseen() {
+	j := 0
+	for i := 0; i < len(r.shares); i++ {
+		if r.shares[i].seen {
+			r.shares[j] = r.shares[i]
+			j++
+		}
+	}
+	for i := j; i < len(r.shares); i++ {
+		r.shares[i] = cifsShare{}
+	}
+	r.shares = r.shares[:j]
+}
+
+// parseCIFSBytes parses the rest of a line like below after "Bytes".
+//
+//	Bytes read: 4096  Bytes written: 0
+func parseCIFSBytes(buf []byte, s *rawCIFSShareStat) error {
+	start, end := ascii.NthField(buf, 1)
+	v, err := bytesconv.ParseUint(buf[start:end], 10, 64)
+	if err != nil {
+		return err
+	}
+	s.BytesRead = v
+	buf = buf[end:]
+	start, end = ascii.NthField(buf, 2)
+	v, err = bytesconv.ParseUint(buf[start:end], 10, 64)
+	if err != nil {
+		return err
+	}
+	s.BytesWritten = v
+	return nil
+}
+
+// parseCIFSOp parses the rest of a command line like below after the name.
+// It returns false if the line is not in this format.
+//
+//	Reads: 1 total 0 failed
+//	OplockBreaks: 0 sent 0 failed
+func parseCIFSOp(buf []byte, s *rawCIFSOpStat) bool {
+	var fields [4][]byte
+	for i := range fields {
+		start, end := ascii.NextField(buf)
+		if start == end {
+			return false
+		}
+		fields[i] = buf[start:end]
+		buf = buf[end:]
+	}
+	if !bytes.Equal(fields[3], []byte("failed")) {
+		return false
+	}
+	total, err := bytesconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return false
+	}
+	failed, err := bytesconv.ParseUint(fields[2], 10, 64)
+	if err != nil {
+		return false
+	}
+	s.Total = total
+	s.Failed = failed
+	return true
+}
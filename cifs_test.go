@@ -0,0 +1,140 @@
+package sysstat
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+const testCIFSStats1 = `Resources in use
+CIFS Session: 1
+Share (unique mount targets): 2
+SMB Request/Response Buffer: 1 Pool size: 5
+SMB Small Req/Resp Buffer: 1 Pool size: 30
+Operations (MIDs): 0
+
+0 session 0 share reconnects
+Total vfs operations: 16 maximum at one time: 2
+
+Max requests in flight: 2
+1) \\fileserver\share
+SMBs: 20
+Bytes read: 4096  Bytes written: 1000
+Open files: 1 total (local), 1 open on server
+TreeConnects: 1 total 0 failed
+TreeDisconnects: 0 total 0 failed
+Creates: 5 total 0 failed
+Closes: 4 total 0 failed
+Reads: 1 total 0 failed
+Writes: 1 total 0 failed
+OplockBreaks: 0 sent 0 failed
+`
+
+const testCIFSStats2 = `Resources in use
+CIFS Session: 1
+Share (unique mount targets): 3
+SMB Request/Response Buffer: 1 Pool size: 5
+SMB Small Req/Resp Buffer: 1 Pool size: 30
+Operations (MIDs): 0
+
+0 session 0 share reconnects
+Total vfs operations: 40 maximum at one time: 2
+
+Max requests in flight: 2
+1) \\fileserver\share
+SMBs: 32
+Bytes read: 12288  Bytes written: 1000
+Open files: 2 total (local), 2 open on server
+TreeConnects: 1 total 0 failed
+TreeDisconnects: 0 total 0 failed
+Creates: 7 total 1 failed
+Closes: 5 total 0 failed
+Reads: 3 total 0 failed
+Writes: 1 total 0 failed
+OplockBreaks: 0 sent 0 failed
+2) \\fileserver\home	DISCONNECTED 
+SMBs: 0
+Bytes read: 0  Bytes written: 0
+Open files: 0 total (local), 0 open on server
+Reads: 0 total 0 failed
+`
+
+func TestCIFSStatReader_Read(t *testing.T) {
+	procRoot := t.TempDir()
+	dir := filepath.Join(procRoot, "fs", "cifs")
+	writeFiles(t, dir, map[string]string{"Stats": testCIFSStats1})
+	r, err := NewCIFSStatReader(WithProcRoot(procRoot))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFiles(t, dir, map[string]string{"Stats": testCIFSStats2})
+	stats, err := r.Read(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The home share is included from the next read.
+	if len(stats) != 1 {
+		t.Fatalf("number of shares unmatch, got %d, want 1, stats=%+v", len(stats), stats)
+	}
+	s := &stats[0]
+	if s.Share != `\\fileserver\share` || s.Disconnected || s.OpenFiles != 2 {
+		t.Errorf("share unmatch, got %+v", s)
+	}
+	if s.SMBsPerSec <= 0 || s.ReadBytesPerSec <= 0 || s.WriteBytesPerSec != 0 {
+		t.Errorf("rates unmatch, got %+v", s)
+	}
+	wantOps := []string{"TreeConnects", "TreeDisconnects", "Creates", "Closes", "Reads", "Writes", "OplockBreaks"}
+	if len(s.Ops) != len(wantOps) {
+		t.Fatalf("ops unmatch, got %+v", s.Ops)
+	}
+	for i, op := range wantOps {
+		if s.Ops[i].Op != op {
+			t.Errorf("op unmatch, got %s, want %s", s.Ops[i].Op, op)
+		}
+	}
+	if creates := &s.Ops[2]; creates.OpsPerSec <= 0 || creates.FailedPerSec <= 0 {
+		t.Errorf("Creates unmatch, got %+v", creates)
+	}
+	if writes := &s.Ops[5]; writes.OpsPerSec != 0 || writes.FailedPerSec != 0 {
+		t.Errorf("Writes unmatch, got %+v", writes)
+	}
+
+	stats, err = r.Read(stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 || stats[1].Share != `\\fileserver\home` || !stats[1].Disconnected || len(stats[1].Ops) != 1 {
+		t.Errorf("stats unmatch after new share, got %+v", stats)
+	}
+}
+
+func TestCIFSStatReader_NotLoaded(t *testing.T) {
+	r, err := NewCIFSStatReader(WithProcRoot(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := r.Read(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 0 {
+		t.Errorf("no shares should be reported, got %+v", stats)
+	}
+}
+
+func BenchmarkCIFSStatReader_Read(b *testing.B) {
+	procRoot := b.TempDir()
+	writeFiles(b, filepath.Join(procRoot, "fs", "cifs"), map[string]string{"Stats": testCIFSStats2})
+	r, err := NewCIFSStatReader(WithProcRoot(procRoot))
+	if err != nil {
+		b.Fatal(err)
+	}
+	var stats []CIFSShareStat
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		stats, err = r.Read(stats)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
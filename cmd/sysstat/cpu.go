@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hnakamur/sysstat"
+)
+
+const cpuHeader = "%-8s  %-4s %7s %7s %7s %7s %7s %7s %7s %7s %7s %7s\n"
+const cpuRow = "%-8s  %-4s %7.2f %7.2f %7.2f %7.2f %7.2f %7.2f %7.2f %7.2f %7.2f %7.2f\n"
+
+func runCPU(args []string) error {
+	fs := newFlagSet("cpu")
+	perCPU := fs.String("P", "", "ALL to report each CPU in addition to all CPUs")
+	opts := procRootFlag(fs)
+	fs.Parse(args)
+	s, err := parseSampling(fs.Args())
+	if err != nil {
+		return err
+	}
+	if *perCPU != "" && *perCPU != "ALL" {
+		return fmt.Errorf("invalid -P value: %s", *perCPU)
+	}
+
+	r, err := sysstat.NewCPUStatReader(opts()...)
+	if err != nil {
+		return err
+	}
+	var pr *sysstat.PerCPUStatReader
+	var perCPUStats []sysstat.CPUStat
+	if *perCPU == "ALL" {
+		pr, err = sysstat.NewPerCPUStatReader(opts()...)
+		if err != nil {
+			return err
+		}
+		perCPUStats = make([]sysstat.CPUStat, pr.NumCPU())
+	}
+
+	var stat sysstat.CPUStat
+	return s.loop(func(now time.Time, seq int) error {
+		err := r.Read(&stat)
+		if err != nil {
+			return err
+		}
+		if pr != nil {
+			err = pr.Read(perCPUStats)
+			if err != nil {
+				return err
+			}
+		}
+
+		ts := timestamp(now)
+		if pr != nil || seq%headerInterval == 0 {
+			fmt.Printf(cpuHeader, ts, "CPU", "%usr", "%nice", "%sys", "%iowait",
+				"%irq", "%soft", "%steal", "%guest", "%gnice", "%idle")
+		}
+		printCPUStat(ts, "all", &stat)
+		for i := range perCPUStats {
+			printCPUStat(ts, fmt.Sprint(i), &perCPUStats[i])
+		}
+		if pr != nil {
+			fmt.Println()
+		}
+		return nil
+	})
+}
+
+func printCPUStat(ts, cpu string, s *sysstat.CPUStat) {
+	fmt.Printf(cpuRow, ts, cpu, s.UserPercent, s.NicePercent, s.SysPercent, s.IOWaitPercent,
+		s.IRQPercent, s.SoftIRQPercent, s.StealPercent, s.GuestPercent, s.GuestNicePercent, s.IdlePercent)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hnakamur/sysstat"
+)
+
+const diskHeader = "%-8s  %-12s %9s %10s %8s %8s %8s %9s %10s %8s %8s %8s %7s %7s\n"
+const diskRow = "%-8s  %-12s %9.2f %10.2f %8.2f %8.2f %8.2f %9.2f %10.2f %8.2f %8.2f %8.2f %7.2f %7.2f\n"
+
+func runDisk(args []string) error {
+	fs := newFlagSet("disk")
+	filter := deviceFilterFlags(fs, "loop*,ram*")
+	opts := procRootFlag(fs)
+	fs.Parse(args)
+	s, err := parseSampling(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	r, err := sysstat.NewDiskStatReaderWithFilter(filter(), opts()...)
+	if err != nil {
+		return err
+	}
+	var stats []sysstat.DiskStat
+	return s.loop(func(now time.Time, seq int) error {
+		stats, err = r.ReadAll(stats)
+		if err != nil {
+			return err
+		}
+
+		// Same columns as iostat -x.
+		ts := timestamp(now)
+		fmt.Printf(diskHeader, ts, "Device", "r/s", "rkB/s", "rrqm/s", "r_await", "rareq-sz",
+			"w/s", "wkB/s", "wrqm/s", "w_await", "wareq-sz", "aqu-sz", "%util")
+		for i := range stats {
+			d := &stats[i]
+			fmt.Printf(diskRow, ts, d.DevName,
+				d.ReadCountPerSec, d.ReadBytesPerSec/1024, d.ReadMergedPerSec, d.ReadAwaitMillis, d.ReadAvgRequestKB,
+				d.WrittenCountPerSec, d.WrittenBytesPerSec/1024, d.WrittenMergedPerSec, d.WrittenAwaitMillis, d.WrittenAvgRequestKB,
+				d.AvgQueueSize, d.UtilPercent)
+		}
+		fmt.Println()
+		return nil
+	})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hnakamur/sysstat"
+)
+
+const fsHeader = "%-8s  %-20s %12s %12s %8s %12s %12s %8s\n"
+const fsRow = "%-8s  %-20s %12d %12d %8.2f %12d %12d %8.2f\n"
+
+func runFileSystem(args []string) error {
+	fs := newFlagSet("fs")
+	mountPoints := fs.String("m", "/", "comma separated mount points")
+	all := fs.Bool("a", false, "discover mounted real filesystems instead of -m")
+	timeout := fs.Duration("timeout", 0, "timeout of statfs for each filesystem (0 for no timeout)")
+	procOpts := procRootFlag(fs)
+	fs.Parse(args)
+	s, err := parseSampling(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	opts := append(procOpts(), sysstat.WithStatfsTimeout(*timeout))
+	var r *sysstat.FileSystemStatReader
+	if *all {
+		r, err = sysstat.NewFileSystemStatReaderWithFilter(sysstat.DefaultMountFilter(), opts...)
+		if err != nil {
+			return err
+		}
+	} else {
+		r = sysstat.NewFileSystemStatReader(splitList(*mountPoints), opts...)
+	}
+	defer r.Close()
+	var stats []sysstat.FileSystemStat
+	return s.loop(func(now time.Time, seq int) error {
+		stats, err = r.ReadAll(stats)
+		if err == sysstat.ErrStatfsTimeout {
+			// Filesystems which timed out are printed with zero values.
+			fmt.Fprintf(os.Stderr, "sysstat fs: %s\n", err)
+		} else if err != nil {
+			return err
+		}
+
+		// Same columns as sar -F.
+		ts := timestamp(now)
+		fmt.Printf(fsHeader, ts, "FILESYSTEM", "MBfsfree", "MBfsused", "%fsused", "Ifree", "Iused", "%Iused")
+		for i := range stats {
+			f := &stats[i]
+			fmt.Printf(fsRow, ts, f.MountPoint,
+				f.FreeBlocks*f.BlockSize/1024/1024, f.UsedBytes/1024/1024, f.UsedPercent,
+				f.FreeINodes, f.TotalINodes-f.FreeINodes, f.INodesUsedPercent)
+		}
+		fmt.Println()
+		return nil
+	})
+}
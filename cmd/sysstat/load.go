@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hnakamur/sysstat"
+)
+
+const loadHeader = "%-8s  %9s %9s %9s %14s\n"
+const loadRow = "%-8s  %9.2f %9.2f %9.2f %14.2f\n"
+
+func runLoad(args []string) error {
+	fs := newFlagSet("load")
+	opts := procRootFlag(fs)
+	fs.Parse(args)
+	s, err := parseSampling(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	lr := sysstat.NewLoadAvgReader(opts()...)
+	ur := sysstat.NewUptimeReader(opts()...)
+	var a sysstat.LoadAvg
+	var u sysstat.Uptime
+	return s.loop(func(now time.Time, seq int) error {
+		err := lr.Read(&a)
+		if err != nil {
+			return err
+		}
+		err = ur.Read(&u)
+		if err != nil {
+			return err
+		}
+
+		ts := timestamp(now)
+		if seq%headerInterval == 0 {
+			fmt.Printf(loadHeader, ts, "ldavg-1", "ldavg-5", "ldavg-15", "uptime")
+		}
+		fmt.Printf(loadRow, ts, a.Load1, a.Load5, a.Load15, u.Uptime)
+		return nil
+	})
+}
@@ -0,0 +1,163 @@
+// Command sysstat reports system statistics like sar, iostat, mpstat and vmstat.
+//
+// Usage:
+//
+//	sysstat <command> [flags] [interval [count]]
+//
+// The commands are:
+//
+//	cpu   CPU utilization (-P ALL for each CPU)
+//	mem   memory and swap usage
+//	disk  block device I/O statistics
+//	net   network device statistics
+//	fs    filesystem usage
+//	load  load averages and uptime
+//
+// Statistics are printed every interval seconds count times. If interval is
+// omitted, statistics are printed once after one second. If count is omitted,
+// statistics are printed until interrupted.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hnakamur/sysstat"
+)
+
+// headerInterval is the number of rows after which the header is printed again.
+const headerInterval = 20
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"cpu", "CPU utilization", runCPU},
+	{"mem", "memory and swap usage", runMemory},
+	{"disk", "block device I/O statistics", runDisk},
+	{"net", "network device statistics", runNetwork},
+	{"fs", "filesystem usage", runFileSystem},
+	{"load", "load averages and uptime", runLoad},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			err := c.run(os.Args[2:])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "sysstat %s: %s\n", c.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: sysstat <command> [flags] [interval [count]]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-5s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'sysstat <command> -h' for flags of each command.\n")
+}
+
+// sampling is the interval and count parsed from the positional arguments.
+type sampling struct {
+	interval time.Duration
+	// count is the number of reports. Zero means forever.
+	count int
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: sysstat %s [flags] [interval [count]]\n", name)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func parseSampling(args []string) (sampling, error) {
+	s := sampling{interval: time.Second, count: 1}
+	if len(args) > 2 {
+		return s, errors.New("too many arguments")
+	}
+	if len(args) >= 1 {
+		secs, err := strconv.ParseFloat(args[0], 64)
+		if err != nil || secs <= 0 {
+			return s, fmt.Errorf("invalid interval: %s", args[0])
+		}
+		s.interval = time.Duration(secs * float64(time.Second))
+		s.count = 0
+	}
+	if len(args) == 2 {
+		count, err := strconv.Atoi(args[1])
+		if err != nil || count <= 0 {
+			return s, fmt.Errorf("invalid count: %s", args[1])
+		}
+		s.count = count
+	}
+	return s, nil
+}
+
+// loop calls report every interval count times. report is called with
+// the current time and the sequence number of the report starting at zero.
+func (s sampling) loop(report func(now time.Time, seq int) error) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for seq := 0; s.count == 0 || seq < s.count; seq++ {
+		now := <-ticker.C
+		err := report(now, seq)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitList splits a comma separated list. It returns nil for an empty string.
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func deviceFilterFlags(fs *flag.FlagSet, defaultExclude string) func() sysstat.DeviceFilter {
+	include := fs.String("include", "", "comma separated glob patterns of device names to include")
+	exclude := fs.String("exclude", defaultExclude, "comma separated glob patterns of device names to exclude")
+	return func() sysstat.DeviceFilter {
+		return sysstat.DeviceFilter{
+			Include: splitList(*include),
+			Exclude: splitList(*exclude),
+		}
+	}
+}
+
+func procRootFlag(fs *flag.FlagSet) func() []sysstat.Option {
+	procRoot := fs.String("proc", "", "directory where procfs is mounted (default /proc)")
+	return func() []sysstat.Option {
+		if *procRoot == "" {
+			return nil
+		}
+		return []sysstat.Option{sysstat.WithProcRoot(*procRoot)}
+	}
+}
+
+func timestamp(t time.Time) string {
+	return t.Format("15:04:05")
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSampling(t *testing.T) {
+	testCases := []struct {
+		args    []string
+		want    sampling
+		wantErr bool
+	}{
+		{args: nil, want: sampling{interval: time.Second, count: 1}},
+		{args: []string{"2"}, want: sampling{interval: 2 * time.Second, count: 0}},
+		{args: []string{"0.5", "3"}, want: sampling{interval: 500 * time.Millisecond, count: 3}},
+		{args: []string{"0"}, wantErr: true},
+		{args: []string{"-1"}, wantErr: true},
+		{args: []string{"x"}, wantErr: true},
+		{args: []string{"1", "0"}, wantErr: true},
+		{args: []string{"1", "x"}, wantErr: true},
+		{args: []string{"1", "2", "3"}, wantErr: true},
+	}
+	for _, c := range testCases {
+		got, err := parseSampling(c.args)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("error expected for args=%q", c.args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error for args=%q: %s", c.args, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("sampling unmatch for args=%q, got %+v, want %+v", c.args, got, c.want)
+		}
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	testCases := []struct {
+		s    string
+		want []string
+	}{
+		{s: "", want: nil},
+		{s: "sda", want: []string{"sda"}},
+		{s: "sda,sdb", want: []string{"sda", "sdb"}},
+	}
+	for _, c := range testCases {
+		if got := splitList(c.s); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("result unmatch for %q, got %q, want %q", c.s, got, c.want)
+		}
+	}
+}
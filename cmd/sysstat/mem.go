@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hnakamur/sysstat"
+)
+
+const memHeader = "%-8s  %12s %12s %12s %8s %12s %12s %12s %12s %8s\n"
+const memRow = "%-8s  %12d %12d %12d %8.2f %12d %12d %12d %12d %8.2f\n"
+
+func runMemory(args []string) error {
+	fs := newFlagSet("mem")
+	opts := procRootFlag(fs)
+	fs.Parse(args)
+	s, err := parseSampling(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	r := sysstat.NewMemoryStatReader(opts()...)
+	var m sysstat.MemoryStat
+	return s.loop(func(now time.Time, seq int) error {
+		err := r.Read(&m)
+		if err != nil {
+			return err
+		}
+
+		ts := timestamp(now)
+		if seq%headerInterval == 0 {
+			fmt.Printf(memHeader, ts, "kbmemfree", "kbavail", "kbmemused", "%memused",
+				"kbbuffers", "kbcached", "kbswpfree", "kbswpused", "%swpused")
+		}
+		memUsed := memoryUsed(&m)
+		swapUsed := subtract(m.SwapTotal, m.SwapFree)
+		fmt.Printf(memRow, ts, m.MemFree/1024, m.MemAvailable/1024, memUsed/1024,
+			percent(memUsed, m.MemTotal), m.Buffers/1024, m.Cached/1024,
+			m.SwapFree/1024, swapUsed/1024, percent(swapUsed, m.SwapTotal))
+		return nil
+	})
+}
+
+// memoryUsed returns the used memory in the same way as sar -r.
+// Buffers and Cached are not excluded if their sum with MemFree exceeds
+// MemTotal, which can happen since /proc/meminfo is not an atomic snapshot.
+func memoryUsed(m *sysstat.MemoryStat) uint64 {
+	notUsed := m.MemFree + m.Buffers + m.Cached
+	if notUsed > m.MemTotal {
+		notUsed = m.MemFree
+	}
+	return subtract(m.MemTotal, notUsed)
+}
+
+// subtract returns a minus b, or zero if b is larger than a.
+func subtract(a, b uint64) uint64 {
+	if a < b {
+		return 0
+	}
+	return a - b
+}
+
+func percent(v, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(v) / float64(total) * 100
+}
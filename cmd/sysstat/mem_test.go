@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hnakamur/sysstat"
+)
+
+func TestMemoryUsed(t *testing.T) {
+	testCases := []struct {
+		m    sysstat.MemoryStat
+		want uint64
+	}{
+		{m: sysstat.MemoryStat{MemTotal: 1000, MemFree: 100, Buffers: 200, Cached: 300}, want: 400},
+		{m: sysstat.MemoryStat{MemTotal: 1000, MemFree: 100, Buffers: 200, Cached: 800}, want: 900},
+		{m: sysstat.MemoryStat{MemTotal: 1000, MemFree: 1100}, want: 0},
+	}
+	for _, c := range testCases {
+		if got := memoryUsed(&c.m); got != c.want {
+			t.Errorf("result unmatch for %+v, got %d, want %d", c.m, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hnakamur/sysstat"
+)
+
+const netHeader = "%-8s  %-12s %10s %10s %10s %10s %9s %9s %9s %9s %9s\n"
+const netRow = "%-8s  %-12s %10.2f %10.2f %10.2f %10.2f %9.2f %9.2f %9.2f %9.2f %9.2f\n"
+
+func runNetwork(args []string) error {
+	fs := newFlagSet("net")
+	filter := deviceFilterFlags(fs, "")
+	opts := procRootFlag(fs)
+	fs.Parse(args)
+	s, err := parseSampling(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	r, err := sysstat.NewNetworkStatReaderWithFilter(filter(), opts()...)
+	if err != nil {
+		return err
+	}
+	var stats []sysstat.NetworkStat
+	return s.loop(func(now time.Time, seq int) error {
+		stats, err = r.ReadAll(stats)
+		if err != nil {
+			return err
+		}
+
+		// Same columns as sar -n DEV and sar -n EDEV.
+		ts := timestamp(now)
+		fmt.Printf(netHeader, ts, "IFACE", "rxpck/s", "txpck/s", "rxkB/s", "txkB/s",
+			"rxerr/s", "txerr/s", "rxdrop/s", "txdrop/s", "coll/s")
+		for i := range stats {
+			n := &stats[i]
+			fmt.Printf(netRow, ts, n.DevName, n.RecvPacketsPerSec, n.TransPacketsPerSec,
+				n.RecvBytesPerSec/1024, n.TransBytesPerSec/1024, n.RecvErrsPerSec, n.TransErrsPerSec,
+				n.RecvDropsPerSec, n.TransDropsPerSec, n.TransCollsPerSec)
+		}
+		fmt.Println()
+		return nil
+	})
+}
@@ -2,25 +2,44 @@ package sysstat
 
 import (
 	"bytes"
-	"os"
-	"runtime"
-	"syscall"
 	"time"
 
 	"github.com/hnakamur/ascii"
+	"github.com/hnakamur/bytesconv"
 )
 
 // CPUStat is a statistics about CPU.
 type CPUStat struct {
-	UserPercent   float64
-	NicePercent   float64
-	SysPercent    float64
-	IOWaitPercent float64
+	UserPercent      float64
+	NicePercent      float64
+	SysPercent       float64
+	IOWaitPercent    float64
+	IRQPercent       float64
+	SoftIRQPercent   float64
+	StealPercent     float64
+	GuestPercent     float64
+	GuestNicePercent float64
+	IdlePercent      float64
+
+	// ContextSwitchesPerSec is context switches per second (cswch/s).
+	ContextSwitchesPerSec float64
+	// InterruptsPerSec is interrupts serviced per second (intr/s).
+	InterruptsPerSec float64
+	// ForksPerSec is processes and threads created per second (proc/s).
+	ForksPerSec float64
+	// ProcsRunning is the number of runnable threads.
+	ProcsRunning uint64
+	// ProcsBlocked is the number of threads blocked waiting for I/O.
+	ProcsBlocked uint64
+	// BootTime is the time at which the system booted.
+	BootTime time.Time
 }
 
+// RawCPUStat represents cumulative CPU times in /proc/stat.
+// The unit of values is USER_HZ, which is 1/100 of a second on most systems.
 // https://github.com/torvalds/linux/blob/486088bc4689f826b80aa317b45ac9e42e8b25ee/Documentation/filesystems/proc.txt#L1290-L1358
 // https://github.com/torvalds/linux/blob/486088bc4689f826b80aa317b45ac9e42e8b25ee/Documentation/cpu-load.txt
-type rawCPUStat struct {
+type RawCPUStat struct {
 	User      uint64
 	Nice      uint64
 	Sys       uint64
@@ -31,21 +50,64 @@ type rawCPUStat struct {
 	Steal     uint64
 	Guest     uint64
 	GuestNice uint64
+
+	// The fields below are system-wide values in the lines following
+	// the cpu lines. They are read only by CPUStatReader and are zero
+	// in values read by PerCPUStatReader.
+
+	// Ctxt is the total number of context switches.
+	Ctxt uint64
+	// Intr is the total number of interrupts serviced.
+	Intr uint64
+	// Processes is the total number of processes and threads created.
+	Processes uint64
+	// ProcsRunning is the number of runnable threads.
+	ProcsRunning uint64
+	// ProcsBlocked is the number of threads blocked waiting for I/O.
+	ProcsBlocked uint64
+	// BootTime is the boot time in seconds since the Unix epoch.
+	BootTime uint64
+}
+
+// UserWithoutGuest returns User minus Guest, which is the time spent in
+// user mode other than running guests. It returns zero if Guest is larger
+// than User, which can happen since the kernel updates the two values not
+// atomically.
+func (s *RawCPUStat) UserWithoutGuest() uint64 {
+	return subtractClamped(s.User, s.Guest)
+}
+
+// NiceWithoutGuestNice returns Nice minus GuestNice, which is the time
+// spent in user mode with low priority other than running niced guests.
+// It returns zero if GuestNice is larger than Nice.
+func (s *RawCPUStat) NiceWithoutGuestNice() uint64 {
+	return subtractClamped(s.Nice, s.GuestNice)
+}
+
+// subtractClamped returns a minus b, or zero if b is larger than a.
+func subtractClamped(a, b uint64) uint64 {
+	if a < b {
+		return 0
+	}
+	return a - b
 }
 
 // CPUStatReader reads the CPU statistics.
 // CPUStatReader is not safe for concurrent accesses from multiple goroutines.
 type CPUStatReader struct {
-	buf      [8192]byte
+	buf      []byte
 	curr     int
-	stats    [2]rawCPUStat
+	stats    [2]RawCPUStat
 	prevTime time.Time
-	numCPU   int
+	path     []byte
 }
 
 // NewCPUStatReader creates a CPUStatReader.
-func NewCPUStatReader() (*CPUStatReader, error) {
-	r := &CPUStatReader{numCPU: runtime.NumCPU()}
+func NewCPUStatReader(opts ...Option) (*CPUStatReader, error) {
+	o := newOptions(opts)
+	r := &CPUStatReader{
+		path: o.procPath("stat"),
+	}
 	err := r.readCPUStat(nil)
 	if err != nil {
 		return nil, err
@@ -58,18 +120,29 @@ func (r *CPUStatReader) Read(s *CPUStat) error {
 	return r.readCPUStat(s)
 }
 
-func (r *CPUStatReader) readCPUStat(s *CPUStat) error {
-	fd, err := open([]byte("/proc/stat"), os.O_RDONLY, 0)
+// ReadRaw reads cumulative CPU times.
+// The read is also used as the previous sample for the next Read.
+func (r *CPUStatReader) ReadRaw(s *RawCPUStat) error {
+	buf, err := readFile(r.path, &r.buf)
 	if err != nil {
 		return err
 	}
-	defer syscall.Close(fd)
+	err = r.parse(buf, &r.stats[r.curr])
+	if err != nil {
+		return err
+	}
+	*s = r.stats[r.curr]
+	r.prevTime = time.Now()
+	r.switchCurr()
+	return nil
+}
 
-	n, err := syscall.Read(fd, r.buf[:])
+func (r *CPUStatReader) readCPUStat(s *CPUStat) error {
+	buf, err := readFile(r.path, &r.buf)
 	if err != nil {
 		return err
 	}
-	err = r.parse(r.buf[:n], &r.stats[r.curr])
+	err = r.parse(buf, &r.stats[r.curr])
 	if err != nil {
 		return err
 	}
@@ -88,23 +161,197 @@ func (r *CPUStatReader) switchCurr() {
 	r.curr = 1 - r.curr
 }
 
-func (r *CPUStatReader) parse(buf []byte, s *rawCPUStat) error {
+func (r *CPUStatReader) parse(buf []byte, s *RawCPUStat) error {
 	for len(buf) > 0 {
 		line := ascii.GetLine(buf)
+		buf = buf[len(line):]
 		start, end := ascii.NextField(line)
-		if bytes.Equal(line[start:end], []byte("cpu")) {
-			err := r.parseLineAfterName(line[end+1:], s)
+		var ptr *uint64
+		switch string(line[start:end]) {
+		case "cpu":
+			err := parseCPUStatLineAfterName(line[end+1:], s)
+			if err != nil {
+				return err
+			}
+			continue
+		case "ctxt":
+			ptr = &s.Ctxt
+		case "intr":
+			// The first number is the total followed by counts per interrupt.
+			ptr = &s.Intr
+		case "processes":
+			ptr = &s.Processes
+		case "procs_running":
+			ptr = &s.ProcsRunning
+		case "procs_blocked":
+			ptr = &s.ProcsBlocked
+		case "btime":
+			ptr = &s.BootTime
+		default:
+			continue
+		}
+		rest := line[end:]
+		val, err := readUint64Field(&rest)
+		if err != nil {
+			return err
+		}
+		*ptr = val
+	}
+	return nil
+}
+
+func (r *CPUStatReader) fillCPUStat(s *CPUStat, intervalSeconds float64) {
+	curr := &r.stats[r.curr]
+	prev := &r.stats[1-r.curr]
+	fillCPUStat(s, curr, prev, intervalSeconds)
+}
+
+// PerCPUStatReader reads the CPU statistics for each CPU.
+// PerCPUStatReader is not safe for concurrent accesses from multiple goroutines.
+type PerCPUStatReader struct {
+	buf      []byte
+	curr     int
+	stats    [2][]RawCPUStat
+	prevTime time.Time
+	path     []byte
+}
+
+// NewPerCPUStatReader creates a PerCPUStatReader and does an initial read.
+// The number of CPUs is determined from the cpuN lines in /proc/stat
+// when the reader is created.
+func NewPerCPUStatReader(opts ...Option) (*PerCPUStatReader, error) {
+	o := newOptions(opts)
+	r := &PerCPUStatReader{path: o.procPath("stat")}
+	buf, err := readFile(r.path, &r.buf)
+	if err != nil {
+		return nil, err
+	}
+	numCPU, err := r.countCPUs(buf)
+	if err != nil {
+		return nil, err
+	}
+	r.stats[0] = make([]RawCPUStat, numCPU)
+	r.stats[1] = make([]RawCPUStat, numCPU)
+	err = r.readPerCPUStat(nil)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// NumCPU returns the number of CPUs, that is, the maximum CPU id plus one.
+func (r *PerCPUStatReader) NumCPU() int {
+	return len(r.stats[0])
+}
+
+// Read reads CPU statistics for each CPU.
+// stats[i] is filled with the statistics of the CPU whose id is i.
+// Elements of stats at index NumCPU() or greater are left untouched.
+func (r *PerCPUStatReader) Read(stats []CPUStat) error {
+	return r.readPerCPUStat(stats)
+}
+
+// ReadRaw reads cumulative CPU times for each CPU.
+// stats[i] is filled with the CPU times of the CPU whose id is i.
+// Elements of stats at index NumCPU() or greater are left untouched.
+// The read is also used as the previous sample for the next Read.
+func (r *PerCPUStatReader) ReadRaw(stats []RawCPUStat) error {
+	buf, err := readFile(r.path, &r.buf)
+	if err != nil {
+		return err
+	}
+	err = r.parse(buf, r.stats[r.curr])
+	if err != nil {
+		return err
+	}
+	copy(stats, r.stats[r.curr])
+	r.prevTime = time.Now()
+	r.switchCurr()
+	return nil
+}
+
+func (r *PerCPUStatReader) readPerCPUStat(stats []CPUStat) error {
+	buf, err := readFile(r.path, &r.buf)
+	if err != nil {
+		return err
+	}
+	err = r.parse(buf, r.stats[r.curr])
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if stats != nil {
+		intervalSeconds := float64(now.Sub(r.prevTime)) / float64(time.Second)
+		r.fillCPUStats(stats, intervalSeconds)
+	}
+	r.prevTime = now
+	r.switchCurr()
+	return nil
+}
+
+func (r *PerCPUStatReader) fillCPUStats(stats []CPUStat, intervalSeconds float64) {
+	curr := r.stats[r.curr]
+	prev := r.stats[1-r.curr]
+	for i := 0; i < len(stats) && i < len(curr); i++ {
+		fillCPUStat(&stats[i], &curr[i], &prev[i], intervalSeconds)
+	}
+}
+
+func (r *PerCPUStatReader) switchCurr() {
+	r.curr = 1 - r.curr
+}
+
+func (r *PerCPUStatReader) countCPUs(buf []byte) (int, error) {
+	numCPU := 0
+	for len(buf) > 0 {
+		line := ascii.GetLine(buf)
+		id, _, err := parsePerCPUName(line)
+		if err != nil {
+			return 0, err
+		}
+		if id >= numCPU {
+			numCPU = id + 1
+		}
+		buf = buf[len(line):]
+	}
+	return numCPU, nil
+}
+
+func (r *PerCPUStatReader) parse(buf []byte, stats []RawCPUStat) error {
+	for len(buf) > 0 {
+		line := ascii.GetLine(buf)
+		id, end, err := parsePerCPUName(line)
+		if err != nil {
+			return err
+		}
+		if id >= 0 && id < len(stats) {
+			err = parseCPUStatLineAfterName(line[end+1:], &stats[id])
 			if err != nil {
 				return err
 			}
-			break
 		}
 		buf = buf[len(line):]
 	}
 	return nil
 }
 
-func (r *CPUStatReader) parseLineAfterName(buf []byte, s *rawCPUStat) error {
+// parsePerCPUName parses the first field of a line in /proc/stat.
+// It returns the CPU id if the field is "cpuN", or -1 otherwise.
+func parsePerCPUName(line []byte) (id, end int, err error) {
+	start, end := ascii.NextField(line)
+	name := line[start:end]
+	if len(name) <= len("cpu") || !bytes.HasPrefix(name, []byte("cpu")) {
+		return -1, end, nil
+	}
+	v, err := bytesconv.ParseUint(name[len("cpu"):], 10, 32)
+	if err != nil {
+		return -1, end, err
+	}
+	return int(v), end, nil
+}
+
+func parseCPUStatLineAfterName(buf []byte, s *RawCPUStat) error {
 	var err error
 	s.User, err = readUint64Field(&buf)
 	if err != nil {
@@ -146,42 +393,65 @@ func (r *CPUStatReader) parseLineAfterName(buf []byte, s *rawCPUStat) error {
 	return err
 }
 
-func (r *CPUStatReader) fillCPUStat(s *CPUStat, intervalSeconds float64) {
-	curr := &r.stats[r.curr]
-	prev := &r.stats[1-r.curr]
-	s.UserPercent = r.calcUserPercent(curr, prev, intervalSeconds)
-	s.NicePercent = r.calcNicePercent(curr, prev, intervalSeconds)
-	s.SysPercent = r.calcSysPercent(curr, prev, intervalSeconds)
-	s.IOWaitPercent = r.calcIOWaitPercent(curr, prev, intervalSeconds)
+// CalcCPUStat calculates CPU statistics between two snapshots prev and curr
+// read elapsed apart, and stores them into s.
+func CalcCPUStat(s *CPUStat, prev, curr *RawCPUStat, elapsed time.Duration) {
+	fillCPUStat(s, curr, prev, elapsed.Seconds())
 }
 
-func (r *CPUStatReader) calcUserPercent(c, p *rawCPUStat, intervalSeconds float64) float64 {
-	if c.User-c.Guest < p.User-p.Guest {
-		return 0
+// fillCPUStat calculates the percentages as the shares of the ticks of
+// each mode in the ticks of all modes like mpstat does, so they sum up
+// to 100. The user and nice ticks include the guest and guest nice ticks
+// respectively, so the latter are subtracted from the former.
+// Ticks going backward are ignored. Dyn-tick kernels have a race issue
+// that can make counters in /proc/stat go backward, and idle time can go
+// backward on CPU hotplug. See mpstat.c in sysstat.
+func fillCPUStat(s *CPUStat, curr, prev *RawCPUStat, intervalSeconds float64) {
+	user := counterDelta(prev.UserWithoutGuest(), curr.UserWithoutGuest())
+	nice := counterDelta(prev.NiceWithoutGuestNice(), curr.NiceWithoutGuestNice())
+	sys := counterDelta(prev.Sys, curr.Sys)
+	ioWait := counterDelta(prev.IOWait, curr.IOWait)
+	irq := counterDelta(prev.HardIRQ, curr.HardIRQ)
+	softIRQ := counterDelta(prev.SoftIRQ, curr.SoftIRQ)
+	steal := counterDelta(prev.Steal, curr.Steal)
+	guest := counterDelta(prev.Guest, curr.Guest)
+	guestNice := counterDelta(prev.GuestNice, curr.GuestNice)
+	idle := counterDelta(prev.Idle, curr.Idle)
+	total := float64(user + nice + sys + ioWait + irq + softIRQ + steal +
+		guest + guestNice + idle)
+	if total == 0 {
+		// No ticks are accounted for a tickless CPU which has been idle
+		// through the interval. mpstat shows it as 100% idle, too.
+		*s = CPUStat{IdlePercent: 100}
+	} else {
+		s.UserPercent = float64(user) * 100 / total
+		s.NicePercent = float64(nice) * 100 / total
+		s.SysPercent = float64(sys) * 100 / total
+		s.IOWaitPercent = float64(ioWait) * 100 / total
+		s.IRQPercent = float64(irq) * 100 / total
+		s.SoftIRQPercent = float64(softIRQ) * 100 / total
+		s.StealPercent = float64(steal) * 100 / total
+		s.GuestPercent = float64(guest) * 100 / total
+		s.GuestNicePercent = float64(guestNice) * 100 / total
+		s.IdlePercent = float64(idle) * 100 / total
 	}
-	return r.llSpValue(p.User-p.Guest, c.User-c.Guest, intervalSeconds)
-}
-
-func (r *CPUStatReader) calcNicePercent(c, p *rawCPUStat, intervalSeconds float64) float64 {
-	if c.Nice-c.GuestNice < p.Nice-p.GuestNice {
-		return 0
+	s.ContextSwitchesPerSec = counterRate(prev.Ctxt, curr.Ctxt, intervalSeconds)
+	s.InterruptsPerSec = counterRate(prev.Intr, curr.Intr, intervalSeconds)
+	s.ForksPerSec = counterRate(prev.Processes, curr.Processes, intervalSeconds)
+	s.ProcsRunning = curr.ProcsRunning
+	s.ProcsBlocked = curr.ProcsBlocked
+	if curr.BootTime != 0 {
+		s.BootTime = time.Unix(int64(curr.BootTime), 0)
+	} else {
+		s.BootTime = time.Time{}
 	}
-	return r.llSpValue(p.Nice-p.GuestNice, c.Nice-c.GuestNice, intervalSeconds)
-}
-
-func (r *CPUStatReader) calcSysPercent(c, p *rawCPUStat, intervalSeconds float64) float64 {
-	return r.llSpValue(p.Sys, c.Sys, intervalSeconds)
-}
-
-func (r *CPUStatReader) calcIOWaitPercent(c, p *rawCPUStat, intervalSeconds float64) float64 {
-	return r.llSpValue(p.IOWait, c.IOWait, intervalSeconds)
 }
 
-func (r *CPUStatReader) llSpValue(v1, v2 uint64, intervalSeconds float64) float64 {
+func llSpValue(v1, v2 uint64, intervalSeconds float64, numCPU float64) float64 {
 	// Workaround for CPU counters read from /proc/stat: Dyn-tick kernels
 	// have a race issue that can make those counters go backward.
 	if v2 < v1 {
 		return 0
 	}
-	return float64(v2-v1) / intervalSeconds / float64(r.numCPU)
+	return float64(v2-v1) / intervalSeconds / numCPU
 }
@@ -1,6 +1,9 @@
 package sysstat
 
-import "testing"
+import (
+	"math"
+	"testing"
+)
 
 func TestCPUStatReader_parse(t *testing.T) {
 	buf := []byte(`cpu  70688924 148688 17620091 2036888025 2351467 0 1426771 0 18331249 0
@@ -14,7 +17,7 @@ procs_running 3
 procs_blocked 0
 softirq 4630023313 4 1347808053 2165753 637294967 113231921 0 964818 1200133498 0 1328424299
 `)
-	var s rawCPUStat
+	var s RawCPUStat
 	reader, err := NewCPUStatReader()
 	if err != nil {
 		t.Fatal(err)
@@ -38,6 +41,12 @@ softirq 4630023313 4 1347808053 2165753 637294967 113231921 0 964818 1200133498
 		{"Steal", &s.Steal, 0},
 		{"Guest", &s.Guest, 18331249},
 		{"GuestNice", &s.GuestNice, 0},
+		{"Ctxt", &s.Ctxt, 11431573079},
+		{"Intr", &s.Intr, 4879759801},
+		{"Processes", &s.Processes, 23742342},
+		{"ProcsRunning", &s.ProcsRunning, 3},
+		{"ProcsBlocked", &s.ProcsBlocked, 0},
+		{"BootTime", &s.BootTime, 1494729939},
 	}
 	for _, c := range testCases {
 		if *c.ptr != c.want {
@@ -58,7 +67,7 @@ procs_running 3
 procs_blocked 0
 softirq 4630023313 4 1347808053 2165753 637294967 113231921 0 964818 1200133498 0 1328424299
 `)
-	var s rawCPUStat
+	var s RawCPUStat
 	reader, err := NewCPUStatReader()
 	if err != nil {
 		b.Fatal(err)
@@ -84,3 +93,169 @@ func BenchmarkCPUStatReader_Read(b *testing.B) {
 		}
 	}
 }
+
+func TestPerCPUStatReader_parse(t *testing.T) {
+	buf := []byte(`cpu  70688924 148688 17620091 2036888025 2351467 0 1426771 0 18331249 0
+cpu0 35370168 74531 8761044 1019034230 1255954 0 443050 0 9172844 0
+cpu1 35318756 74156 8859047 1017853794 1095513 0 983720 0 9158404 0
+ctxt 11431573079
+btime 1494729939
+processes 23742342
+procs_running 3
+procs_blocked 0
+`)
+	// Note: To avoid actual /proc/stat read, we construct reader manually here
+	reader := new(PerCPUStatReader)
+	numCPU, err := reader.countCPUs(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if numCPU != 2 {
+		t.Fatalf("numCPU unmatch, got %d, want %d", numCPU, 2)
+	}
+	stats := make([]RawCPUStat, numCPU)
+	err = reader.parse(buf, stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		cpu  int
+		name string
+		ptr  *uint64
+		want uint64
+	}{
+		{0, "User", &stats[0].User, 35370168},
+		{0, "Nice", &stats[0].Nice, 74531},
+		{0, "Sys", &stats[0].Sys, 8761044},
+		{0, "Idle", &stats[0].Idle, 1019034230},
+		{0, "Guest", &stats[0].Guest, 9172844},
+		{1, "User", &stats[1].User, 35318756},
+		{1, "Nice", &stats[1].Nice, 74156},
+		{1, "Sys", &stats[1].Sys, 8859047},
+		{1, "Idle", &stats[1].Idle, 1017853794},
+		{1, "Guest", &stats[1].Guest, 9158404},
+	}
+	for _, c := range testCases {
+		if *c.ptr != c.want {
+			t.Errorf("cpu%d stat %s unmatch, got %d, want %d", c.cpu, c.name, *c.ptr, c.want)
+		}
+	}
+}
+
+func BenchmarkPerCPUStatReader_Read(b *testing.B) {
+	reader, err := NewPerCPUStatReader()
+	if err != nil {
+		b.Fatal(err)
+	}
+	stats := make([]CPUStat, reader.NumCPU())
+	for i := 0; i < b.N; i++ {
+		err = reader.Read(stats)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestFillCPUStat(t *testing.T) {
+	prev := RawCPUStat{User: 1000, Nice: 100, Sys: 500, Idle: 10000, IOWait: 50, HardIRQ: 10, SoftIRQ: 20, Steal: 30, Guest: 200, GuestNice: 40,
+		Ctxt: 10000, Intr: 5000, Processes: 300}
+	curr := RawCPUStat{User: 1150, Nice: 110, Sys: 520, Idle: 10582, IOWait: 60, HardIRQ: 12, SoftIRQ: 26, Steal: 50, Guest: 280, GuestNice: 45,
+		Ctxt: 16000, Intr: 6000, Processes: 310, ProcsRunning: 4, ProcsBlocked: 1, BootTime: 1494729939}
+	var s CPUStat
+	fillCPUStat(&s, &curr, &prev, 2)
+	testCases := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"UserPercent", s.UserPercent, 8.75},
+		{"NicePercent", s.NicePercent, 0.625},
+		{"SysPercent", s.SysPercent, 2.5},
+		{"IOWaitPercent", s.IOWaitPercent, 1.25},
+		{"IRQPercent", s.IRQPercent, 0.25},
+		{"SoftIRQPercent", s.SoftIRQPercent, 0.75},
+		{"StealPercent", s.StealPercent, 2.5},
+		{"GuestPercent", s.GuestPercent, 10},
+		{"GuestNicePercent", s.GuestNicePercent, 0.625},
+		{"IdlePercent", s.IdlePercent, 72.75},
+		{"ContextSwitchesPerSec", s.ContextSwitchesPerSec, 3000},
+		{"InterruptsPerSec", s.InterruptsPerSec, 500},
+		{"ForksPerSec", s.ForksPerSec, 5},
+		{"ProcsRunning", float64(s.ProcsRunning), 4},
+		{"ProcsBlocked", float64(s.ProcsBlocked), 1},
+	}
+	for _, c := range testCases {
+		if c.got != c.want {
+			t.Errorf("%s unmatch, got %g, want %g", c.name, c.got, c.want)
+		}
+	}
+	if s.BootTime.Unix() != 1494729939 {
+		t.Errorf("BootTime unmatch, got %d, want %d", s.BootTime.Unix(), 1494729939)
+	}
+}
+
+func TestFillCPUStat_SumOfPercents(t *testing.T) {
+	testCases := []struct {
+		name       string
+		prev, curr RawCPUStat
+	}{
+		{
+			name: "busy",
+			prev: RawCPUStat{User: 1000, Nice: 100, Sys: 500, Idle: 10000, IOWait: 50, HardIRQ: 10, SoftIRQ: 20, Steal: 30, Guest: 200, GuestNice: 40},
+			curr: RawCPUStat{User: 1313, Nice: 117, Sys: 529, Idle: 10101, IOWait: 57, HardIRQ: 13, SoftIRQ: 23, Steal: 31, Guest: 311, GuestNice: 43},
+		},
+		{
+			name: "backward",
+			prev: RawCPUStat{User: 1000, Nice: 100, Sys: 500, Idle: 10000, IOWait: 50},
+			curr: RawCPUStat{User: 1003, Nice: 100, Sys: 507, Idle: 9990, IOWait: 49},
+		},
+		{
+			name: "no ticks",
+			prev: RawCPUStat{User: 1000, Nice: 100, Sys: 500, Idle: 10000},
+			curr: RawCPUStat{User: 1000, Nice: 100, Sys: 500, Idle: 10000},
+		},
+	}
+	for _, c := range testCases {
+		var s CPUStat
+		fillCPUStat(&s, &c.curr, &c.prev, 1)
+		sum := s.UserPercent + s.NicePercent + s.SysPercent + s.IOWaitPercent +
+			s.IRQPercent + s.SoftIRQPercent + s.StealPercent + s.GuestPercent +
+			s.GuestNicePercent + s.IdlePercent
+		if math.Abs(sum-100) > 1e-9 {
+			t.Errorf("%s: sum of percents unmatch, got %g, want 100", c.name, sum)
+		}
+	}
+}
+
+func TestFillCPUStat_GuestAheadOfUser(t *testing.T) {
+	// Guest is sampled ahead of User in curr.
+	prev := RawCPUStat{User: 1000, Nice: 100, Sys: 500, Idle: 10000, Guest: 990}
+	curr := RawCPUStat{User: 1010, Nice: 100, Sys: 510, Idle: 10080, Guest: 1011}
+	var s CPUStat
+	fillCPUStat(&s, &curr, &prev, 1)
+	if s.UserPercent != 0 {
+		t.Errorf("UserPercent unmatch, got %g, want 0", s.UserPercent)
+	}
+	if s.IdlePercent < 50 {
+		t.Errorf("IdlePercent too small, got %g", s.IdlePercent)
+	}
+}
+
+func TestRawCPUStat_UserWithoutGuest(t *testing.T) {
+	testCases := []struct {
+		user, guest, want uint64
+	}{
+		{user: 100, guest: 30, want: 70},
+		{user: 100, guest: 100, want: 0},
+		{user: 100, guest: 101, want: 0},
+	}
+	for _, c := range testCases {
+		s := RawCPUStat{User: c.user, Guest: c.guest, Nice: c.user, GuestNice: c.guest}
+		if got := s.UserWithoutGuest(); got != c.want {
+			t.Errorf("UserWithoutGuest unmatch for user=%d, guest=%d, got %d, want %d", c.user, c.guest, got, c.want)
+		}
+		if got := s.NiceWithoutGuestNice(); got != c.want {
+			t.Errorf("NiceWithoutGuestNice unmatch for nice=%d, guestNice=%d, got %d, want %d", c.user, c.guest, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package sysstat
+
+import (
+	"bytes"
+	"path"
+	"runtime"
+
+	"github.com/hnakamur/ascii"
+	"github.com/hnakamur/bytesconv"
+)
+
+// CPUNormalization is the mode of determining the number of CPUs used
+// for normalizing CPU percentages of CgroupStatReader.
+//
+// CPUStatReader does not need normalization since the percentages are the
+// shares of the ticks of online CPUs in /proc/stat, which is not limited
+// by the CPU quota or the cpuset of a cgroup.
+type CPUNormalization int
+
+const (
+	// CPUNormalizationNone does not normalize, so the percentages are
+	// relative to one CPU. This is the default.
+	CPUNormalizationNone CPUNormalization = iota
+	// CPUNormalizationOnline normalizes by the number of online CPUs,
+	// which is counted from /sys/devices/system/cpu/online on every read,
+	// so it follows CPU hotplug.
+	CPUNormalizationOnline
+	// CPUNormalizationEffective normalizes by the number of CPUs which the
+	// cgroup can use, that is, the minimum of the number of online CPUs,
+	// the number of CPUs in the cpuset and the CPU quota divided by the
+	// period, which can be fractional. The cgroup files are read on every
+	// read, so the percentages are relative to the capacity of the cgroup
+	// even when the quota is changed.
+	CPUNormalizationEffective
+)
+
+// WithCPUNormalization sets the mode of determining the number of CPUs used
+// for normalizing CPU percentages of CgroupStatReader.
+func WithCPUNormalization(mode CPUNormalization) Option {
+	return func(o *options) {
+		o.cpuNormalization = mode
+	}
+}
+
+// cpuCounter counts CPUs for CPUNormalizationOnline and
+// CPUNormalizationEffective.
+type cpuCounter struct {
+	buf        []byte
+	onlinePath []byte
+	// quotaPaths are cpu.max files for cgroup v2, or pairs of
+	// cpu.cfs_quota_us and cpu.cfs_period_us files for cgroup v1,
+	// for the cgroup and its ancestors.
+	quotaPaths [][]byte
+	cpusetPath []byte
+	v1         bool
+}
+
+// newCPUCounter creates a cpuCounter for the cgroup v2 at v2Path, or
+// the cgroup v1 at v1Paths if v1Paths is not nil. It returns nil for
+// CPUNormalizationNone.
+func newCPUCounter(o *options, v2Path string, v1Paths *cgroupV1Paths) *cpuCounter {
+	if o.cpuNormalization == CPUNormalizationNone {
+		return nil
+	}
+	c := &cpuCounter{onlinePath: o.sysPath("devices", "system", "cpu", "online")}
+	if o.cpuNormalization != CPUNormalizationEffective {
+		return c
+	}
+
+	if v1Paths == nil {
+		c.cpusetPath = o.sysPath(cgroupRoot, v2Path, "cpuset.cpus.effective")
+		// The quotas of ancestors also limit the cgroup.
+		for p := v2Path; ; p = path.Dir(p) {
+			c.quotaPaths = append(c.quotaPaths, o.sysPath(cgroupRoot, p, "cpu.max"))
+			if p == "/" || p == "." {
+				break
+			}
+		}
+		return c
+	}
+
+	c.v1 = true
+	if v1Paths.cpuset != "" {
+		c.cpusetPath = o.sysPath(cgroupRoot, "cpuset", v1Paths.cpuset, "cpuset.effective_cpus")
+	}
+	for p := v1Paths.cpu; ; p = path.Dir(p) {
+		c.quotaPaths = append(c.quotaPaths,
+			o.sysPath(cgroupRoot, "cpu", p, "cpu.cfs_quota_us"),
+			o.sysPath(cgroupRoot, "cpu", p, "cpu.cfs_period_us"))
+		if p == "/" || p == "." || p == "" {
+			break
+		}
+	}
+	return c
+}
+
+// count returns the number of CPUs.
+func (c *cpuCounter) count() (float64, error) {
+	n, err := c.countOnline()
+	if err != nil {
+		return 0, err
+	}
+	if c.cpusetPath != nil {
+		b, err := readOptionalFile(c.cpusetPath, &c.buf)
+		if err != nil {
+			return 0, err
+		}
+		if b != nil {
+			cpus, err := countCPUList(b)
+			if err != nil {
+				return 0, err
+			}
+			if cpus > 0 && float64(cpus) < n {
+				n = float64(cpus)
+			}
+		}
+	}
+
+	quota, err := c.readQuota()
+	if err != nil {
+		return 0, err
+	}
+	if quota > 0 && quota < n {
+		n = quota
+	}
+	return n, nil
+}
+
+// countOnline counts the online CPUs in /sys/devices/system/cpu/online.
+// It falls back to runtime.NumCPU() if the file does not exist.
+func (c *cpuCounter) countOnline() (float64, error) {
+	b, err := readOptionalFile(c.onlinePath, &c.buf)
+	if err != nil {
+		return 0, err
+	}
+	if b != nil {
+		n, err := countCPUList(b)
+		if err != nil {
+			return 0, err
+		}
+		if n > 0 {
+			return float64(n), nil
+		}
+	}
+	return float64(runtime.NumCPU()), nil
+}
+
+// countCPUList counts CPUs in a list format like "0-3,8,10-11".
+func countCPUList(buf []byte) (int, error) {
+	buf = bytes.TrimSpace(buf)
+	n := 0
+	for len(buf) > 0 {
+		var item []byte
+		if i := bytes.IndexByte(buf, ','); i != -1 {
+			item, buf = buf[:i], buf[i+1:]
+		} else {
+			item, buf = buf, nil
+		}
+		if i := bytes.IndexByte(item, '-'); i != -1 {
+			first, err := bytesconv.ParseUint(item[:i], 10, 32)
+			if err != nil {
+				return 0, err
+			}
+			last, err := bytesconv.ParseUint(item[i+1:], 10, 32)
+			if err != nil {
+				return 0, err
+			}
+			if last < first {
+				return 0, ErrUnexpectedFormat
+			}
+			n += int(last - first + 1)
+		} else if len(item) > 0 {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// readQuota returns the minimum CPU quota divided by the period of the
+// cgroup and its ancestors, or 0 if no quota is set.
+func (c *cpuCounter) readQuota() (float64, error) {
+	var minQuota float64
+	step := 1
+	if c.v1 {
+		step = 2
+	}
+	for i := 0; i < len(c.quotaPaths); i += step {
+		var quota float64
+		var err error
+		if c.v1 {
+			quota, err = c.readV1Quota(c.quotaPaths[i], c.quotaPaths[i+1])
+		} else {
+			quota, err = c.readCPUMax(c.quotaPaths[i])
+		}
+		if err != nil {
+			return 0, err
+		}
+		if quota > 0 && (minQuota == 0 || quota < minQuota) {
+			minQuota = quota
+		}
+	}
+	return minQuota, nil
+}
+
+// readCPUMax reads cpu.max of cgroup v2, which is "$MAX $PERIOD" where
+// $MAX is "max" for no limit. It returns 0 if no quota is set.
+func (c *cpuCounter) readCPUMax(path []byte) (float64, error) {
+	b, err := readOptionalFile(path, &c.buf)
+	if err != nil || b == nil {
+		return 0, err
+	}
+	start, end := ascii.NextField(b)
+	limit := b[start:end]
+	if bytes.Equal(limit, []byte("max")) {
+		return 0, nil
+	}
+	quota, err := bytesconv.ParseUint(limit, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	b = b[end:]
+	period, err := readUint64Field(&b)
+	if err != nil {
+		return 0, err
+	}
+	if period == 0 {
+		return 0, nil
+	}
+	return float64(quota) / float64(period), nil
+}
+
+// readV1Quota reads cpu.cfs_quota_us and cpu.cfs_period_us of cgroup v1.
+// The quota is -1 for no limit. It returns 0 if no quota is set.
+func (c *cpuCounter) readV1Quota(quotaPath, periodPath []byte) (float64, error) {
+	b, err := readOptionalFile(quotaPath, &c.buf)
+	if err != nil || b == nil {
+		return 0, err
+	}
+	b = bytes.TrimSpace(b)
+	if len(b) > 0 && b[0] == '-' {
+		return 0, nil
+	}
+	quota, err := bytesconv.ParseUint(b, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	b, err = readOptionalFile(periodPath, &c.buf)
+	if err != nil || b == nil {
+		return 0, err
+	}
+	period, err := readUint64Field(&b)
+	if err != nil {
+		return 0, err
+	}
+	if period == 0 {
+		return 0, nil
+	}
+	return float64(quota) / float64(period), nil
+}
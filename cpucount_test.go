@@ -0,0 +1,155 @@
+package sysstat
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCountCPUList(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  int
+	}{
+		{"0\n", 1},
+		{"0-3\n", 4},
+		{"0-3,8,10-11\n", 7},
+		{"\n", 0},
+	}
+	for _, c := range testCases {
+		got, err := countCPUList([]byte(c.input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Errorf("count unmatch for %q, got %d, want %d", c.input, got, c.want)
+		}
+	}
+}
+
+func TestCPUCounter(t *testing.T) {
+	t.Run("online", func(t *testing.T) {
+		sysRoot := t.TempDir()
+		writeFiles(t, filepath.Join(sysRoot, "devices/system/cpu"), map[string]string{"online": "0-3\n"})
+		c := newCPUCounter(newOptions([]Option{WithSysRoot(sysRoot),
+			WithCPUNormalization(CPUNormalizationOnline)}), "/", nil)
+		got, err := c.count()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != 4 {
+			t.Errorf("online CPUs unmatch, got %g, want %g", got, 4.0)
+		}
+
+		// cpu1 goes offline.
+		writeFiles(t, filepath.Join(sysRoot, "devices/system/cpu"), map[string]string{"online": "0,2-3\n"})
+		got, err = c.count()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != 3 {
+			t.Errorf("online CPUs unmatch, got %g, want %g", got, 3.0)
+		}
+	})
+
+	t.Run("v2", func(t *testing.T) {
+		sysRoot := t.TempDir()
+		writeFiles(t, filepath.Join(sysRoot, "devices/system/cpu"), map[string]string{"online": "0-3\n"})
+		writeFiles(t, filepath.Join(sysRoot, "fs/cgroup/kubepods/pod1/app"), map[string]string{
+			"cpu.max":               "max 100000\n",
+			"cpuset.cpus.effective": "0-2\n",
+		})
+		writeFiles(t, filepath.Join(sysRoot, "fs/cgroup/kubepods/pod1"), map[string]string{
+			"cpu.max": "150000 100000\n",
+		})
+		c := newCPUCounter(newOptions([]Option{WithSysRoot(sysRoot),
+			WithCPUNormalization(CPUNormalizationEffective)}), "/kubepods/pod1/app", nil)
+		got, err := c.count()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != 1.5 {
+			t.Errorf("effective CPUs unmatch, got %g, want %g", got, 1.5)
+		}
+	})
+
+	t.Run("v1", func(t *testing.T) {
+		sysRoot := t.TempDir()
+		writeFiles(t, filepath.Join(sysRoot, "devices/system/cpu"), map[string]string{"online": "0-3\n"})
+		writeFiles(t, filepath.Join(sysRoot, "fs/cgroup/cpu/docker/abc"), map[string]string{
+			"cpu.cfs_quota_us":  "-1\n",
+			"cpu.cfs_period_us": "100000\n",
+		})
+		writeFiles(t, filepath.Join(sysRoot, "fs/cgroup/cpuset/docker/abc"), map[string]string{
+			"cpuset.effective_cpus": "1-2\n",
+		})
+		paths := cgroupV1Paths{cpu: "/docker/abc", cpuset: "/docker/abc"}
+		c := newCPUCounter(newOptions([]Option{WithSysRoot(sysRoot),
+			WithCPUNormalization(CPUNormalizationEffective)}), "", &paths)
+		got, err := c.count()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != 2 {
+			t.Errorf("effective CPUs unmatch, got %g, want %g", got, 2.0)
+		}
+	})
+
+	t.Run("v1 without cpuset", func(t *testing.T) {
+		sysRoot := t.TempDir()
+		writeFiles(t, filepath.Join(sysRoot, "devices/system/cpu"), map[string]string{"online": "0-3\n"})
+		writeFiles(t, filepath.Join(sysRoot, "fs/cgroup/cpu/docker/abc"), map[string]string{
+			"cpu.cfs_quota_us":  "50000\n",
+			"cpu.cfs_period_us": "100000\n",
+		})
+		paths := cgroupV1Paths{cpu: "/docker/abc"}
+		c := newCPUCounter(newOptions([]Option{WithSysRoot(sysRoot),
+			WithCPUNormalization(CPUNormalizationEffective)}), "", &paths)
+		got, err := c.count()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != 0.5 {
+			t.Errorf("effective CPUs unmatch, got %g, want %g", got, 0.5)
+		}
+	})
+}
+
+func TestCgroupStatReader_CPUNormalization(t *testing.T) {
+	sysRoot := t.TempDir()
+	dir := filepath.Join(sysRoot, "fs/cgroup/app")
+	writeFiles(t, filepath.Join(sysRoot, "devices/system/cpu"), map[string]string{"online": "0-7\n"})
+	writeFiles(t, dir, map[string]string{
+		"cpu.stat": "usage_usec 0\nuser_usec 0\nsystem_usec 0\n",
+		"cpu.max":  "200000 100000\n",
+	})
+	r, err := NewCgroupStatReader("/app", WithSysRoot(sysRoot),
+		WithCPUNormalization(CPUNormalizationEffective))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, dir, map[string]string{
+		"cpu.stat": "usage_usec 1000000\nuser_usec 600000\nsystem_usec 400000\n",
+	})
+	var s CgroupStat
+	err = r.Read(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.CPUUserPercent <= s.CPUSystemPercent {
+		t.Errorf("CPU percentages unmatch, got user=%g, system=%g", s.CPUUserPercent, s.CPUSystemPercent)
+	}
+	// The quota of 2 CPUs is used instead of the 8 online CPUs.
+	numCPU, err := r.counter.count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if numCPU != 2 {
+		t.Errorf("effective CPUs unmatch, got %g, want %g", numCPU, 2.0)
+	}
+
+	var c CgroupStat
+	calcCgroupStat(&c, &r.stats[1-r.curr], &r.stats[r.curr], 1, numCPU)
+	if c.CPUUsagePercent != 50 || c.CPUUserPercent != 30 || c.CPUSystemPercent != 20 {
+		t.Errorf("CPU percentages unmatch, got usage=%g, user=%g, system=%g", c.CPUUsagePercent, c.CPUUserPercent, c.CPUSystemPercent)
+	}
+}
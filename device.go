@@ -0,0 +1,158 @@
+package sysstat
+
+import (
+	"path"
+
+	"github.com/hnakamur/ascii"
+)
+
+// DeviceFilter selects devices by their names with glob patterns.
+// The pattern syntax is the same as the one of path.Match, for example
+// "loop*", "ram[0-9]*" or "veth*".
+type DeviceFilter struct {
+	// Include is a list of patterns for device names to be tracked.
+	// All devices are included if Include is empty.
+	Include []string
+	// Exclude is a list of patterns for device names not to be tracked.
+	// Exclude takes precedence over Include.
+	Exclude []string
+}
+
+// Match reports whether the device name is selected by the filter.
+func (f *DeviceFilter) Match(name string) bool {
+	for _, pattern := range f.Exclude {
+		if matched, _ := path.Match(pattern, name); matched {
+			return false
+		}
+	}
+	if len(f.Include) == 0 {
+		return true
+	}
+	for _, pattern := range f.Include {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *DeviceFilter) validate() error {
+	for _, pattern := range f.Include {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return err
+		}
+	}
+	for _, pattern := range f.Exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *DeviceFilter) clone() *DeviceFilter {
+	return &DeviceFilter{
+		Include: append([]string(nil), f.Include...),
+		Exclude: append([]string(nil), f.Exclude...),
+	}
+}
+
+// trackedDevice is the state of a device discovered by a reader created
+// with a DeviceFilter.
+type trackedDevice struct {
+	devName string
+
+	// The following fields are used only for discovered devices.
+
+	// selected is true if the device is selected by the filter.
+	selected bool
+	// seen is true if the device is found in the current read.
+	seen bool
+	// samples is the number of reads of the device, saturated at 2.
+	samples int
+}
+
+// deviceTable is a list of devices tracked by a reader of a file which
+// has a line per device, that is, /proc/diskstats or /proc/net/dev.
+type deviceTable interface {
+	numDevices() int
+	device(i int) *trackedDevice
+	appendDevice(devName string, selected bool)
+	copyDevice(dst, src int)
+	truncateDevices(n int)
+	// splitDevName returns the device name in line and the rest of line
+	// after the name. devName is empty for lines without a device name.
+	splitDevName(line []byte) (devName, rest []byte)
+	// parseDevice parses rest into the current sample of the i-th device.
+	parseDevice(i int, rest []byte) error
+}
+
+// discoverDevices parses buf and updates the devices tracked in t.
+// A new device is tracked when it first appears in buf, and a device
+// disappeared from buf is untracked.
+func discoverDevices(t deviceTable, filter *DeviceFilter, buf []byte) error {
+	for i := 0; i < t.numDevices(); i++ {
+		t.device(i).seen = false
+	}
+	hint := 0
+	for len(buf) > 0 {
+		line := ascii.GetLine(buf)
+		buf = buf[len(line):]
+		devName, rest := t.splitDevName(line)
+		if len(devName) == 0 {
+			continue
+		}
+
+		i := indexOfDevName(t, devName, hint)
+		if i == -1 {
+			name := string(devName)
+			t.appendDevice(name, filter.Match(name))
+			i = t.numDevices() - 1
+		}
+		hint = i + 1
+
+		d := t.device(i)
+		d.seen = true
+		if !d.selected {
+			continue
+		}
+		err := t.parseDevice(i, rest)
+		if err != nil {
+			return err
+		}
+		if d.samples < 2 {
+			d.samples++
+		}
+	}
+	removeUnseenDevices(t)
+	return nil
+}
+
+// indexOfDevName returns the index of the device in t, or -1 if not found.
+// Devices in t are usually in the same order as in the file, so the search
+// starts at hint.
+func indexOfDevName(t deviceTable, devName []byte, hint int) int {
+	n := t.numDevices()
+	for i := hint; i < n; i++ {
+		if string(devName) == t.device(i).devName {
+			return i
+		}
+	}
+	for i := 0; i < hint && i < n; i++ {
+		if string(devName) == t.device(i).devName {
+			return i
+		}
+	}
+	return -1
+}
+
+func removeUnseenDevices(t deviceTable) {
+	j := 0
+	for i := 0; i < t.numDevices(); i++ {
+		if t.device(i).seen {
+			t.copyDevice(j, i)
+			j++
+		}
+	}
+	t.truncateDevices(j)
+}
@@ -0,0 +1,32 @@
+package sysstat
+
+import "testing"
+
+func TestDeviceFilter_Match(t *testing.T) {
+	testCases := []struct {
+		filter DeviceFilter
+		name   string
+		want   bool
+	}{
+		{DeviceFilter{}, "sda", true},
+		{DeviceFilter{Exclude: []string{"loop*", "ram*"}}, "sda", true},
+		{DeviceFilter{Exclude: []string{"loop*", "ram*"}}, "loop0", false},
+		{DeviceFilter{Exclude: []string{"loop*", "ram*"}}, "ram15", false},
+		{DeviceFilter{Include: []string{"sd[a-z]", "nvme*"}}, "sdb", true},
+		{DeviceFilter{Include: []string{"sd[a-z]", "nvme*"}}, "sdb1", false},
+		{DeviceFilter{Include: []string{"sd[a-z]", "nvme*"}}, "nvme0n1", true},
+		{DeviceFilter{Include: []string{"nvme*"}, Exclude: []string{"nvme*p*"}}, "nvme0n1p1", false},
+	}
+	for _, c := range testCases {
+		if got := c.filter.Match(c.name); got != c.want {
+			t.Errorf("match unmatch for filter %+v and name %s, got %v, want %v", c.filter, c.name, got, c.want)
+		}
+	}
+}
+
+func TestDeviceFilter_validate(t *testing.T) {
+	f := DeviceFilter{Include: []string{"sd["}}
+	if err := f.validate(); err == nil {
+		t.Error("got nil error for bad pattern")
+	}
+}
@@ -2,8 +2,6 @@ package sysstat
 
 import (
 	"errors"
-	"os"
-	"syscall"
 	"time"
 
 	"github.com/hnakamur/ascii"
@@ -12,18 +10,63 @@ import (
 const sectorBytes = 512
 
 // DiskStat is a statistics about disk.
+// The extended statistics are the same as ones reported by iostat -x.
 type DiskStat struct {
 	DevName            string
 	ReadCountPerSec    float64
 	ReadBytesPerSec    float64
 	WrittenCountPerSec float64
 	WrittenBytesPerSec float64
+
+	// ReadMergedPerSec is the number of read requests merged per second (rrqm/s).
+	ReadMergedPerSec float64
+	// WrittenMergedPerSec is the number of write requests merged per second (wrqm/s).
+	WrittenMergedPerSec float64
+	// ReadAwaitMillis is the average time in milliseconds for read requests
+	// to be served including the time in queue (r_await).
+	ReadAwaitMillis float64
+	// WrittenAwaitMillis is the average time in milliseconds for write requests
+	// to be served including the time in queue (w_await).
+	WrittenAwaitMillis float64
+	// ReadAvgRequestKB is the average size in kilobytes of read requests (rareq-sz).
+	ReadAvgRequestKB float64
+	// WrittenAvgRequestKB is the average size in kilobytes of write requests (wareq-sz).
+	WrittenAvgRequestKB float64
+	// AvgQueueSize is the average queue length of requests (aqu-sz).
+	AvgQueueSize float64
+	// UtilPercent is the percentage of elapsed time during which I/O requests
+	// were issued to the device (%util).
+	UtilPercent float64
+
+	// The discard statistics are available on Linux 4.18 or later,
+	// and they are zero on older kernels.
+	DiscardCountPerSec  float64
+	DiscardMergedPerSec float64
+	DiscardBytesPerSec  float64
+	// DiscardMillisPerSec is the time in milliseconds spent for discard
+	// requests per second.
+	DiscardMillisPerSec float64
+	// DiscardAwaitMillis is the average time in milliseconds for discard
+	// requests to be served (d_await).
+	DiscardAwaitMillis float64
+
+	// The flush statistics are available on Linux 5.5 or later,
+	// and they are zero on older kernels.
+	FlushCountPerSec float64
+	// FlushMillisPerSec is the time in milliseconds spent for flush
+	// requests per second.
+	FlushMillisPerSec float64
+	// FlushAwaitMillis is the average time in milliseconds for flush
+	// requests to be served (f_await).
+	FlushAwaitMillis float64
 }
 
-// DiskStat represents I/O statistics of block devices.
+// RawDiskStat represents cumulative I/O statistics of block devices.
 // https://www.kernel.org/doc/Documentation/ABI/testing/procfs-diskstats
 // https://github.com/torvalds/linux/blob/486088bc4689f826b80aa317b45ac9e42e8b25ee/Documentation/iostats.txt
-type rawDiskStat struct {
+type RawDiskStat struct {
+	//  3 - device name
+	DevName string
 	//  4 - reads completed successfully
 	RdIOs uint64
 	//  5 - reads merged
@@ -40,25 +83,46 @@ type rawDiskStat struct {
 	WrSect uint64
 	// 11 - time spent writing (ms)
 	WrTicks uint64
+	// 12 - I/Os currently in progress
+	IOsPgr uint64
+	// 13 - time spent doing I/Os (ms)
+	TotTicks uint64
+	// 14 - weighted time spent doing I/Os (ms)
+	RqTicks uint64
+	// 15 - discards completed successfully (Linux 4.18+)
+	DcIOs uint64
+	// 16 - discards merged (Linux 4.18+)
+	DcMerges uint64
+	// 17 - sectors discarded (Linux 4.18+)
+	DcSect uint64
+	// 18 - time spent discarding (ms, Linux 4.18+)
+	DcTicks uint64
+	// 19 - flush requests completed successfully (Linux 5.5+)
+	FlIOs uint64
+	// 20 - time spent flushing (ms, Linux 5.5+)
+	FlTicks uint64
 }
 
 type lastTwoRawDiskStats struct {
-	devName string
-	stats   [2]rawDiskStat
+	trackedDevice
+	stats [2]RawDiskStat
 }
 
 // DiskStatReader is used for reading disk statistics.
 // DiskStatReader is not safe for concurrent acceses from multiple goroutines.
 type DiskStatReader struct {
-	buf      [8192]byte
+	buf      []byte
 	curr     int
 	stats    []lastTwoRawDiskStats
 	prevTime time.Time
+	path     []byte
+	filter   *DeviceFilter
 }
 
 // NewDiskStatReader creates a DiskStatReader and does an initial read.
-func NewDiskStatReader(devNames []string) (*DiskStatReader, error) {
-	r := new(DiskStatReader)
+func NewDiskStatReader(devNames []string, opts ...Option) (*DiskStatReader, error) {
+	o := newOptions(opts)
+	r := &DiskStatReader{path: o.procPath("diskstats")}
 	r.allocStats(devNames)
 	err := r.readDiskStat(nil)
 	if err != nil {
@@ -67,6 +131,27 @@ func NewDiskStatReader(devNames []string) (*DiskStatReader, error) {
 	return r, nil
 }
 
+// NewDiskStatReaderWithFilter creates a DiskStatReader which tracks all devices
+// in /proc/diskstats selected by filter and does an initial read.
+// Devices which appear or disappear later are tracked or untracked on each read.
+// Use ReadAll to read statistics of the tracked devices.
+func NewDiskStatReaderWithFilter(filter DeviceFilter, opts ...Option) (*DiskStatReader, error) {
+	err := filter.validate()
+	if err != nil {
+		return nil, err
+	}
+	o := newOptions(opts)
+	r := &DiskStatReader{
+		path:   o.procPath("diskstats"),
+		filter: filter.clone(),
+	}
+	err = r.readDiskStat(nil)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
 func (r *DiskStatReader) allocStats(devNames []string) {
 	stats := make([]lastTwoRawDiskStats, len(devNames))
 	for i := 0; i < len(stats); i++ {
@@ -80,18 +165,74 @@ func (r *DiskStatReader) Read(stats []DiskStat) error {
 	return r.readDiskStat(stats)
 }
 
-func (r *DiskStatReader) readDiskStat(stats []DiskStat) error {
-	fd, err := open([]byte("/proc/diskstats"), os.O_RDONLY, 0)
+// ReadAll reads statistics about all the tracked devices and appends them
+// to stats[:0]. The capacity of stats is reused, so no memory is allocated
+// once stats has grown enough.
+// For a reader created by NewDiskStatReaderWithFilter, devices which appeared
+// after the previous read are included from the next read since rates need
+// two samples.
+func (r *DiskStatReader) ReadAll(stats []DiskStat) ([]DiskStat, error) {
+	err := r.readAndParse()
 	if err != nil {
-		return err
+		return stats, err
 	}
-	defer syscall.Close(fd)
 
-	n, err := syscall.Read(fd, r.buf[:])
+	now := time.Now()
+	intervalSeconds := float64(now.Sub(r.prevTime)) / float64(time.Second)
+	stats = r.appendDiskStats(stats[:0], intervalSeconds)
+	r.prevTime = now
+	r.switchCurr()
+	return stats, nil
+}
+
+// ReadRaw reads cumulative statistics about devices whose names are set
+// to DevName of elements of stats.
+// The read is also used as the previous sample for the next Read or ReadAll.
+func (r *DiskStatReader) ReadRaw(stats []RawDiskStat) error {
+	err := r.readAndParse()
 	if err != nil {
 		return err
 	}
-	err = r.parse(r.buf[:n], r.stats)
+
+	for i := 0; i < len(stats); i++ {
+		lastTwo := r.findLastTwoRawDiskStats(stats[i].DevName)
+		if lastTwo == nil || (r.filter != nil && !lastTwo.selected) {
+			return errors.New("device name not found in disk stats")
+		}
+		devName := stats[i].DevName
+		stats[i] = lastTwo.stats[r.curr]
+		stats[i].DevName = devName
+	}
+	r.prevTime = time.Now()
+	r.switchCurr()
+	return nil
+}
+
+// ReadAllRaw reads cumulative statistics about all the tracked devices and
+// appends them to stats[:0] like ReadAll.
+// The read is also used as the previous sample for the next Read or ReadAll.
+func (r *DiskStatReader) ReadAllRaw(stats []RawDiskStat) ([]RawDiskStat, error) {
+	err := r.readAndParse()
+	if err != nil {
+		return stats, err
+	}
+
+	stats = stats[:0]
+	for i := 0; i < len(r.stats); i++ {
+		lastTwo := &r.stats[i]
+		if r.filter != nil && !lastTwo.selected {
+			continue
+		}
+		stats = append(stats, lastTwo.stats[r.curr])
+		stats[len(stats)-1].DevName = lastTwo.devName
+	}
+	r.prevTime = time.Now()
+	r.switchCurr()
+	return stats, nil
+}
+
+func (r *DiskStatReader) readDiskStat(stats []DiskStat) error {
+	err := r.readAndParse()
 	if err != nil {
 		return err
 	}
@@ -109,10 +250,33 @@ func (r *DiskStatReader) readDiskStat(stats []DiskStat) error {
 	return nil
 }
 
+func (r *DiskStatReader) readAndParse() error {
+	buf, err := readFile(r.path, &r.buf)
+	if err != nil {
+		return err
+	}
+	if r.filter != nil {
+		return discoverDevices(r, r.filter, buf)
+	}
+	return r.parse(buf, r.stats)
+}
+
+func (r *DiskStatReader) appendDiskStats(stats []DiskStat, intervalSeconds float64) []DiskStat {
+	for i := 0; i < len(r.stats); i++ {
+		lastTwo := &r.stats[i]
+		if !r.isReady(lastTwo) {
+			continue
+		}
+		stats = append(stats, DiskStat{DevName: lastTwo.devName})
+		r.fillDiskStat(&stats[len(stats)-1], lastTwo, intervalSeconds)
+	}
+	return stats
+}
+
 func (r *DiskStatReader) fillDiskStats(stats []DiskStat, intervalSeconds float64) error {
 	for i := 0; i < len(stats); i++ {
 		lastTwo := r.findLastTwoRawDiskStats(stats[i].DevName)
-		if lastTwo == nil {
+		if lastTwo == nil || !r.isReady(lastTwo) {
 			return errors.New("device name not found in disk stats")
 		}
 
@@ -122,12 +286,53 @@ func (r *DiskStatReader) fillDiskStats(stats []DiskStat, intervalSeconds float64
 }
 
 func (r *DiskStatReader) fillDiskStat(s *DiskStat, lastTwo *lastTwoRawDiskStats, intervalSeconds float64) {
-	c := &lastTwo.stats[r.curr]
-	p := &lastTwo.stats[1-r.curr]
-	s.ReadCountPerSec = float64(c.RdIOs-p.RdIOs) / intervalSeconds
-	s.ReadBytesPerSec = float64(c.RdSect-p.RdSect) * sectorBytes / intervalSeconds
-	s.WrittenCountPerSec = float64(c.WrIOs-p.WrIOs) / intervalSeconds
-	s.WrittenBytesPerSec = float64(c.WrSect-p.WrSect) * sectorBytes / intervalSeconds
+	calcDiskStat(s, &lastTwo.stats[r.curr], &lastTwo.stats[1-r.curr], intervalSeconds)
+}
+
+// CalcDiskStat calculates disk statistics between two snapshots prev and
+// curr read elapsed apart, and stores them into s.
+// s.DevName is set to curr.DevName.
+func CalcDiskStat(s *DiskStat, prev, curr *RawDiskStat, elapsed time.Duration) {
+	s.DevName = curr.DevName
+	calcDiskStat(s, curr, prev, elapsed.Seconds())
+}
+
+func calcDiskStat(s *DiskStat, c, p *RawDiskStat, intervalSeconds float64) {
+	s.ReadCountPerSec = counterRate(p.RdIOs, c.RdIOs, intervalSeconds)
+	s.ReadBytesPerSec = counterRate(p.RdSect, c.RdSect, intervalSeconds) * sectorBytes
+	s.WrittenCountPerSec = counterRate(p.WrIOs, c.WrIOs, intervalSeconds)
+	s.WrittenBytesPerSec = counterRate(p.WrSect, c.WrSect, intervalSeconds) * sectorBytes
+
+	// See write_ext_stat in iostat.c of sysstat.
+	s.ReadMergedPerSec = counterRate(p.RdMerges, c.RdMerges, intervalSeconds)
+	s.WrittenMergedPerSec = counterRate(p.WrMerges, c.WrMerges, intervalSeconds)
+	s.ReadAwaitMillis, s.ReadAvgRequestKB = calcAwaitAndAvgRequestKB(
+		counterDelta(p.RdIOs, c.RdIOs), counterDelta(p.RdTicks, c.RdTicks), counterDelta(p.RdSect, c.RdSect))
+	s.WrittenAwaitMillis, s.WrittenAvgRequestKB = calcAwaitAndAvgRequestKB(
+		counterDelta(p.WrIOs, c.WrIOs), counterDelta(p.WrTicks, c.WrTicks), counterDelta(p.WrSect, c.WrSect))
+	s.AvgQueueSize = counterRate(p.RqTicks, c.RqTicks, intervalSeconds) / 1000
+	s.UtilPercent = counterRate(p.TotTicks, c.TotTicks, intervalSeconds) / 1000 * 100
+	if s.UtilPercent > 100 {
+		s.UtilPercent = 100
+	}
+
+	s.DiscardCountPerSec = counterRate(p.DcIOs, c.DcIOs, intervalSeconds)
+	s.DiscardMergedPerSec = counterRate(p.DcMerges, c.DcMerges, intervalSeconds)
+	s.DiscardBytesPerSec = counterRate(p.DcSect, c.DcSect, intervalSeconds) * sectorBytes
+	s.DiscardMillisPerSec = counterRate(p.DcTicks, c.DcTicks, intervalSeconds)
+	s.DiscardAwaitMillis, _ = calcAwaitAndAvgRequestKB(
+		counterDelta(p.DcIOs, c.DcIOs), counterDelta(p.DcTicks, c.DcTicks), counterDelta(p.DcSect, c.DcSect))
+	s.FlushCountPerSec = counterRate(p.FlIOs, c.FlIOs, intervalSeconds)
+	s.FlushMillisPerSec = counterRate(p.FlTicks, c.FlTicks, intervalSeconds)
+	s.FlushAwaitMillis, _ = calcAwaitAndAvgRequestKB(
+		counterDelta(p.FlIOs, c.FlIOs), counterDelta(p.FlTicks, c.FlTicks), 0)
+}
+
+func calcAwaitAndAvgRequestKB(ios, ticks, sect uint64) (awaitMillis, avgRequestKB float64) {
+	if ios == 0 {
+		return 0, 0
+	}
+	return float64(ticks) / float64(ios), float64(sect) * sectorBytes / 1024 / float64(ios)
 }
 
 func (r *DiskStatReader) findLastTwoRawDiskStats(devName string) *lastTwoRawDiskStats {
@@ -139,6 +344,11 @@ func (r *DiskStatReader) findLastTwoRawDiskStats(devName string) *lastTwoRawDisk
 	return nil
 }
 
+// isReady reports whether rates of the device can be calculated.
+func (r *DiskStatReader) isReady(lastTwo *lastTwoRawDiskStats) bool {
+	return r.filter == nil || (lastTwo.selected && lastTwo.samples == 2)
+}
+
 func (r *DiskStatReader) switchCurr() {
 	r.curr = 1 - r.curr
 }
@@ -162,7 +372,46 @@ func (r *DiskStatReader) parse(buf []byte, stats []lastTwoRawDiskStats) error {
 	return nil
 }
 
-func (r *DiskStatReader) parseLineAfterDevName(buf []byte, s *rawDiskStat) error {
+// The methods below implement deviceTable.
+
+func (r *DiskStatReader) numDevices() int {
+	return len(r.stats)
+}
+
+func (r *DiskStatReader) device(i int) *trackedDevice {
+	return &r.stats[i].trackedDevice
+}
+
+func (r *DiskStatReader) appendDevice(devName string, selected bool) {
+	r.stats = append(r.stats, lastTwoRawDiskStats{
+		trackedDevice: trackedDevice{devName: devName, selected: selected},
+	})
+}
+
+func (r *DiskStatReader) copyDevice(dst, src int) {
+	r.stats[dst] = r.stats[src]
+}
+
+func (r *DiskStatReader) truncateDevices(n int) {
+	for i := n; i < len(r.stats); i++ {
+		r.stats[i] = lastTwoRawDiskStats{}
+	}
+	r.stats = r.stats[:n]
+}
+
+func (r *DiskStatReader) splitDevName(line []byte) (devName, rest []byte) {
+	start, end := ascii.NthField(line, 2)
+	if start == end {
+		return nil, nil
+	}
+	return line[start:end], line[end+1:]
+}
+
+func (r *DiskStatReader) parseDevice(i int, rest []byte) error {
+	return r.parseLineAfterDevName(rest, &r.stats[i].stats[r.curr])
+}
+
+func (r *DiskStatReader) parseLineAfterDevName(buf []byte, s *RawDiskStat) error {
 	var err error
 	s.RdIOs, err = readUint64Field(&buf)
 	if err != nil {
@@ -193,5 +442,50 @@ func (r *DiskStatReader) parseLineAfterDevName(buf []byte, s *rawDiskStat) error
 		return err
 	}
 	s.WrTicks, err = readUint64Field(&buf)
+	if err != nil {
+		return err
+	}
+	s.IOsPgr, err = readUint64Field(&buf)
+	if err != nil {
+		return err
+	}
+	s.TotTicks, err = readUint64Field(&buf)
+	if err != nil {
+		return err
+	}
+	s.RqTicks, err = readUint64Field(&buf)
+	if err != nil {
+		return err
+	}
+
+	// The number of fields depends on the kernel version.
+	if !hasNextField(buf) {
+		return nil
+	}
+	s.DcIOs, err = readUint64Field(&buf)
+	if err != nil {
+		return err
+	}
+	s.DcMerges, err = readUint64Field(&buf)
+	if err != nil {
+		return err
+	}
+	s.DcSect, err = readUint64Field(&buf)
+	if err != nil {
+		return err
+	}
+	s.DcTicks, err = readUint64Field(&buf)
+	if err != nil {
+		return err
+	}
+
+	if !hasNextField(buf) {
+		return nil
+	}
+	s.FlIOs, err = readUint64Field(&buf)
+	if err != nil {
+		return err
+	}
+	s.FlTicks, err = readUint64Field(&buf)
 	return err
 }
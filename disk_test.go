@@ -2,8 +2,10 @@ package sysstat
 
 import (
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestDiskStatReader_parse(t *testing.T) {
@@ -53,6 +55,9 @@ func TestDiskStatReader_parse(t *testing.T) {
 		{0, "WrMerges", &stats[0].stats[reader.curr].WrMerges, 2630},
 		{0, "WrSect", &stats[0].stats[reader.curr].WrSect, 480699421},
 		{0, "WrTicks", &stats[0].stats[reader.curr].WrTicks, 5326092},
+		{0, "IOsPgr", &stats[0].stats[reader.curr].IOsPgr, 0},
+		{0, "TotTicks", &stats[0].stats[reader.curr].TotTicks, 42767900},
+		{0, "RqTicks", &stats[0].stats[reader.curr].RqTicks, 80233776},
 		{1, "RdIOs", &stats[1].stats[reader.curr].RdIOs, 5544832},
 		{1, "RdMerges", &stats[1].stats[reader.curr].RdMerges, 2815913},
 		{1, "RdSect", &stats[1].stats[reader.curr].RdSect, 247978488},
@@ -61,6 +66,9 @@ func TestDiskStatReader_parse(t *testing.T) {
 		{1, "WrMerges", &stats[1].stats[reader.curr].WrMerges, 61635299},
 		{1, "WrSect", &stats[1].stats[reader.curr].WrSect, 4134504954},
 		{1, "WrTicks", &stats[1].stats[reader.curr].WrTicks, 1305616336},
+		{1, "IOsPgr", &stats[1].stats[reader.curr].IOsPgr, 0},
+		{1, "TotTicks", &stats[1].stats[reader.curr].TotTicks, 25602936},
+		{1, "RqTicks", &stats[1].stats[reader.curr].RqTicks, 1343425972},
 	}
 	for _, c := range testCases {
 		if *c.ptr != c.want {
@@ -129,3 +137,208 @@ func BenchmarkDiskStatReader_Read(b *testing.B) {
 		}
 	}
 }
+
+func TestDiskStatReader_discover(t *testing.T) {
+	buf1 := []byte(`   7       0 loop0 10373 0 25194 476 0 0 0 0 0 124 476
+   8       0 sda 18115828 30368 4557439074 74915904 2432358 2630 480699421 5326092 0 42767900 80233776
+   8       1 sda1 18115502 30368 4557434718 74913284 2405484 2630 480699421 2968916 0 40412152 77873980
+   8      16 sdb 5544832 2815913 247978488 36492504 58421052 61635299 4134504954 1305616336 0 25602936 1343425972
+`)
+	buf2 := []byte(`   7       0 loop0 10373 0 25194 476 0 0 0 0 0 124 476
+   8       0 sda 18115928 30368 4557439274 74915904 2432358 2630 480699421 5326092 0 42767900 80233776
+   8       1 sda1 18115602 30368 4557434918 74913284 2405484 2630 480699421 2968916 0 40412152 77873980
+   8      32 sdc 18260428 34965 4556272723 31999648 2446024 2481 480699421 3506836 0 23124200 35499712
+`)
+	// Note: To avoid actual disk read, we construct reader manually here
+	reader := &DiskStatReader{filter: &DeviceFilter{Exclude: []string{"loop*", "sd[a-z][0-9]*"}}}
+	err := discoverDevices(reader, reader.filter, buf1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader.switchCurr()
+	err = discoverDevices(reader, reader.filter, buf2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		devName  string
+		selected bool
+		samples  int
+	}{
+		{"loop0", false, 0},
+		{"sda", true, 2},
+		{"sda1", false, 0},
+		{"sdc", true, 1},
+	}
+	if len(reader.stats) != len(testCases) {
+		t.Fatalf("tracked device count unmatch, got %d, want %d", len(reader.stats), len(testCases))
+	}
+	for i, c := range testCases {
+		s := &reader.stats[i]
+		if s.devName != c.devName || s.selected != c.selected || s.samples != c.samples {
+			t.Errorf("tracked device %d unmatch, got {%s %v %d}, want {%s %v %d}",
+				i, s.devName, s.selected, s.samples, c.devName, c.selected, c.samples)
+		}
+	}
+
+	stats := reader.appendDiskStats(nil, 1)
+	if len(stats) != 1 || stats[0].DevName != "sda" {
+		t.Fatalf("disk stats unmatch, got %+v", stats)
+	}
+	if stats[0].ReadCountPerSec != 100 {
+		t.Errorf("ReadCountPerSec unmatch, got %g, want %g", stats[0].ReadCountPerSec, 100.0)
+	}
+	if stats[0].ReadBytesPerSec != 200*sectorBytes {
+		t.Errorf("ReadBytesPerSec unmatch, got %g, want %g", stats[0].ReadBytesPerSec, float64(200*sectorBytes))
+	}
+}
+
+func BenchmarkDiskStatReader_ReadAll(b *testing.B) {
+	reader, err := NewDiskStatReaderWithFilter(DeviceFilter{Exclude: []string{"loop*", "ram*"}})
+	if err != nil {
+		b.Fatal(err)
+	}
+	var stats []DiskStat
+	for i := 0; i < b.N; i++ {
+		stats, err = reader.ReadAll(stats)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDiskStatReader_fillDiskStat(t *testing.T) {
+	reader := new(DiskStatReader)
+	lastTwo := lastTwoRawDiskStats{trackedDevice: trackedDevice{devName: "sda"}}
+	lastTwo.stats[1-reader.curr] = RawDiskStat{RdIOs: 1000, RdMerges: 10, RdSect: 8000, RdTicks: 500, WrIOs: 2000, WrMerges: 20, WrSect: 32000, WrTicks: 4000, TotTicks: 10000, RqTicks: 20000}
+	lastTwo.stats[reader.curr] = RawDiskStat{RdIOs: 1100, RdMerges: 30, RdSect: 8800, RdTicks: 700, WrIOs: 2200, WrMerges: 60, WrSect: 35200, WrTicks: 5000, TotTicks: 11500, RqTicks: 22400}
+	var s DiskStat
+	reader.fillDiskStat(&s, &lastTwo, 2)
+	testCases := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"ReadCountPerSec", s.ReadCountPerSec, 50},
+		{"ReadBytesPerSec", s.ReadBytesPerSec, 204800},
+		{"WrittenCountPerSec", s.WrittenCountPerSec, 100},
+		{"WrittenBytesPerSec", s.WrittenBytesPerSec, 819200},
+		{"ReadMergedPerSec", s.ReadMergedPerSec, 10},
+		{"WrittenMergedPerSec", s.WrittenMergedPerSec, 20},
+		{"ReadAwaitMillis", s.ReadAwaitMillis, 2},
+		{"WrittenAwaitMillis", s.WrittenAwaitMillis, 5},
+		{"ReadAvgRequestKB", s.ReadAvgRequestKB, 4},
+		{"WrittenAvgRequestKB", s.WrittenAvgRequestKB, 8},
+		{"AvgQueueSize", s.AvgQueueSize, 1.2},
+		{"UtilPercent", s.UtilPercent, 75},
+	}
+	for _, c := range testCases {
+		if c.got != c.want {
+			t.Errorf("%s unmatch, got %g, want %g", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestCalcDiskStat_CounterBackward(t *testing.T) {
+	prev := RawDiskStat{DevName: "sda", RdIOs: 1100, RdSect: 8800, RdTicks: 700, WrIOs: 2200, WrMerges: 60, WrSect: 35200, WrTicks: 5000, TotTicks: 11500, RqTicks: 22400, DcIOs: 30, FlIOs: 20, FlTicks: 10}
+	curr := RawDiskStat{DevName: "sda", RdIOs: 1000, RdSect: 8000, RdTicks: 500, WrIOs: 2300, WrMerges: 20, WrSect: 36000, WrTicks: 4000, TotTicks: 10000, RqTicks: 20000, DcIOs: 10, FlIOs: 10, FlTicks: 5}
+	var s DiskStat
+	CalcDiskStat(&s, &prev, &curr, 2*time.Second)
+	testCases := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"ReadCountPerSec", s.ReadCountPerSec, 0},
+		{"ReadBytesPerSec", s.ReadBytesPerSec, 0},
+		{"ReadAwaitMillis", s.ReadAwaitMillis, 0},
+		{"WrittenCountPerSec", s.WrittenCountPerSec, 50},
+		{"WrittenBytesPerSec", s.WrittenBytesPerSec, 204800},
+		{"WrittenMergedPerSec", s.WrittenMergedPerSec, 0},
+		{"WrittenAwaitMillis", s.WrittenAwaitMillis, 0},
+		{"WrittenAvgRequestKB", s.WrittenAvgRequestKB, 4},
+		{"AvgQueueSize", s.AvgQueueSize, 0},
+		{"UtilPercent", s.UtilPercent, 0},
+		{"DiscardCountPerSec", s.DiscardCountPerSec, 0},
+		{"FlushCountPerSec", s.FlushCountPerSec, 0},
+		{"FlushMillisPerSec", s.FlushMillisPerSec, 0},
+	}
+	for _, c := range testCases {
+		if c.got != c.want {
+			t.Errorf("%s unmatch, got %g, want %g", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestDiskStatReader_parseDiscardAndFlush(t *testing.T) {
+	buf := []byte(` 259       0 nvme0n1 1167395 390170 78155232 288127 3458011 2510452 180598232 2457006 0 1453708 2854102 34529 0 248153440 2617 152317 106351
+ 259       1 nvme0n1p1 472 1006 24090 93 2 0 2 0 0 104 95 0 0 0 0
+   8       0 sda 18115828 30368 4557439074 74915904 2432358 2630 480699421 5326092 0 42767900 80233776
+`)
+	reader := new(DiskStatReader)
+	stats := make([]lastTwoRawDiskStats, 3)
+	stats[0].devName = "nvme0n1"
+	stats[1].devName = "nvme0n1p1"
+	stats[2].devName = "sda"
+	err := reader.parse(buf, stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		devIndex int
+		name     string
+		ptr      *uint64
+		want     uint64
+	}{
+		{0, "RqTicks", &stats[0].stats[reader.curr].RqTicks, 2854102},
+		{0, "DcIOs", &stats[0].stats[reader.curr].DcIOs, 34529},
+		{0, "DcMerges", &stats[0].stats[reader.curr].DcMerges, 0},
+		{0, "DcSect", &stats[0].stats[reader.curr].DcSect, 248153440},
+		{0, "DcTicks", &stats[0].stats[reader.curr].DcTicks, 2617},
+		{0, "FlIOs", &stats[0].stats[reader.curr].FlIOs, 152317},
+		{0, "FlTicks", &stats[0].stats[reader.curr].FlTicks, 106351},
+		{1, "RqTicks", &stats[1].stats[reader.curr].RqTicks, 95},
+		{1, "DcIOs", &stats[1].stats[reader.curr].DcIOs, 0},
+		{1, "FlIOs", &stats[1].stats[reader.curr].FlIOs, 0},
+		{2, "RqTicks", &stats[2].stats[reader.curr].RqTicks, 80233776},
+		{2, "DcIOs", &stats[2].stats[reader.curr].DcIOs, 0},
+		{2, "FlIOs", &stats[2].stats[reader.curr].FlIOs, 0},
+	}
+	for _, c := range testCases {
+		if *c.ptr != c.want {
+			t.Errorf("dev %d %s unmatch, got %d, want %d", c.devIndex, c.name, *c.ptr, c.want)
+		}
+	}
+}
+
+func TestDiskStatReader_ReadRaw(t *testing.T) {
+	procRoot := t.TempDir()
+	err := os.WriteFile(filepath.Join(procRoot, "diskstats"), []byte(`   7       0 loop0 10373 0 25194 476 0 0 0 0 0 124 476
+   8       0 sda 18115828 30368 4557439074 74915904 2432358 2630 480699421 5326092 0 42767900 80233776
+   8      16 sdb 5544832 2815913 247978488 36492504 58421052 61635299 4134504954 1305616336 0 25602936 1343425972
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := NewDiskStatReader([]string{"sda", "sdb"}, WithProcRoot(procRoot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := []RawDiskStat{{DevName: "sdb"}, {DevName: "sda"}}
+	err = reader.ReadRaw(stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats[0].DevName != "sdb" || stats[0].RdIOs != 5544832 {
+		t.Errorf("stats[0] unmatch, got DevName=%s RdIOs=%d, want DevName=sdb RdIOs=5544832", stats[0].DevName, stats[0].RdIOs)
+	}
+	if stats[1].DevName != "sda" || stats[1].RdIOs != 18115828 {
+		t.Errorf("stats[1] unmatch, got DevName=%s RdIOs=%d, want DevName=sda RdIOs=18115828", stats[1].DevName, stats[1].RdIOs)
+	}
+
+	err = reader.ReadRaw([]RawDiskStat{{DevName: "sdz"}})
+	if err == nil {
+		t.Error("got nil error for unknown device")
+	}
+}
@@ -4,3 +4,17 @@ import "errors"
 
 // ErrUnexpectedFormat is an error which is returned when the output format is unexpected.
 var ErrUnexpectedFormat = errors.New("unexpected format")
+
+// ErrPSIUnavailable is an error which is returned when Pressure Stall Information
+// is not available because the kernel is older than 4.20, was built without
+// CONFIG_PSI, or was booted with psi=0.
+var ErrPSIUnavailable = errors.New("pressure stall information unavailable")
+
+// ErrStatfsTimeout is an error which is returned when statfs does not return
+// within the timeout set with WithStatfsTimeout, for example, for a filesystem
+// on an unresponsive NFS server.
+var ErrStatfsTimeout = errors.New("statfs timed out")
+
+// ErrTooManyProcesses is an error which is returned when there are more
+// processes than the maximum number of processes tracked by TopProcessReader.
+var ErrTooManyProcesses = errors.New("too many processes")
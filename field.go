@@ -15,6 +15,11 @@ func readFloat64Field(buf *[]byte) (float64, error) {
 	return val, nil
 }
 
+func hasNextField(buf []byte) bool {
+	start, end := ascii.NextField(buf)
+	return start < end
+}
+
 func readUint64Field(buf *[]byte) (uint64, error) {
 	start, end := ascii.NextField(*buf)
 	val, err := bytesconv.ParseUint((*buf)[start:end], 10, 64)
@@ -34,3 +39,18 @@ func readNthUint64Field(buf *[]byte, n int) (uint64, error) {
 	*buf = (*buf)[end+1:]
 	return val, nil
 }
+
+// counterRate returns the rate of a counter from v1 to v2 per second,
+// or zero if the counter goes backward.
+func counterRate(v1, v2 uint64, intervalSeconds float64) float64 {
+	return float64(counterDelta(v1, v2)) / intervalSeconds
+}
+
+// counterDelta returns the increase of a counter from v1 to v2, or zero if
+// the counter goes backward, for example, on a wraparound or a reset.
+func counterDelta(v1, v2 uint64) uint64 {
+	if v2 < v1 {
+		return 0
+	}
+	return v2 - v1
+}
@@ -1,6 +1,7 @@
 package sysstat
 
 import (
+	"os"
 	"syscall"
 	"unsafe"
 )
@@ -9,6 +10,7 @@ const _atFdcwd = -0x64
 
 var _zero uintptr
 
+// open opens the file at path, which must be terminated with NUL.
 func open(path []byte, mode int, perm uint32) (fd int, err error) {
 	return openat(_atFdcwd, path, mode|syscall.O_LARGEFILE, perm)
 }
@@ -27,3 +29,87 @@ func openat(dirfd int, path []byte, flags int, mode uint32) (fd int, err error)
 	}
 	return
 }
+
+// initialReadBufSize is the initial size of the buffer used by readFile.
+const initialReadBufSize = 8192
+
+// readFile reads the whole content of the file at path, which must be
+// terminated with NUL, into *buf and returns the read content.
+// *buf is grown when the content does not fit in it and the grown buffer
+// is kept in *buf, so subsequent reads of the file whose size is about
+// the same do not allocate memory.
+func readFile(path []byte, buf *[]byte) ([]byte, error) {
+	fd, err := open(path, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+
+	b := *buf
+	if len(b) == 0 {
+		b = make([]byte, initialReadBufSize)
+	}
+	n := 0
+	for {
+		if n == len(b) {
+			newBuf := make([]byte, 2*len(b))
+			copy(newBuf, b)
+			b = newBuf
+		}
+		m, err := syscall.Read(fd, b[n:])
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			*buf = b
+			return nil, err
+		}
+		if m == 0 {
+			break
+		}
+		n += m
+	}
+	*buf = b
+	return b[:n], nil
+}
+
+// readOptionalFile is the same as readFile except that it returns nil
+// without an error when the file does not exist.
+func readOptionalFile(path []byte, buf *[]byte) ([]byte, error) {
+	b, err := readFile(path, buf)
+	if err == syscall.ENOENT {
+		return nil, nil
+	}
+	return b, err
+}
+
+// pollFd is struct pollfd for ppoll(2).
+type pollFd struct {
+	fd      int32
+	events  int16
+	revents int16
+}
+
+const (
+	pollPri = 0x2
+	pollErr = 0x8
+)
+
+// pollPriority reports whether an exceptional condition is pending on fd
+// without blocking. The kernel reports a change of the mount table with
+// POLLPRI and POLLERR on /proc/self/mountinfo.
+func pollPriority(fd int) (bool, error) {
+	fds := [1]pollFd{{fd: int32(fd), events: pollPri}}
+	var timeout syscall.Timespec
+	for {
+		n, _, e1 := syscall.Syscall6(syscall.SYS_PPOLL, uintptr(unsafe.Pointer(&fds[0])), 1,
+			uintptr(unsafe.Pointer(&timeout)), 0, 0, 0)
+		if e1 == syscall.EINTR {
+			continue
+		}
+		if e1 != 0 {
+			return false, e1
+		}
+		return n > 0 && fds[0].revents&(pollPri|pollErr) != 0, nil
+	}
+}
@@ -0,0 +1,40 @@
+package sysstat
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadFile(t *testing.T) {
+	content := bytes.Repeat([]byte("veth0123456: 1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16\n"), 1000)
+	path := filepath.Join(t.TempDir(), "dev")
+	err := os.WriteFile(path, content, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf []byte
+	cpath := cPath(path)
+	got, err := readFile(cpath, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("content unmatch, got %d bytes, want %d bytes", len(got), len(content))
+	}
+	if len(buf) < len(content) {
+		t.Errorf("buffer not grown, got %d bytes, want at least %d bytes", len(buf), len(content))
+	}
+
+	allocs := testing.AllocsPerRun(10, func() {
+		_, err = readFile(cpath, &buf)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allocs != 0 {
+		t.Errorf("allocs unmatch, got %g, want 0", allocs)
+	}
+}
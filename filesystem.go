@@ -1,50 +1,408 @@
 package sysstat
 
 import (
+	"errors"
+	"os"
 	"syscall"
+	"time"
 	"unsafe"
+
+	"github.com/hnakamur/ascii"
 )
 
 // FileSystemStat is a statistics for a filesystem.
 type FileSystemStat struct {
+	// MountPoint is the mount point, or the path passed to
+	// NewFileSystemStatReader.
+	MountPoint string
+	// Device and FSType are the mount source like "/dev/sda1" and the
+	// filesystem type like "ext4". They are set only for mounts discovered
+	// by a reader created with NewFileSystemStatReaderWithFilter.
+	Device string
+	FSType string
+
 	BlockSize       uint64
 	TotalBlocks     uint64
 	FreeBlocks      uint64
 	AvailableBlocks uint64
 	TotalINodes     uint64
 	FreeINodes      uint64
+
+	// UsedBytes is the used space, that is, (TotalBlocks - FreeBlocks) * BlockSize.
+	UsedBytes uint64
+	// UsedPercent is the percentage of the used space to the space
+	// available to non-root users plus the used space, which is the same
+	// as Use% of df. Blocks reserved for root are not counted.
+	UsedPercent float64
+	// INodesUsedPercent is the percentage of the used inodes to TotalINodes.
+	// It is zero for filesystems without the inode limit like btrfs.
+	INodesUsedPercent float64
+
+	// FillBytesPerSec is the estimated rate of decrease of the available
+	// space, which is negative if the available space is increasing.
+	// TimeUntilFull is the estimated time until no space is available at
+	// FillBytesPerSec, which is zero if FillBytesPerSec is not positive.
+	// They are set only for a reader created with WithFileSystemForecast,
+	// and are zero until the second read.
+	FillBytesPerSec float64
+	TimeUntilFull   time.Duration
 }
 
-// FileSystemStatReader is used for reading uptime.
+// DefaultMountRediscoveryInterval is the default interval of rediscovering
+// mounts for FileSystemStatReader created with NewFileSystemStatReaderWithFilter.
+const DefaultMountRediscoveryInterval = time.Minute
+
+// WithMountRediscoveryInterval sets the interval of rediscovering mounts
+// in /proc/self/mountinfo for FileSystemStatReader created with
+// NewFileSystemStatReaderWithFilter. If d is zero or negative, mounts are
+// rediscovered on every read. Mounts are also rediscovered on the next read
+// after the kernel reports a change of the mount table.
+func WithMountRediscoveryInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.mountRediscoveryInterval = d
+	}
+}
+
+// FileSystemStatReader is used for reading filesystem statistics.
 // FileSystemStatReader is not safe for concurrent accesses.
 type FileSystemStatReader struct {
-	paths [][]byte
+	targets       []fsTarget
+	mountPoints   []string
+	historySize   int
+	statfsTimeout time.Duration
+	timer         *time.Timer
+
+	// The following fields are used only for discovered mounts.
+	filter              *MountFilter
+	mounts              []trackedMount
+	mountInfoPath       []byte
+	buf                 []byte
+	unescapeBuf         []byte
+	rediscoveryInterval time.Duration
+	discoveredAt        time.Time
+	// mountInfoFD is the file descriptor of /proc/self/mountinfo polled
+	// for changes of the mount table, or -1 if it is not open.
+	mountInfoFD int
+}
+
+// errReadWithFilter is returned by Read of a reader created with
+// NewFileSystemStatReaderWithFilter.
+var errReadWithFilter = errors.New("use ReadAll instead of Read for a reader with a mount filter")
+
+// fsTarget is a filesystem whose statistics are read.
+type fsTarget struct {
+	path    []byte
+	history *fsHistory
+	// worker is used only if the statfs timeout is set.
+	worker *statfsWorker
+}
+
+type trackedMount struct {
+	fsTarget
+	major      uint32
+	minor      uint32
+	mountPoint string
+	device     string
+	fsType     string
+	// rootIsTop is true if the root of the mount is the top directory of
+	// the filesystem, that is, the mount is not a bind mount of a subdirectory.
+	rootIsTop bool
+	// selected is true if the mount is selected by the filter.
+	selected bool
+	// seen is true if the mount is found in the current discovery.
+	seen bool
+	// duplicate is true if another mount of the same device is reported.
+	duplicate bool
 }
 
 // NewFileSystemStatReader creates a FileSystemStatReader
-func NewFileSystemStatReader(paths []string) *FileSystemStatReader {
-	bPaths := make([][]byte, len(paths))
+func NewFileSystemStatReader(paths []string, opts ...Option) *FileSystemStatReader {
+	o := newOptions(opts)
+	r := &FileSystemStatReader{
+		targets:       make([]fsTarget, len(paths)),
+		mountPoints:   append([]string(nil), paths...),
+		historySize:   o.fsHistorySize,
+		statfsTimeout: o.statfsTimeout,
+		mountInfoFD:   -1,
+	}
 	for i, path := range paths {
-		bPaths[i] = []byte(path)
+		r.targets[i] = r.newTarget(path)
 	}
-	return &FileSystemStatReader{paths: bPaths}
+	return r
 }
 
-// Read reads the uptime
+// NewFileSystemStatReaderWithFilter creates a FileSystemStatReader which
+// tracks mounts in /proc/self/mountinfo selected by filter.
+// Mounts of the same device like bind mounts are reported only once.
+// Mounts are rediscovered in ReadAll at the interval set with
+// WithMountRediscoveryInterval or after a change of the mount table, so newly
+// mounted filesystems are picked up and unmounted ones are dropped before
+// statfs returns statistics of the parent filesystem for their mount points.
+// Close must be called to close /proc/self/mountinfo opened for polling.
+func NewFileSystemStatReaderWithFilter(filter MountFilter, opts ...Option) (*FileSystemStatReader, error) {
+	err := filter.validate()
+	if err != nil {
+		return nil, err
+	}
+	o := newOptions(opts)
+	r := &FileSystemStatReader{
+		filter:              filter.clone(),
+		mountInfoPath:       o.procPath("self", "mountinfo"),
+		rediscoveryInterval: o.mountRediscoveryInterval,
+		historySize:         o.fsHistorySize,
+		statfsTimeout:       o.statfsTimeout,
+	}
+	// Open before the discovery so that changes after it are reported.
+	r.mountInfoFD, err = open(r.mountInfoPath, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	err = r.discover()
+	if err != nil {
+		syscall.Close(r.mountInfoFD)
+		return nil, err
+	}
+	return r, nil
+}
+
+// Read reads statistics of the filesystems for the paths passed to
+// NewFileSystemStatReader.
+// If statfs of some filesystems times out, the statistics of the other
+// filesystems are read and ErrStatfsTimeout is returned.
+// Read returns an error for a reader created with
+// NewFileSystemStatReaderWithFilter, for which ReadAll must be used.
 func (r *FileSystemStatReader) Read(stats []FileSystemStat) error {
-	for i, path := range r.paths {
-		err := r.read(path, &stats[i])
+	if r.filter != nil {
+		return errReadWithFilter
+	}
+	now := time.Now()
+	var timeoutErr error
+	for i := range r.targets {
+		stats[i] = FileSystemStat{MountPoint: r.mountPoints[i]}
+		err := r.read(&r.targets[i], &stats[i], now)
+		if err == ErrStatfsTimeout {
+			timeoutErr = err
+		} else if err != nil {
+			return err
+		}
+	}
+	return timeoutErr
+}
+
+// ReadAll appends statistics of all tracked filesystems to stats[:0] and
+// returns the extended slice. For a reader created with
+// NewFileSystemStatReader, the statistics are in the order of the paths.
+// If statfs of some filesystems times out, the statistics of the timed out
+// filesystems other than MountPoint, Device and FSType are zero, and
+// ErrStatfsTimeout is returned after reading the other filesystems.
+// Discovered mounts for which statfs fails with other errors, for example,
+// EACCES for a FUSE mount of another user, are skipped like df does.
+func (r *FileSystemStatReader) ReadAll(stats []FileSystemStat) ([]FileSystemStat, error) {
+	stats = stats[:0]
+	now := time.Now()
+	var timeoutErr error
+	if r.filter == nil {
+		for i := range r.targets {
+			stats = append(stats, FileSystemStat{MountPoint: r.mountPoints[i]})
+			err := r.read(&r.targets[i], &stats[i], now)
+			if err == ErrStatfsTimeout {
+				timeoutErr = err
+			} else if err != nil {
+				return stats, err
+			}
+		}
+		return stats, timeoutErr
+	}
+
+	changed, err := pollPriority(r.mountInfoFD)
+	if err != nil {
+		return stats, err
+	}
+	if changed || now.Sub(r.discoveredAt) >= r.rediscoveryInterval {
+		err := r.discover()
+		if err != nil {
+			return stats, err
+		}
+	}
+	for i := 0; i < len(r.mounts); i++ {
+		m := &r.mounts[i]
+		if !m.selected || m.duplicate {
+			continue
+		}
+		stats = append(stats, FileSystemStat{
+			MountPoint: m.mountPoint,
+			Device:     m.device,
+			FSType:     m.fsType,
+		})
+		err := r.read(&m.fsTarget, &stats[len(stats)-1], now)
+		if err == ErrStatfsTimeout {
+			timeoutErr = err
+		} else if err != nil {
+			stats = stats[:len(stats)-1]
+		}
+	}
+	return stats, timeoutErr
+}
+
+// Close stops the goroutines for statfs with the timeout set with
+// WithStatfsTimeout and closes /proc/self/mountinfo opened for polling.
+// Goroutines blocked in statfs exit after statfs returns.
+// The reader must not be used after Close.
+func (r *FileSystemStatReader) Close() error {
+	if r.mountInfoFD != -1 {
+		syscall.Close(r.mountInfoFD)
+		r.mountInfoFD = -1
+	}
+	for i := range r.targets {
+		r.targets[i].worker.close()
+		r.targets[i].worker = nil
+	}
+	for i := range r.mounts {
+		r.mounts[i].worker.close()
+		r.mounts[i].worker = nil
+	}
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	return nil
+}
+
+func (r *FileSystemStatReader) newTarget(path string) fsTarget {
+	t := fsTarget{
+		path:    cPath(path),
+		history: newFSHistory(r.historySize),
+	}
+	if r.statfsTimeout > 0 {
+		t.worker = newStatfsWorker(t.path)
+	}
+	return t
+}
+
+// discover parses /proc/self/mountinfo and updates the tracked mounts.
+func (r *FileSystemStatReader) discover() error {
+	buf, err := readFile(r.mountInfoPath, &r.buf)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(r.mounts); i++ {
+		r.mounts[i].seen = false
+	}
+	var info mountInfo
+	hint := 0
+	for len(buf) > 0 {
+		line := ascii.GetLine(buf)
+		buf = buf[len(line):]
+		err := parseMountInfoLine(line, &info, &r.unescapeBuf)
 		if err != nil {
 			return err
 		}
+
+		i := r.indexOfMount(&info, hint)
+		if i == -1 {
+			mountPoint := string(info.mountPoint)
+			fsType := string(info.fsType)
+			selected := r.filter.Match(mountPoint, fsType)
+			var target fsTarget
+			if selected {
+				target = r.newTarget(mountPoint)
+			}
+			r.mounts = append(r.mounts, trackedMount{
+				fsTarget:   target,
+				major:      info.major,
+				minor:      info.minor,
+				mountPoint: mountPoint,
+				device:     string(info.source),
+				fsType:     fsType,
+				rootIsTop:  len(info.root) == 1 && info.root[0] == '/',
+				selected:   selected,
+			})
+			i = len(r.mounts) - 1
+		}
+		hint = i + 1
+		r.mounts[i].seen = true
 	}
+	r.removeUnseen()
+	r.markDuplicates()
+	r.discoveredAt = time.Now()
 	return nil
 }
 
-// Read reads the uptime
-func (r *FileSystemStatReader) read(path []byte, s *FileSystemStat) error {
+// indexOfMount returns the index of the mount in r.mounts, or -1 if not found.
+// Mounts in r.mounts are usually in the same order as in mountinfo,
+// so the search starts at hint.
+func (r *FileSystemStatReader) indexOfMount(info *mountInfo, hint int) int {
+	for i := hint; i < len(r.mounts); i++ {
+		if r.mounts[i].equals(info) {
+			return i
+		}
+	}
+	for i := 0; i < hint && i < len(r.mounts); i++ {
+		if r.mounts[i].equals(info) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *trackedMount) equals(info *mountInfo) bool {
+	return m.major == info.major && m.minor == info.minor &&
+		string(info.mountPoint) == m.mountPoint &&
+		string(info.fsType) == m.fsType &&
+		string(info.source) == m.device
+}
+
+func (r *FileSystemStatReader) removeUnseen() {
+	j := 0
+	for i := 0; i < len(r.mounts); i++ {
+		if r.mounts[i].seen {
+			r.mounts[j] = r.mounts[i]
+			j++
+		} else {
+			r.mounts[i].worker.close()
+		}
+	}
+	for i := j; i < len(r.mounts); i++ {
+		r.mounts[i] = trackedMount{}
+	}
+	r.mounts = r.mounts[:j]
+}
+
+// markDuplicates marks selected mounts of the same device except one as
+// duplicates. A mount of the top directory of the filesystem is preferred
+// to bind mounts of subdirectories, and then the first one is preferred.
+func (r *FileSystemStatReader) markDuplicates() {
+	for i := 0; i < len(r.mounts); i++ {
+		r.mounts[i].duplicate = false
+	}
+	for i := 0; i < len(r.mounts); i++ {
+		m := &r.mounts[i]
+		if !m.selected || m.duplicate {
+			continue
+		}
+		for j := i + 1; j < len(r.mounts); j++ {
+			n := &r.mounts[j]
+			if !n.selected || n.duplicate || n.major != m.major || n.minor != m.minor {
+				continue
+			}
+			if n.rootIsTop && !m.rootIsTop {
+				m.duplicate = true
+				break
+			}
+			n.duplicate = true
+		}
+	}
+}
+
+// read reads statistics of the filesystem of t into s. If the forecast is
+// enabled, the sample taken at now is added to the history of t.
+func (r *FileSystemStatReader) read(t *fsTarget, s *FileSystemStat, now time.Time) error {
 	var buf syscall.Statfs_t
-	err := statfs(path, &buf)
+	var err error
+	if t.worker != nil {
+		err = t.worker.statfs(&buf, r.statfsTimeout, &r.timer)
+	} else {
+		err = statfs(t.path, &buf)
+	}
 	if err != nil {
 		return err
 	}
@@ -55,9 +413,28 @@ func (r *FileSystemStatReader) read(path []byte, s *FileSystemStat) error {
 	s.AvailableBlocks = buf.Bavail
 	s.TotalINodes = buf.Files
 	s.FreeINodes = buf.Ffree
+	calcFileSystemUsage(s)
+	if t.history != nil {
+		t.history.forecast(s, now)
+	}
 	return nil
 }
 
+// calcFileSystemUsage sets the used space and percentages of s in the same
+// way as df.
+func calcFileSystemUsage(s *FileSystemStat) {
+	used := s.TotalBlocks - s.FreeBlocks
+	s.UsedBytes = used * s.BlockSize
+	s.UsedPercent = 0
+	if total := used + s.AvailableBlocks; total > 0 {
+		s.UsedPercent = float64(used) / float64(total) * 100
+	}
+	s.INodesUsedPercent = 0
+	if s.TotalINodes > 0 {
+		s.INodesUsedPercent = float64(s.TotalINodes-s.FreeINodes) / float64(s.TotalINodes) * 100
+	}
+}
+
 func statfs(path []byte, buf *syscall.Statfs_t) (err error) {
 	var _p0 unsafe.Pointer
 	if len(path) > 0 {
@@ -1,7 +1,13 @@
 package sysstat
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func TestFileSystemStatReader_Read(t *testing.T) {
@@ -25,3 +31,218 @@ func BenchmarkFileSystemStatReader_Read(b *testing.B) {
 		}
 	}
 }
+
+func TestFileSystemStatReader_ReadAll(t *testing.T) {
+	procRoot := t.TempDir()
+	dir := t.TempDir()
+	err := os.Mkdir(filepath.Join(dir, "a b"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	escaped := strings.ReplaceAll(dir, " ", `\040`) + `/a\040b`
+	mountInfo := "22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw\n" +
+		"23 22 0:5 / /proc rw,nosuid shared:12 - proc proc rw\n" +
+		"24 22 8:2 / " + escaped + " rw,relatime shared:2 - xfs /dev/sdb1 rw\n" +
+		"25 22 8:1 /srv " + dir + " rw,relatime shared:1 - ext4 /dev/sda1 rw\n"
+	writeFiles(t, filepath.Join(procRoot, "self"), map[string]string{"mountinfo": mountInfo})
+
+	r, err := NewFileSystemStatReaderWithFilter(DefaultMountFilter(), WithProcRoot(procRoot),
+		WithMountRediscoveryInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := r.ReadAll(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("number of filesystems unmatch, got %d, want %d, stats=%+v", len(stats), 2, stats)
+	}
+	if stats[0].MountPoint != "/" || stats[0].Device != "/dev/sda1" || stats[0].FSType != "ext4" || stats[0].TotalBlocks == 0 {
+		t.Errorf("stats[0] unmatch, got %+v", stats[0])
+	}
+	if want := filepath.Join(dir, "a b"); stats[1].MountPoint != want || stats[1].FSType != "xfs" {
+		t.Errorf("stats[1] unmatch, got %+v, want mount point %s", stats[1], want)
+	}
+
+	// A new mount is picked up, and an unmounted one is dropped.
+	mountInfo = "22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw\n" +
+		"26 22 8:3 / " + dir + " rw,relatime shared:3 - ext4 /dev/sdc1 rw\n"
+	writeFiles(t, filepath.Join(procRoot, "self"), map[string]string{"mountinfo": mountInfo})
+	stats, err = r.ReadAll(stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 || stats[1].MountPoint != dir || stats[1].Device != "/dev/sdc1" {
+		t.Errorf("stats unmatch after rediscovery, got %+v", stats)
+	}
+}
+
+func TestFileSystemStatReader_ReadAllSkipsFailedMount(t *testing.T) {
+	procRoot := t.TempDir()
+	missing := filepath.Join(t.TempDir(), "missing")
+	mountInfo := "22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw\n" +
+		"24 22 8:2 / " + missing + " rw,relatime shared:2 - xfs /dev/sdb1 rw\n"
+	writeFiles(t, filepath.Join(procRoot, "self"), map[string]string{"mountinfo": mountInfo})
+
+	r, err := NewFileSystemStatReaderWithFilter(DefaultMountFilter(), WithProcRoot(procRoot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	stats, err := r.ReadAll(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].MountPoint != "/" {
+		t.Errorf("stats unmatch, got %+v", stats)
+	}
+
+	err = r.Read(make([]FileSystemStat, 1))
+	if err != errReadWithFilter {
+		t.Errorf("error unmatch, got %v, want %v", err, errReadWithFilter)
+	}
+}
+
+func TestPollPriority(t *testing.T) {
+	fd, err := open(cPath("/proc/self/mountinfo"), os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fd)
+	// No change of the mount table is reported right after opening.
+	changed, err := pollPriority(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed {
+		t.Error("mount table change reported right after opening")
+	}
+}
+
+func BenchmarkFileSystemStatReader_ReadAll(b *testing.B) {
+	r, err := NewFileSystemStatReaderWithFilter(DefaultMountFilter(), WithMountRediscoveryInterval(0))
+	if err != nil {
+		b.Fatal(err)
+	}
+	stats, err := r.ReadAll(nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		stats, err = r.ReadAll(stats)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCalcFileSystemUsage(t *testing.T) {
+	// 5% of the blocks are reserved for root.
+	s := FileSystemStat{
+		BlockSize:       4096,
+		TotalBlocks:     1000,
+		FreeBlocks:      400,
+		AvailableBlocks: 350,
+		TotalINodes:     200,
+		FreeINodes:      150,
+	}
+	calcFileSystemUsage(&s)
+	if want := uint64(600 * 4096); s.UsedBytes != want {
+		t.Errorf("UsedBytes unmatch, got %d, want %d", s.UsedBytes, want)
+	}
+	if want := 600.0 / 950 * 100; s.UsedPercent != want {
+		t.Errorf("UsedPercent unmatch, got %g, want %g", s.UsedPercent, want)
+	}
+	if want := 25.0; s.INodesUsedPercent != want {
+		t.Errorf("INodesUsedPercent unmatch, got %g, want %g", s.INodesUsedPercent, want)
+	}
+
+	s = FileSystemStat{BlockSize: 4096}
+	calcFileSystemUsage(&s)
+	if s.UsedPercent != 0 || s.INodesUsedPercent != 0 {
+		t.Errorf("percentages should be zero for empty filesystem, got %+v", s)
+	}
+}
+
+func TestFileSystemStatReader_StatfsTimeout(t *testing.T) {
+	r := NewFileSystemStatReader([]string{"/", "/"}, WithStatfsTimeout(50*time.Millisecond))
+	defer r.Close()
+	stats := make([]FileSystemStat, 2)
+	err := r.Read(stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats[0].TotalBlocks == 0 {
+		t.Errorf("TotalBlocks should not be zero, got %+v", stats[0])
+	}
+
+	// Block statfs of the second filesystem like an unresponsive NFS server.
+	unblock := make(chan struct{})
+	var calls int32
+	w := r.targets[1].worker
+	w.statfsFunc = func(path []byte, buf *syscall.Statfs_t) error {
+		atomic.AddInt32(&calls, 1)
+		<-unblock
+		return statfs(path, buf)
+	}
+	err = r.Read(stats)
+	if err != ErrStatfsTimeout {
+		t.Errorf("error unmatch, got %v, want %v", err, ErrStatfsTimeout)
+	}
+	if stats[0].TotalBlocks == 0 || stats[1].TotalBlocks != 0 || stats[1].MountPoint != "/" {
+		t.Errorf("stats unmatch after timeout, got %+v", stats)
+	}
+
+	// statfs is not called again while the previous call is blocked.
+	start := time.Now()
+	err = r.Read(stats)
+	if err != ErrStatfsTimeout {
+		t.Errorf("error unmatch, got %v, want %v", err, ErrStatfsTimeout)
+	}
+	if elapsed := time.Since(start); elapsed >= 50*time.Millisecond {
+		t.Errorf("read while blocked should not wait for the timeout, took %s", elapsed)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("number of statfs calls unmatch, got %d, want %d", got, 1)
+	}
+
+	// Once the blocked statfs returns, its result is used for the next read
+	// without calling statfs again.
+	close(unblock)
+	for len(w.res) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	err = r.Read(stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats[1].TotalBlocks == 0 {
+		t.Errorf("TotalBlocks should not be zero for the late result, got %+v", stats[1])
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("number of statfs calls unmatch, got %d, want %d", got, 1)
+	}
+
+	err = r.Read(stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("number of statfs calls unmatch, got %d, want %d", got, 2)
+	}
+}
+
+func BenchmarkFileSystemStatReader_ReadWithTimeout(b *testing.B) {
+	paths := []string{"/"}
+	r := NewFileSystemStatReader(paths, WithStatfsTimeout(time.Second))
+	defer r.Close()
+	stats := make([]FileSystemStat, len(paths))
+	for i := 0; i < b.N; i++ {
+		err := r.Read(stats)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package sysstat
+
+import (
+	"math"
+	"time"
+)
+
+// WithFileSystemForecast makes FileSystemStatReader keep the available
+// space of the last n reads for each filesystem and estimate
+// FillBytesPerSec and TimeUntilFull of FileSystemStat with linear
+// regression, so the forecast covers n times the read interval.
+// The forecast is disabled if n is less than 2, which is the default.
+func WithFileSystemForecast(n int) Option {
+	return func(o *options) {
+		o.fsHistorySize = n
+	}
+}
+
+// fsHistory is a ring buffer of samples of the available space of
+// a filesystem.
+type fsHistory struct {
+	times  []time.Time
+	avails []float64
+	// next is the index where the next sample is stored.
+	next int
+	// count is the number of samples, which is saturated at len(times).
+	count int
+}
+
+func newFSHistory(size int) *fsHistory {
+	if size < 2 {
+		return nil
+	}
+	return &fsHistory{
+		times:  make([]time.Time, size),
+		avails: make([]float64, size),
+	}
+}
+
+func (h *fsHistory) add(t time.Time, availBytes uint64) {
+	h.times[h.next] = t
+	h.avails[h.next] = float64(availBytes)
+	h.next = (h.next + 1) % len(h.times)
+	if h.count < len(h.times) {
+		h.count++
+	}
+}
+
+// fillRate returns the rate of decrease of the available space in bytes
+// per second, which is the negated slope of the least squares regression
+// line of the samples. It returns 0 if there are less than two samples or
+// all the samples are taken at the same time.
+func (h *fsHistory) fillRate() float64 {
+	if h.count < 2 {
+		return 0
+	}
+	oldest := (h.next - h.count + len(h.times)) % len(h.times)
+	base := h.times[oldest]
+	// Times are relative to the oldest sample to keep the precision.
+	var sumX, sumY float64
+	for i := 0; i < h.count; i++ {
+		j := (oldest + i) % len(h.times)
+		sumX += h.times[j].Sub(base).Seconds()
+		sumY += h.avails[j]
+	}
+	n := float64(h.count)
+	meanX, meanY := sumX/n, sumY/n
+	var sxx, sxy float64
+	for i := 0; i < h.count; i++ {
+		j := (oldest + i) % len(h.times)
+		dx := h.times[j].Sub(base).Seconds() - meanX
+		sxx += dx * dx
+		sxy += dx * (h.avails[j] - meanY)
+	}
+	if sxx == 0 {
+		return 0
+	}
+	return -sxy / sxx
+}
+
+// forecast sets FillBytesPerSec and TimeUntilFull of s after adding
+// a sample of s taken at t.
+func (h *fsHistory) forecast(s *FileSystemStat, t time.Time) {
+	avail := s.AvailableBlocks * s.BlockSize
+	h.add(t, avail)
+	s.FillBytesPerSec = h.fillRate()
+	s.TimeUntilFull = 0
+	if s.FillBytesPerSec > 0 {
+		d := float64(avail) / s.FillBytesPerSec * float64(time.Second)
+		if d > math.MaxInt64 {
+			d = math.MaxInt64
+		}
+		s.TimeUntilFull = time.Duration(d)
+	}
+}
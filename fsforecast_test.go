@@ -0,0 +1,52 @@
+package sysstat
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestFSHistory_Forecast(t *testing.T) {
+	const blockSize = 4096
+	base := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	h := newFSHistory(3)
+	s := FileSystemStat{BlockSize: blockSize}
+
+	// The available space decreases by 10 blocks per second, except for
+	// a sample which falls out of the window.
+	samples := []struct {
+		elapsed   time.Duration
+		avail     uint64
+		wantRate  float64
+		wantUntil time.Duration
+	}{
+		{0, 5000, 0, 0},
+		{time.Second, 1000, 4000 * blockSize, 250 * time.Millisecond},
+		{2 * time.Second, 980, 2010 * blockSize, 487562189},
+		{3 * time.Second, 970, 15 * blockSize, 64666666666},
+		{4 * time.Second, 960, 10 * blockSize, 96 * time.Second},
+	}
+	for i, sample := range samples {
+		s.AvailableBlocks = sample.avail
+		h.forecast(&s, base.Add(sample.elapsed))
+		if math.Abs(s.FillBytesPerSec-sample.wantRate) > 1e-6 {
+			t.Errorf("FillBytesPerSec unmatch for sample %d, got %g, want %g", i, s.FillBytesPerSec, sample.wantRate)
+		}
+		if diff := s.TimeUntilFull - sample.wantUntil; diff < -time.Microsecond || diff > time.Microsecond {
+			t.Errorf("TimeUntilFull unmatch for sample %d, got %s, want %s", i, s.TimeUntilFull, sample.wantUntil)
+		}
+	}
+
+	// The forecast is cleared if the available space is increasing.
+	s.AvailableBlocks = 2000
+	h.forecast(&s, base.Add(5*time.Second))
+	if s.FillBytesPerSec >= 0 || s.TimeUntilFull != 0 {
+		t.Errorf("forecast unmatch for increasing space, got rate %g, until %s", s.FillBytesPerSec, s.TimeUntilFull)
+	}
+}
+
+func TestNewFSHistory(t *testing.T) {
+	if h := newFSHistory(1); h != nil {
+		t.Errorf("history should be disabled for size 1, got %+v", h)
+	}
+}
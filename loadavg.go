@@ -15,17 +15,19 @@ type LoadAvg struct {
 // LoadAvgReader is a reader for load averages.
 // LoadAvgReader is not safe for concurrent accesses from multiple goroutines.
 type LoadAvgReader struct {
-	buf [80]byte
+	buf  [80]byte
+	path []byte
 }
 
 // NewLoadAvgReader creats a LoadAvgReader.
-func NewLoadAvgReader() *LoadAvgReader {
-	return new(LoadAvgReader)
+func NewLoadAvgReader(opts ...Option) *LoadAvgReader {
+	o := newOptions(opts)
+	return &LoadAvgReader{path: o.procPath("loadavg")}
 }
 
 // Read reads the load average values.
 func (r *LoadAvgReader) Read(a *LoadAvg) error {
-	fd, err := open([]byte("/proc/loadavg"), os.O_RDONLY, 0)
+	fd, err := open(r.path, os.O_RDONLY, 0)
 	if err != nil {
 		return err
 	}
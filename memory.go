@@ -2,15 +2,16 @@ package sysstat
 
 import (
 	"bytes"
-	"os"
-	"syscall"
 
 	"github.com/hnakamur/ascii"
 	"github.com/hnakamur/bytesconv"
 )
 
 // MemoryStat represents memory statistics in bytes.
-// Only interested fields are provided for performance reason.
+// HugePagesTotal, HugePagesFree, HugePagesRsvd and HugePagesSurp are
+// numbers of pages, not bytes.
+// Only fields selected with WithMemoryStatFields are read for performance
+// reason. The fields from MemTotal to SwapFree are read by default.
 type MemoryStat struct {
 	MemTotal     uint64
 	MemFree      uint64
@@ -20,89 +21,234 @@ type MemoryStat struct {
 	SwapCached   uint64
 	SwapTotal    uint64
 	SwapFree     uint64
+
+	Active         uint64
+	Inactive       uint64
+	ActiveAnon     uint64
+	InactiveAnon   uint64
+	ActiveFile     uint64
+	InactiveFile   uint64
+	Unevictable    uint64
+	Mlocked        uint64
+	Dirty          uint64
+	Writeback      uint64
+	AnonPages      uint64
+	Mapped         uint64
+	Shmem          uint64
+	KReclaimable   uint64
+	Slab           uint64
+	SReclaimable   uint64
+	SUnreclaim     uint64
+	KernelStack    uint64
+	PageTables     uint64
+	CommitLimit    uint64
+	CommittedAS    uint64
+	VmallocTotal   uint64
+	VmallocUsed    uint64
+	AnonHugePages  uint64
+	HugePagesTotal uint64
+	HugePagesFree  uint64
+	HugePagesRsvd  uint64
+	HugePagesSurp  uint64
+	Hugepagesize   uint64
+}
+
+// MemoryStatField is a bit set of fields in MemoryStat.
+type MemoryStatField uint64
+
+// Bits of MemoryStatField. Each bit corresponds to the field of the same
+// name in MemoryStat.
+const (
+	MemoryStatMemTotal MemoryStatField = 1 << iota
+	MemoryStatMemFree
+	MemoryStatMemAvailable
+	MemoryStatBuffers
+	MemoryStatCached
+	MemoryStatSwapCached
+	MemoryStatSwapTotal
+	MemoryStatSwapFree
+	MemoryStatActive
+	MemoryStatInactive
+	MemoryStatActiveAnon
+	MemoryStatInactiveAnon
+	MemoryStatActiveFile
+	MemoryStatInactiveFile
+	MemoryStatUnevictable
+	MemoryStatMlocked
+	MemoryStatDirty
+	MemoryStatWriteback
+	MemoryStatAnonPages
+	MemoryStatMapped
+	MemoryStatShmem
+	MemoryStatKReclaimable
+	MemoryStatSlab
+	MemoryStatSReclaimable
+	MemoryStatSUnreclaim
+	MemoryStatKernelStack
+	MemoryStatPageTables
+	MemoryStatCommitLimit
+	MemoryStatCommittedAS
+	MemoryStatVmallocTotal
+	MemoryStatVmallocUsed
+	MemoryStatAnonHugePages
+	MemoryStatHugePagesTotal
+	MemoryStatHugePagesFree
+	MemoryStatHugePagesRsvd
+	MemoryStatHugePagesSurp
+	MemoryStatHugepagesize
+)
+
+// DefaultMemoryStatFields is the fields read by default.
+const DefaultMemoryStatFields = MemoryStatMemTotal | MemoryStatMemFree | MemoryStatMemAvailable |
+	MemoryStatBuffers | MemoryStatCached | MemoryStatSwapCached | MemoryStatSwapTotal | MemoryStatSwapFree
+
+// WithMemoryStatFields sets the fields read by MemoryStatReader.
+// Read returns ErrUnexpectedFormat if any of the fields is missing in
+// /proc/meminfo, so select only fields supported by your kernel.
+// For example, KReclaimable is available on Linux 4.20 or later.
+func WithMemoryStatFields(fields MemoryStatField) Option {
+	return func(o *options) {
+		o.memoryStatFields = fields
+	}
 }
 
 // MemoryStatReader is used for reading memory statistics.
 // MemoryStatReader is not safe for concurrent accesses from multiple goroutines.
 type MemoryStatReader struct {
-	buf [4096]byte
+	buf    []byte
+	path   []byte
+	fields MemoryStatField
 }
 
 // NewMemoryStatReader crates a MemoryStatReader.
-func NewMemoryStatReader() *MemoryStatReader {
-	return new(MemoryStatReader)
+func NewMemoryStatReader(opts ...Option) *MemoryStatReader {
+	o := newOptions(opts)
+	return &MemoryStatReader{
+		path:   o.procPath("meminfo"),
+		fields: o.memoryStatFields,
+	}
 }
 
 // Read reads a statistics about memory.
 func (r *MemoryStatReader) Read(m *MemoryStat) error {
-	fd, err := open([]byte("/proc/meminfo"), os.O_RDONLY, 0)
-	if err != nil {
-		return err
-	}
-	defer syscall.Close(fd)
-
-	n, err := syscall.Read(fd, r.buf[:])
+	buf, err := readFile(r.path, &r.buf)
 	if err != nil {
 		return err
 	}
-	return r.parse(r.buf[:n], m)
+	return r.parse(buf, m)
 }
 
 func (r *MemoryStatReader) parse(buf []byte, m *MemoryStat) error {
-	var err error
-	m.MemTotal, err = r.readValue(&buf, []byte("MemTotal:"))
-	if err != nil {
-		return err
-	}
-	m.MemFree, err = r.readValue(&buf, []byte("MemFree:"))
-	if err != nil {
-		return err
-	}
-	m.MemAvailable, err = r.readValue(&buf, []byte("MemAvailable:"))
-	if err != nil {
-		return err
-	}
-	m.Buffers, err = r.readValue(&buf, []byte("Buffers:"))
-	if err != nil {
-		return err
-	}
-	m.Cached, err = r.readValue(&buf, []byte("Cached:"))
-	if err != nil {
-		return err
-	}
-	m.SwapCached, err = r.readValue(&buf, []byte("SwapCached:"))
-	if err != nil {
-		return err
-	}
-	m.SwapTotal, err = r.readValue(&buf, []byte("SwapTotal:"))
-	if err != nil {
-		return err
-	}
-	m.SwapFree, err = r.readValue(&buf, []byte("SwapFree:"))
-	return err
-}
+	var found MemoryStatField
+	for len(buf) > 0 && found != r.fields {
+		line := ascii.GetLine(buf)
+		buf = buf[len(line):]
+		i := bytes.IndexByte(line, ':')
+		if i == -1 {
+			continue
+		}
+		field, ptr := m.fieldByName(line[:i])
+		if field&r.fields == 0 {
+			continue
+		}
 
-func (r *MemoryStatReader) readValue(buf *[]byte, prefix []byte) (uint64, error) {
-	line := r.findLineByPrefix(*buf, prefix)
-	if line == nil {
-		return 0, ErrUnexpectedFormat
+		start, end := ascii.NthField(line, 1)
+		val, err := bytesconv.ParseUint(line[start:end], 10, 64)
+		if err != nil {
+			return err
+		}
+		start, end = ascii.NthField(line, 2)
+		if bytes.Equal(line[start:end], []byte("kB")) {
+			val *= 1024
+		}
+		*ptr = val
+		found |= field
 	}
-	start, end := ascii.NthField(line, 1)
-	val, err := bytesconv.ParseUint(line[start:end], 10, 64)
-	if err != nil {
-		return 0, err
+	if found != r.fields {
+		return ErrUnexpectedFormat
 	}
-	*buf = (*buf)[len(line):]
-	return val * 1024, nil
+	return nil
 }
 
-func (r *MemoryStatReader) findLineByPrefix(buf, prefix []byte) []byte {
-	for len(buf) > 0 {
-		line := ascii.GetLine(buf)
-		if bytes.HasPrefix(line, prefix) {
-			return line
-		}
-		buf = buf[len(line):]
+// fieldByName returns the field bit and the pointer to the field in m
+// for the name in /proc/meminfo. It returns zero and nil for unknown names.
+func (m *MemoryStat) fieldByName(name []byte) (MemoryStatField, *uint64) {
+	switch string(name) {
+	case "MemTotal":
+		return MemoryStatMemTotal, &m.MemTotal
+	case "MemFree":
+		return MemoryStatMemFree, &m.MemFree
+	case "MemAvailable":
+		return MemoryStatMemAvailable, &m.MemAvailable
+	case "Buffers":
+		return MemoryStatBuffers, &m.Buffers
+	case "Cached":
+		return MemoryStatCached, &m.Cached
+	case "SwapCached":
+		return MemoryStatSwapCached, &m.SwapCached
+	case "SwapTotal":
+		return MemoryStatSwapTotal, &m.SwapTotal
+	case "SwapFree":
+		return MemoryStatSwapFree, &m.SwapFree
+	case "Active":
+		return MemoryStatActive, &m.Active
+	case "Inactive":
+		return MemoryStatInactive, &m.Inactive
+	case "Active(anon)":
+		return MemoryStatActiveAnon, &m.ActiveAnon
+	case "Inactive(anon)":
+		return MemoryStatInactiveAnon, &m.InactiveAnon
+	case "Active(file)":
+		return MemoryStatActiveFile, &m.ActiveFile
+	case "Inactive(file)":
+		return MemoryStatInactiveFile, &m.InactiveFile
+	case "Unevictable":
+		return MemoryStatUnevictable, &m.Unevictable
+	case "Mlocked":
+		return MemoryStatMlocked, &m.Mlocked
+	case "Dirty":
+		return MemoryStatDirty, &m.Dirty
+	case "Writeback":
+		return MemoryStatWriteback, &m.Writeback
+	case "AnonPages":
+		return MemoryStatAnonPages, &m.AnonPages
+	case "Mapped":
+		return MemoryStatMapped, &m.Mapped
+	case "Shmem":
+		return MemoryStatShmem, &m.Shmem
+	case "KReclaimable":
+		return MemoryStatKReclaimable, &m.KReclaimable
+	case "Slab":
+		return MemoryStatSlab, &m.Slab
+	case "SReclaimable":
+		return MemoryStatSReclaimable, &m.SReclaimable
+	case "SUnreclaim":
+		return MemoryStatSUnreclaim, &m.SUnreclaim
+	case "KernelStack":
+		return MemoryStatKernelStack, &m.KernelStack
+	case "PageTables":
+		return MemoryStatPageTables, &m.PageTables
+	case "CommitLimit":
+		return MemoryStatCommitLimit, &m.CommitLimit
+	case "Committed_AS":
+		return MemoryStatCommittedAS, &m.CommittedAS
+	case "VmallocTotal":
+		return MemoryStatVmallocTotal, &m.VmallocTotal
+	case "VmallocUsed":
+		return MemoryStatVmallocUsed, &m.VmallocUsed
+	case "AnonHugePages":
+		return MemoryStatAnonHugePages, &m.AnonHugePages
+	case "HugePages_Total":
+		return MemoryStatHugePagesTotal, &m.HugePagesTotal
+	case "HugePages_Free":
+		return MemoryStatHugePagesFree, &m.HugePagesFree
+	case "HugePages_Rsvd":
+		return MemoryStatHugePagesRsvd, &m.HugePagesRsvd
+	case "HugePages_Surp":
+		return MemoryStatHugePagesSurp, &m.HugePagesSurp
+	case "Hugepagesize":
+		return MemoryStatHugepagesize, &m.Hugepagesize
+	default:
+		return 0, nil
 	}
-	return nil
 }
@@ -1,6 +1,10 @@
 package sysstat
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -145,3 +149,99 @@ func BenchmarkMemoryStatReader_Read(b *testing.B) {
 		}
 	}
 }
+
+func TestMemoryStatReader_parseSelectedFields(t *testing.T) {
+	// The order of lines is shuffled to check that parse does not depend on it.
+	buf := []byte(`Dirty:               692 kB
+MemTotal:       16260508 kB
+Writeback:             0 kB
+Slab:             823872 kB
+SReclaimable:     642376 kB
+SUnreclaim:       181496 kB
+Shmem:           1383156 kB
+Committed_AS:   13751760 kB
+CommitLimit:    24730824 kB
+PageTables:        42036 kB
+AnonPages:       2212660 kB
+Mapped:           461952 kB
+Active(anon):    1811632 kB
+HugePages_Total:      16
+HugePages_Free:       12
+Hugepagesize:       2048 kB
+`)
+	fields := MemoryStatMemTotal | MemoryStatDirty | MemoryStatWriteback | MemoryStatSlab |
+		MemoryStatSReclaimable | MemoryStatSUnreclaim | MemoryStatShmem | MemoryStatCommittedAS |
+		MemoryStatCommitLimit | MemoryStatPageTables | MemoryStatAnonPages | MemoryStatMapped |
+		MemoryStatActiveAnon | MemoryStatHugePagesTotal | MemoryStatHugePagesFree | MemoryStatHugepagesize
+	var m MemoryStat
+	r := NewMemoryStatReader(WithMemoryStatFields(fields))
+	err := r.parse(buf, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name string
+		ptr  *uint64
+		want uint64
+	}{
+		{"MemTotal", &m.MemTotal, 16260508 * 1024},
+		{"Dirty", &m.Dirty, 692 * 1024},
+		{"Writeback", &m.Writeback, 0},
+		{"Slab", &m.Slab, 823872 * 1024},
+		{"SReclaimable", &m.SReclaimable, 642376 * 1024},
+		{"SUnreclaim", &m.SUnreclaim, 181496 * 1024},
+		{"Shmem", &m.Shmem, 1383156 * 1024},
+		{"CommittedAS", &m.CommittedAS, 13751760 * 1024},
+		{"CommitLimit", &m.CommitLimit, 24730824 * 1024},
+		{"PageTables", &m.PageTables, 42036 * 1024},
+		{"AnonPages", &m.AnonPages, 2212660 * 1024},
+		{"Mapped", &m.Mapped, 461952 * 1024},
+		{"ActiveAnon", &m.ActiveAnon, 1811632 * 1024},
+		{"HugePagesTotal", &m.HugePagesTotal, 16},
+		{"HugePagesFree", &m.HugePagesFree, 12},
+		{"Hugepagesize", &m.Hugepagesize, 2048 * 1024},
+		{"MemFree", &m.MemFree, 0},
+	}
+	for _, c := range testCases {
+		if *c.ptr != c.want {
+			t.Errorf("%s unmatch, got %d, want %d", c.name, *c.ptr, c.want)
+		}
+	}
+
+	r = NewMemoryStatReader(WithMemoryStatFields(fields | MemoryStatKReclaimable))
+	err = r.parse(buf, &m)
+	if err != ErrUnexpectedFormat {
+		t.Errorf("error unmatch for missing field, got %v, want %v", err, ErrUnexpectedFormat)
+	}
+}
+
+func TestMemoryStatReader_ReadLargeFile(t *testing.T) {
+	// Fields after the first 4096 bytes must be read, too.
+	var b strings.Builder
+	for i := 0; i < 300; i++ {
+		fmt.Fprintf(&b, "Dummy%d:          %d kB\n", i, i)
+	}
+	b.WriteString(`MemTotal:       16260508 kB
+MemFree:          543220 kB
+MemAvailable:    6990124 kB
+Buffers:         1931976 kB
+Cached:          5597668 kB
+SwapCached:         7168 kB
+SwapTotal:      16600572 kB
+SwapFree:       16582724 kB
+`)
+	procRoot := t.TempDir()
+	err := os.WriteFile(filepath.Join(procRoot, "meminfo"), []byte(b.String()), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m MemoryStat
+	r := NewMemoryStatReader(WithProcRoot(procRoot))
+	err = r.Read(&m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := uint64(16582724 * 1024); m.SwapFree != want {
+		t.Errorf("SwapFree unmatch, got %d, want %d", m.SwapFree, want)
+	}
+}
@@ -0,0 +1,180 @@
+package sysstat
+
+import (
+	"bytes"
+	"path"
+
+	"github.com/hnakamur/ascii"
+)
+
+// DefaultExcludedFSTypes is the filesystem types of pseudo and virtual
+// filesystems, which are excluded by DefaultMountFilter.
+var DefaultExcludedFSTypes = []string{
+	"autofs", "binfmt_misc", "bpf", "cgroup", "cgroup2", "configfs",
+	"debugfs", "devpts", "devtmpfs", "efivarfs", "fuse.lxcfs", "fusectl",
+	"hugetlbfs", "mqueue", "nsfs", "overlay", "proc", "pstore", "ramfs",
+	"rpc_pipefs", "securityfs", "selinuxfs", "squashfs", "sysfs", "tmpfs",
+	"tracefs",
+}
+
+// MountFilter selects mounts by their filesystem types and mount points
+// with glob patterns. The pattern syntax is the same as the one of
+// path.Match, for example "fuse.*" or "/var/lib/docker/*".
+type MountFilter struct {
+	// IncludeFSTypes is a list of patterns for filesystem types to be
+	// tracked. All types are included if IncludeFSTypes is empty.
+	IncludeFSTypes []string
+	// ExcludeFSTypes is a list of patterns for filesystem types not to be
+	// tracked. ExcludeFSTypes takes precedence over IncludeFSTypes.
+	ExcludeFSTypes []string
+	// IncludeMountPoints is a list of patterns for mount points to be
+	// tracked. All mount points are included if IncludeMountPoints is empty.
+	IncludeMountPoints []string
+	// ExcludeMountPoints is a list of patterns for mount points not to be
+	// tracked. ExcludeMountPoints takes precedence over IncludeMountPoints.
+	ExcludeMountPoints []string
+}
+
+// DefaultMountFilter returns a MountFilter which excludes
+// DefaultExcludedFSTypes.
+func DefaultMountFilter() MountFilter {
+	return MountFilter{
+		ExcludeFSTypes: append([]string(nil), DefaultExcludedFSTypes...),
+	}
+}
+
+// Match reports whether the mount is selected by the filter.
+func (f *MountFilter) Match(mountPoint, fsType string) bool {
+	return matchPatterns(f.IncludeFSTypes, f.ExcludeFSTypes, fsType) &&
+		matchPatterns(f.IncludeMountPoints, f.ExcludeMountPoints, mountPoint)
+}
+
+func matchPatterns(include, exclude []string, name string) bool {
+	for _, pattern := range exclude {
+		if matched, _ := path.Match(pattern, name); matched {
+			return false
+		}
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, pattern := range include {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *MountFilter) validate() error {
+	for _, patterns := range [][]string{f.IncludeFSTypes, f.ExcludeFSTypes, f.IncludeMountPoints, f.ExcludeMountPoints} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f *MountFilter) clone() *MountFilter {
+	return &MountFilter{
+		IncludeFSTypes:     append([]string(nil), f.IncludeFSTypes...),
+		ExcludeFSTypes:     append([]string(nil), f.ExcludeFSTypes...),
+		IncludeMountPoints: append([]string(nil), f.IncludeMountPoints...),
+		ExcludeMountPoints: append([]string(nil), f.ExcludeMountPoints...),
+	}
+}
+
+// mountInfo is a line in /proc/self/mountinfo. The slices point into the
+// buffer of the file or the buffer for unescaping.
+type mountInfo struct {
+	major      uint32
+	minor      uint32
+	root       []byte
+	mountPoint []byte
+	fsType     []byte
+	source     []byte
+}
+
+// parseMountInfoLine parses a line in /proc/self/mountinfo like below.
+// The mount point is unescaped into *unescapeBuf.
+// https://man7.org/linux/man-pages/man5/proc_pid_mountinfo.5.html
+//
+//	36 35 98:0 /mnt1 /mnt/parent rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+func parseMountInfoLine(line []byte, m *mountInfo, unescapeBuf *[]byte) error {
+	var fields [6][]byte
+	for i := range fields {
+		start, end := ascii.NextField(line)
+		if start == end {
+			return ErrUnexpectedFormat
+		}
+		fields[i] = line[start:end]
+		line = line[end:]
+	}
+	var err error
+	m.major, m.minor, err = parseMajorMinor(fields[2])
+	if err != nil {
+		return err
+	}
+	m.root = fields[3]
+
+	// Skip optional fields until the separator.
+	for {
+		start, end := ascii.NextField(line)
+		if start == end {
+			return ErrUnexpectedFormat
+		}
+		field := line[start:end]
+		line = line[end:]
+		if len(field) == 1 && field[0] == '-' {
+			break
+		}
+	}
+	start, end := ascii.NextField(line)
+	m.fsType = line[start:end]
+	line = line[end:]
+	start, end = ascii.NextField(line)
+	m.source = line[start:end]
+	if len(m.fsType) == 0 || len(m.source) == 0 {
+		return ErrUnexpectedFormat
+	}
+
+	*unescapeBuf = unescapeOctal((*unescapeBuf)[:0], fields[4])
+	m.mountPoint = *unescapeBuf
+	return nil
+}
+
+// unescapeOctal appends s to dst with octal escapes like \040 for a space
+// decoded, which are used for mount points in /proc/self/mountinfo.
+func unescapeOctal(dst, s []byte) []byte {
+	for {
+		i := bytes.IndexByte(s, '\\')
+		if i == -1 || i+3 >= len(s) {
+			return append(dst, s...)
+		}
+		dst = append(dst, s[:i]...)
+		c, ok := octalByte(s[i+1 : i+4])
+		if !ok {
+			dst = append(dst, '\\')
+			s = s[i+1:]
+			continue
+		}
+		dst = append(dst, c)
+		s = s[i+4:]
+	}
+}
+
+func octalByte(b []byte) (byte, bool) {
+	var v int
+	for _, c := range b {
+		if c < '0' || c > '7' {
+			return 0, false
+		}
+		v = v*8 + int(c-'0')
+	}
+	if v > 0xff {
+		return 0, false
+	}
+	return byte(v), true
+}
@@ -0,0 +1,63 @@
+package sysstat
+
+import "testing"
+
+func TestParseMountInfoLine(t *testing.T) {
+	line := []byte("36 35 98:0 /mnt1 /mnt/my\\040disk rw,noatime master:1 shared:2 - ext3 /dev/root rw,errors=continue\n")
+	var m mountInfo
+	var buf []byte
+	err := parseMountInfoLine(line, &m, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.major != 98 || m.minor != 0 || string(m.root) != "/mnt1" || string(m.mountPoint) != "/mnt/my disk" ||
+		string(m.fsType) != "ext3" || string(m.source) != "/dev/root" {
+		t.Errorf("mount info unmatch, got major=%d, minor=%d, root=%q, mountPoint=%q, fsType=%q, source=%q",
+			m.major, m.minor, m.root, m.mountPoint, m.fsType, m.source)
+	}
+
+	err = parseMountInfoLine([]byte("36 35 98:0 / /mnt rw\n"), &m, &buf)
+	if err != ErrUnexpectedFormat {
+		t.Errorf("error unmatch, got %v, want %v", err, ErrUnexpectedFormat)
+	}
+}
+
+func TestUnescapeOctal(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  string
+	}{
+		{`/mnt/a`, "/mnt/a"},
+		{`/mnt/a\040b`, "/mnt/a b"},
+		{`/mnt/a\011b\012c\134d`, "/mnt/a\tb\nc\\d"},
+		{`/mnt/a\04`, `/mnt/a\04`},
+		{`/mnt/a\x40b`, `/mnt/a\x40b`},
+	}
+	for _, c := range testCases {
+		got := string(unescapeOctal(nil, []byte(c.input)))
+		if got != c.want {
+			t.Errorf("unescaped unmatch for %q, got %q, want %q", c.input, got, c.want)
+		}
+	}
+}
+
+func TestMountFilter_Match(t *testing.T) {
+	f := DefaultMountFilter()
+	f.ExcludeMountPoints = []string{"/var/lib/docker/*"}
+	testCases := []struct {
+		mountPoint string
+		fsType     string
+		want       bool
+	}{
+		{"/", "ext4", true},
+		{"/proc", "proc", false},
+		{"/run", "tmpfs", false},
+		{"/var/lib/docker/overlay2", "xfs", false},
+		{"/data", "xfs", true},
+	}
+	for _, c := range testCases {
+		if got := f.Match(c.mountPoint, c.fsType); got != c.want {
+			t.Errorf("match unmatch for %s %s, got %v, want %v", c.mountPoint, c.fsType, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package sysstat
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/hnakamur/ascii"
+	"github.com/hnakamur/bytesconv"
+)
+
+// NetworkProtocolStat is a statistics about IP, TCP and UDP.
+// The values are similar to ones reported by sar -n IP,EIP,TCP,ETCP,UDP.
+type NetworkProtocolStat struct {
+	// IPInReceivesPerSec is input datagrams received per second (irec/s).
+	IPInReceivesPerSec float64
+	// IPInDeliversPerSec is input datagrams delivered to upper layer
+	// protocols per second (idel/s).
+	IPInDeliversPerSec float64
+	// IPOutRequestsPerSec is datagrams passed to IP for transmission per
+	// second (orq/s).
+	IPOutRequestsPerSec float64
+	// IPInDiscardsPerSec is input datagrams discarded for reasons like lack
+	// of buffer space per second (idisc/s).
+	IPInDiscardsPerSec float64
+	// IPOutDiscardsPerSec is output datagrams discarded for reasons like
+	// lack of buffer space per second (odisc/s).
+	IPOutDiscardsPerSec float64
+	// IPReasmFailsPerSec is reassembly failures per second (asmf/s).
+	IPReasmFailsPerSec float64
+	// IPFragFailsPerSec is datagrams discarded because they needed to be
+	// fragmented but could not be, for example, because of the Don't
+	// Fragment flag, per second (fragf/s).
+	IPFragFailsPerSec float64
+
+	// TCPActiveOpensPerSec is connections initiated by this host per
+	// second (active/s).
+	TCPActiveOpensPerSec float64
+	// TCPPassiveOpensPerSec is connections accepted by this host per
+	// second (passive/s).
+	TCPPassiveOpensPerSec float64
+	// TCPInSegsPerSec is segments received per second (iseg/s).
+	TCPInSegsPerSec float64
+	// TCPOutSegsPerSec is segments sent per second excluding
+	// retransmitted ones (oseg/s).
+	TCPOutSegsPerSec float64
+	// TCPAttemptFailsPerSec is failed connection attempts per second (atmptf/s).
+	TCPAttemptFailsPerSec float64
+	// TCPEstabResetsPerSec is resets of established connections per
+	// second (estres/s).
+	TCPEstabResetsPerSec float64
+	// TCPRetransSegsPerSec is retransmitted segments per second (retrans/s).
+	TCPRetransSegsPerSec float64
+	// TCPRetransPercent is retransmitted segments over sent segments in
+	// percent. It is zero when no segments are sent.
+	TCPRetransPercent float64
+	// TCPInErrsPerSec is segments received in error per second (isegerr/s).
+	TCPInErrsPerSec float64
+	// TCPOutRstsPerSec is segments sent with the RST flag per second (orsts/s).
+	TCPOutRstsPerSec float64
+	// TCPCurrEstab is the number of connections in the ESTABLISHED or
+	// CLOSE-WAIT state.
+	TCPCurrEstab uint64
+	// TCPListenOverflowsPerSec is connections dropped because the accept
+	// queue of a listening socket is full per second.
+	TCPListenOverflowsPerSec float64
+	// TCPListenDropsPerSec is connections dropped by listening sockets for
+	// any reasons including ones counted in TCPListenOverflowsPerSec per second.
+	TCPListenDropsPerSec float64
+
+	// UDPInDatagramsPerSec is datagrams delivered to users per second (idgm/s).
+	UDPInDatagramsPerSec float64
+	// UDPOutDatagramsPerSec is datagrams sent per second (odgm/s).
+	UDPOutDatagramsPerSec float64
+	// UDPNoPortsPerSec is datagrams received for ports without listeners
+	// per second (noport/s).
+	UDPNoPortsPerSec float64
+	// UDPInErrorsPerSec is datagrams which could not be delivered for
+	// reasons other than UDPNoPortsPerSec per second (idgmerr/s).
+	UDPInErrorsPerSec float64
+	// UDPRcvbufErrorsPerSec is datagrams dropped because the receive buffer
+	// is full per second, which are also counted in UDPInErrorsPerSec.
+	UDPRcvbufErrorsPerSec float64
+	// UDPSndbufErrorsPerSec is datagrams dropped because the send buffer
+	// is full per second.
+	UDPSndbufErrorsPerSec float64
+}
+
+// RawNetworkProtocolStat represents cumulative counters in /proc/net/snmp
+// and /proc/net/netstat. The field names are the group and counter names
+// in the files.
+// https://www.kernel.org/doc/html/latest/networking/snmp_counter.html
+type RawNetworkProtocolStat struct {
+	IpInReceives  uint64
+	IpInDelivers  uint64
+	IpOutRequests uint64
+	IpInDiscards  uint64
+	IpOutDiscards uint64
+	IpReasmFails  uint64
+	IpFragFails   uint64
+
+	TcpActiveOpens  uint64
+	TcpPassiveOpens uint64
+	TcpAttemptFails uint64
+	TcpEstabResets  uint64
+	TcpCurrEstab    uint64
+	TcpInSegs       uint64
+	TcpOutSegs      uint64
+	TcpRetransSegs  uint64
+	TcpInErrs       uint64
+	TcpOutRsts      uint64
+
+	TcpExtListenOverflows uint64
+	TcpExtListenDrops     uint64
+
+	UdpInDatagrams  uint64
+	UdpNoPorts      uint64
+	UdpInErrors     uint64
+	UdpOutDatagrams uint64
+	UdpRcvbufErrors uint64
+	UdpSndbufErrors uint64
+}
+
+// NetworkProtocolStatReader reads the IP, TCP and UDP statistics.
+// NetworkProtocolStatReader is not safe for concurrent accesses from
+// multiple goroutines.
+type NetworkProtocolStatReader struct {
+	buf         []byte
+	curr        int
+	stats       [2]RawNetworkProtocolStat
+	prevTime    time.Time
+	snmpPath    []byte
+	netstatPath []byte
+}
+
+// NewNetworkProtocolStatReader creates a NetworkProtocolStatReader and
+// does an initial read.
+func NewNetworkProtocolStatReader(opts ...Option) (*NetworkProtocolStatReader, error) {
+	o := newOptions(opts)
+	r := &NetworkProtocolStatReader{
+		snmpPath:    o.procPath("net", "snmp"),
+		netstatPath: o.procPath("net", "netstat"),
+	}
+	err := r.readNetworkProtocolStat(nil)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Read reads the IP, TCP and UDP statistics.
+func (r *NetworkProtocolStatReader) Read(s *NetworkProtocolStat) error {
+	return r.readNetworkProtocolStat(s)
+}
+
+// ReadRaw reads cumulative counters.
+// The read is also used as the previous sample for the next Read.
+func (r *NetworkProtocolStatReader) ReadRaw(s *RawNetworkProtocolStat) error {
+	err := r.readAndParse()
+	if err != nil {
+		return err
+	}
+	*s = r.stats[r.curr]
+	r.prevTime = time.Now()
+	r.switchCurr()
+	return nil
+}
+
+func (r *NetworkProtocolStatReader) readNetworkProtocolStat(s *NetworkProtocolStat) error {
+	err := r.readAndParse()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if s != nil {
+		intervalSeconds := float64(now.Sub(r.prevTime)) / float64(time.Second)
+		calcNetworkProtocolStat(s, &r.stats[r.curr], &r.stats[1-r.curr], intervalSeconds)
+	}
+	r.prevTime = now
+	r.switchCurr()
+	return nil
+}
+
+func (r *NetworkProtocolStatReader) readAndParse() error {
+	s := &r.stats[r.curr]
+	*s = RawNetworkProtocolStat{}
+	for _, path := range [...][]byte{r.snmpPath, r.netstatPath} {
+		buf, err := readFile(path, &r.buf)
+		if err != nil {
+			return err
+		}
+		err = s.parse(buf)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *NetworkProtocolStatReader) switchCurr() {
+	r.curr = 1 - r.curr
+}
+
+// parse parses /proc/net/snmp or /proc/net/netstat, where each group has
+// a line of counter names followed by a line of values like below.
+//
+//	Tcp: RtoAlgorithm RtoMin RtoMax MaxConn ActiveOpens PassiveOpens ...
+//	Tcp: 1 200 120000 -1 77 57 ...
+func (s *RawNetworkProtocolStat) parse(buf []byte) error {
+	for len(buf) > 0 {
+		names := ascii.GetLine(buf)
+		buf = buf[len(names):]
+		values := ascii.GetLine(buf)
+		buf = buf[len(values):]
+
+		start, end := ascii.NextField(names)
+		group := names[start:end]
+		names = names[end:]
+		start, end = ascii.NextField(values)
+		if !bytes.Equal(values[start:end], group) {
+			return ErrUnexpectedFormat
+		}
+		values = values[end:]
+		if len(group) == 0 || group[len(group)-1] != ':' {
+			return ErrUnexpectedFormat
+		}
+		group = group[:len(group)-1]
+
+		for {
+			start, end := ascii.NextField(names)
+			if start == end {
+				break
+			}
+			name := names[start:end]
+			names = names[end:]
+			start, end = ascii.NextField(values)
+			if start == end {
+				return ErrUnexpectedFormat
+			}
+			value := values[start:end]
+			values = values[end:]
+
+			ptr := s.counterByName(group, name)
+			if ptr == nil {
+				continue
+			}
+			v, err := bytesconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return err
+			}
+			*ptr = v
+		}
+	}
+	return nil
+}
+
+// counterByName returns the pointer to the counter for the group and
+// name, or nil for the counters not interested in.
+func (s *RawNetworkProtocolStat) counterByName(group, name []byte) *uint64 {
+	switch string(group) {
+	case "Ip":
+		switch string(name) {
+		case "InReceives":
+			return &s.IpInReceives
+		case "InDelivers":
+			return &s.IpInDelivers
+		case "OutRequests":
+			return &s.IpOutRequests
+		case "InDiscards":
+			return &s.IpInDiscards
+		case "OutDiscards":
+			return &s.IpOutDiscards
+		case "ReasmFails":
+			return &s.IpReasmFails
+		case "FragFails":
+			return &s.IpFragFails
+		}
+	case "Tcp":
+		switch string(name) {
+		case "ActiveOpens":
+			return &s.TcpActiveOpens
+		case "PassiveOpens":
+			return &s.TcpPassiveOpens
+		case "AttemptFails":
+			return &s.TcpAttemptFails
+		case "EstabResets":
+			return &s.TcpEstabResets
+		case "CurrEstab":
+			return &s.TcpCurrEstab
+		case "InSegs":
+			return &s.TcpInSegs
+		case "OutSegs":
+			return &s.TcpOutSegs
+		case "RetransSegs":
+			return &s.TcpRetransSegs
+		case "InErrs":
+			return &s.TcpInErrs
+		case "OutRsts":
+			return &s.TcpOutRsts
+		}
+	case "TcpExt":
+		switch string(name) {
+		case "ListenOverflows":
+			return &s.TcpExtListenOverflows
+		case "ListenDrops":
+			return &s.TcpExtListenDrops
+		}
+	case "Udp":
+		switch string(name) {
+		case "InDatagrams":
+			return &s.UdpInDatagrams
+		case "NoPorts":
+			return &s.UdpNoPorts
+		case "InErrors":
+			return &s.UdpInErrors
+		case "OutDatagrams":
+			return &s.UdpOutDatagrams
+		case "RcvbufErrors":
+			return &s.UdpRcvbufErrors
+		case "SndbufErrors":
+			return &s.UdpSndbufErrors
+		}
+	}
+	return nil
+}
+
+// CalcNetworkProtocolStat calculates the IP, TCP and UDP statistics between
+// two snapshots prev and curr read elapsed apart, and stores them into s.
+func CalcNetworkProtocolStat(s *NetworkProtocolStat, prev, curr *RawNetworkProtocolStat, elapsed time.Duration) {
+	calcNetworkProtocolStat(s, curr, prev, elapsed.Seconds())
+}
+
+func calcNetworkProtocolStat(s *NetworkProtocolStat, c, p *RawNetworkProtocolStat, intervalSeconds float64) {
+	s.IPInReceivesPerSec = counterRate(p.IpInReceives, c.IpInReceives, intervalSeconds)
+	s.IPInDeliversPerSec = counterRate(p.IpInDelivers, c.IpInDelivers, intervalSeconds)
+	s.IPOutRequestsPerSec = counterRate(p.IpOutRequests, c.IpOutRequests, intervalSeconds)
+	s.IPInDiscardsPerSec = counterRate(p.IpInDiscards, c.IpInDiscards, intervalSeconds)
+	s.IPOutDiscardsPerSec = counterRate(p.IpOutDiscards, c.IpOutDiscards, intervalSeconds)
+	s.IPReasmFailsPerSec = counterRate(p.IpReasmFails, c.IpReasmFails, intervalSeconds)
+	s.IPFragFailsPerSec = counterRate(p.IpFragFails, c.IpFragFails, intervalSeconds)
+
+	s.TCPActiveOpensPerSec = counterRate(p.TcpActiveOpens, c.TcpActiveOpens, intervalSeconds)
+	s.TCPPassiveOpensPerSec = counterRate(p.TcpPassiveOpens, c.TcpPassiveOpens, intervalSeconds)
+	s.TCPInSegsPerSec = counterRate(p.TcpInSegs, c.TcpInSegs, intervalSeconds)
+	s.TCPOutSegsPerSec = counterRate(p.TcpOutSegs, c.TcpOutSegs, intervalSeconds)
+	s.TCPAttemptFailsPerSec = counterRate(p.TcpAttemptFails, c.TcpAttemptFails, intervalSeconds)
+	s.TCPEstabResetsPerSec = counterRate(p.TcpEstabResets, c.TcpEstabResets, intervalSeconds)
+	s.TCPRetransSegsPerSec = counterRate(p.TcpRetransSegs, c.TcpRetransSegs, intervalSeconds)
+	s.TCPInErrsPerSec = counterRate(p.TcpInErrs, c.TcpInErrs, intervalSeconds)
+	s.TCPOutRstsPerSec = counterRate(p.TcpOutRsts, c.TcpOutRsts, intervalSeconds)
+	s.TCPCurrEstab = c.TcpCurrEstab
+	s.TCPListenOverflowsPerSec = counterRate(p.TcpExtListenOverflows, c.TcpExtListenOverflows, intervalSeconds)
+	s.TCPListenDropsPerSec = counterRate(p.TcpExtListenDrops, c.TcpExtListenDrops, intervalSeconds)
+	if s.TCPOutSegsPerSec > 0 {
+		s.TCPRetransPercent = s.TCPRetransSegsPerSec / s.TCPOutSegsPerSec * 100
+	} else {
+		s.TCPRetransPercent = 0
+	}
+
+	s.UDPInDatagramsPerSec = counterRate(p.UdpInDatagrams, c.UdpInDatagrams, intervalSeconds)
+	s.UDPOutDatagramsPerSec = counterRate(p.UdpOutDatagrams, c.UdpOutDatagrams, intervalSeconds)
+	s.UDPNoPortsPerSec = counterRate(p.UdpNoPorts, c.UdpNoPorts, intervalSeconds)
+	s.UDPInErrorsPerSec = counterRate(p.UdpInErrors, c.UdpInErrors, intervalSeconds)
+	s.UDPRcvbufErrorsPerSec = counterRate(p.UdpRcvbufErrors, c.UdpRcvbufErrors, intervalSeconds)
+	s.UDPSndbufErrorsPerSec = counterRate(p.UdpSndbufErrors, c.UdpSndbufErrors, intervalSeconds)
+}
@@ -0,0 +1,115 @@
+package sysstat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRawNetworkProtocolStat_parse(t *testing.T) {
+	snmp := []byte(`Ip: Forwarding DefaultTTL InReceives InHdrErrors InAddrErrors ForwDatagrams InUnknownProtos InDiscards InDelivers OutRequests OutDiscards OutNoRoutes ReasmTimeout ReasmReqds ReasmOKs ReasmFails FragOKs FragFails FragCreates
+Ip: 1 64 6119 0 0 0 0 3 6110 6095 4 0 0 0 0 5 0 6 0
+Icmp: InMsgs InErrors InCsumErrors
+Icmp: 0 0 0
+Tcp: RtoAlgorithm RtoMin RtoMax MaxConn ActiveOpens PassiveOpens AttemptFails EstabResets CurrEstab InSegs OutSegs RetransSegs InErrs OutRsts InCsumErrors
+Tcp: 1 200 120000 -1 77 57 7 45 2 6075 6076 8 9 12 0
+Udp: InDatagrams NoPorts InErrors OutDatagrams RcvbufErrors SndbufErrors InCsumErrors IgnoredMulti MemErrors
+Udp: 44 10 11 43 12 13 0 0 0
+UdpLite: InDatagrams NoPorts InErrors OutDatagrams RcvbufErrors SndbufErrors InCsumErrors IgnoredMulti MemErrors
+UdpLite: 1 1 1 1 1 1 1 1 1
+`)
+	netstat := []byte(`TcpExt: SyncookiesSent SyncookiesRecv ListenOverflows ListenDrops TCPTimeouts
+TcpExt: 0 0 14 15 3
+IpExt: InNoRoutes InTruncatedPkts InOctets OutOctets
+IpExt: 0 0 43687704 43689518
+`)
+	var s RawNetworkProtocolStat
+	for _, buf := range [][]byte{snmp, netstat} {
+		err := s.parse(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	testCases := []struct {
+		name string
+		ptr  *uint64
+		want uint64
+	}{
+		{"IpInReceives", &s.IpInReceives, 6119},
+		{"IpInDelivers", &s.IpInDelivers, 6110},
+		{"IpOutRequests", &s.IpOutRequests, 6095},
+		{"IpInDiscards", &s.IpInDiscards, 3},
+		{"IpOutDiscards", &s.IpOutDiscards, 4},
+		{"IpReasmFails", &s.IpReasmFails, 5},
+		{"IpFragFails", &s.IpFragFails, 6},
+		{"TcpActiveOpens", &s.TcpActiveOpens, 77},
+		{"TcpPassiveOpens", &s.TcpPassiveOpens, 57},
+		{"TcpAttemptFails", &s.TcpAttemptFails, 7},
+		{"TcpEstabResets", &s.TcpEstabResets, 45},
+		{"TcpCurrEstab", &s.TcpCurrEstab, 2},
+		{"TcpInSegs", &s.TcpInSegs, 6075},
+		{"TcpOutSegs", &s.TcpOutSegs, 6076},
+		{"TcpRetransSegs", &s.TcpRetransSegs, 8},
+		{"TcpInErrs", &s.TcpInErrs, 9},
+		{"TcpOutRsts", &s.TcpOutRsts, 12},
+		{"TcpExtListenOverflows", &s.TcpExtListenOverflows, 14},
+		{"TcpExtListenDrops", &s.TcpExtListenDrops, 15},
+		{"UdpInDatagrams", &s.UdpInDatagrams, 44},
+		{"UdpNoPorts", &s.UdpNoPorts, 10},
+		{"UdpInErrors", &s.UdpInErrors, 11},
+		{"UdpOutDatagrams", &s.UdpOutDatagrams, 43},
+		{"UdpRcvbufErrors", &s.UdpRcvbufErrors, 12},
+		{"UdpSndbufErrors", &s.UdpSndbufErrors, 13},
+	}
+	for _, c := range testCases {
+		if *c.ptr != c.want {
+			t.Errorf("%s unmatch, got %d, want %d", c.name, *c.ptr, c.want)
+		}
+	}
+}
+
+func TestRawNetworkProtocolStat_parseMismatch(t *testing.T) {
+	buf := []byte("Tcp: ActiveOpens PassiveOpens\nUdp: 1 2\n")
+	var s RawNetworkProtocolStat
+	err := s.parse(buf)
+	if err != ErrUnexpectedFormat {
+		t.Errorf("error unmatch, got %v, want %v", err, ErrUnexpectedFormat)
+	}
+}
+
+func TestCalcNetworkProtocolStat(t *testing.T) {
+	prev := RawNetworkProtocolStat{TcpOutSegs: 1000, TcpRetransSegs: 10, TcpActiveOpens: 5, UdpRcvbufErrors: 100, TcpCurrEstab: 3}
+	curr := RawNetworkProtocolStat{TcpOutSegs: 3000, TcpRetransSegs: 50, TcpActiveOpens: 25, UdpRcvbufErrors: 104, TcpCurrEstab: 4}
+	var s NetworkProtocolStat
+	CalcNetworkProtocolStat(&s, &prev, &curr, 2*time.Second)
+	testCases := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"TCPOutSegsPerSec", s.TCPOutSegsPerSec, 1000},
+		{"TCPRetransSegsPerSec", s.TCPRetransSegsPerSec, 20},
+		{"TCPRetransPercent", s.TCPRetransPercent, 2},
+		{"TCPActiveOpensPerSec", s.TCPActiveOpensPerSec, 10},
+		{"UDPRcvbufErrorsPerSec", s.UDPRcvbufErrorsPerSec, 2},
+		{"TCPCurrEstab", float64(s.TCPCurrEstab), 4},
+	}
+	for _, c := range testCases {
+		if c.got != c.want {
+			t.Errorf("%s unmatch, got %g, want %g", c.name, c.got, c.want)
+		}
+	}
+}
+
+func BenchmarkNetworkProtocolStatReader_Read(b *testing.B) {
+	var s NetworkProtocolStat
+	r, err := NewNetworkProtocolStatReader()
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < b.N; i++ {
+		err = r.Read(&s)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
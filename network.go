@@ -2,8 +2,6 @@ package sysstat
 
 import (
 	"errors"
-	"os"
-	"syscall"
 	"time"
 
 	"github.com/hnakamur/ascii"
@@ -23,9 +21,11 @@ type NetworkStat struct {
 	TransCollsPerSec   float64
 }
 
-// NetworkStat represents I/O statistics of block devices.
+// RawNetworkStat represents cumulative statistics of network devices.
 // https://github.com/torvalds/linux/blob/486088bc4689f826b80aa317b45ac9e42e8b25ee/Documentation/filesystems/proc.txt#L1152-L1169
-type rawNetworkStat struct {
+type RawNetworkStat struct {
+	// 1 - device name
+	DevName string
 	// 2 - receive bytes
 	RecvBytes uint64
 	// 3 - receive packets
@@ -47,22 +47,25 @@ type rawNetworkStat struct {
 }
 
 type lastTwoRawNetworkStats struct {
-	devName string
-	stats   [2]rawNetworkStat
+	trackedDevice
+	stats [2]RawNetworkStat
 }
 
 // NetworkStatReader is used for reading disk statistics.
 // NetworkStatReader is not safe for concurrent acceses from multiple goroutines.
 type NetworkStatReader struct {
-	buf      [8192]byte
+	buf      []byte
 	curr     int
 	stats    []lastTwoRawNetworkStats
 	prevTime time.Time
+	path     []byte
+	filter   *DeviceFilter
 }
 
 // NewNetworkStatReader creates a NetworkStatReader and does an initial read.
-func NewNetworkStatReader(devNames []string) (*NetworkStatReader, error) {
-	r := new(NetworkStatReader)
+func NewNetworkStatReader(devNames []string, opts ...Option) (*NetworkStatReader, error) {
+	o := newOptions(opts)
+	r := &NetworkStatReader{path: o.procPath("net", "dev")}
 	r.allocStats(devNames)
 	err := r.readNetworkStat(nil)
 	if err != nil {
@@ -71,6 +74,27 @@ func NewNetworkStatReader(devNames []string) (*NetworkStatReader, error) {
 	return r, nil
 }
 
+// NewNetworkStatReaderWithFilter creates a NetworkStatReader which tracks all
+// devices in /proc/net/dev selected by filter and does an initial read.
+// Devices which appear or disappear later are tracked or untracked on each read.
+// Use ReadAll to read statistics of the tracked devices.
+func NewNetworkStatReaderWithFilter(filter DeviceFilter, opts ...Option) (*NetworkStatReader, error) {
+	err := filter.validate()
+	if err != nil {
+		return nil, err
+	}
+	o := newOptions(opts)
+	r := &NetworkStatReader{
+		path:   o.procPath("net", "dev"),
+		filter: filter.clone(),
+	}
+	err = r.readNetworkStat(nil)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
 func (r *NetworkStatReader) allocStats(devNames []string) {
 	stats := make([]lastTwoRawNetworkStats, len(devNames))
 	for i := 0; i < len(stats); i++ {
@@ -84,18 +108,74 @@ func (r *NetworkStatReader) Read(stats []NetworkStat) error {
 	return r.readNetworkStat(stats)
 }
 
-func (r *NetworkStatReader) readNetworkStat(stats []NetworkStat) error {
-	fd, err := open([]byte("/proc/net/dev"), os.O_RDONLY, 0)
+// ReadAll reads statistics about all the tracked devices and appends them
+// to stats[:0]. The capacity of stats is reused, so no memory is allocated
+// once stats has grown enough.
+// For a reader created by NewNetworkStatReaderWithFilter, devices which appeared
+// after the previous read are included from the next read since rates need
+// two samples.
+func (r *NetworkStatReader) ReadAll(stats []NetworkStat) ([]NetworkStat, error) {
+	err := r.readAndParse()
 	if err != nil {
-		return err
+		return stats, err
 	}
-	defer syscall.Close(fd)
 
-	n, err := syscall.Read(fd, r.buf[:])
+	now := time.Now()
+	intervalSeconds := float64(now.Sub(r.prevTime)) / float64(time.Second)
+	stats = r.appendNetworkStats(stats[:0], intervalSeconds)
+	r.prevTime = now
+	r.switchCurr()
+	return stats, nil
+}
+
+// ReadRaw reads cumulative statistics about devices whose names are set
+// to DevName of elements of stats.
+// The read is also used as the previous sample for the next Read or ReadAll.
+func (r *NetworkStatReader) ReadRaw(stats []RawNetworkStat) error {
+	err := r.readAndParse()
 	if err != nil {
 		return err
 	}
-	err = r.parse(r.buf[:n], r.stats)
+
+	for i := 0; i < len(stats); i++ {
+		lastTwo := r.findLastTwoRawNetworkStats(stats[i].DevName)
+		if lastTwo == nil || (r.filter != nil && !lastTwo.selected) {
+			return errors.New("device name not found in network stats")
+		}
+		devName := stats[i].DevName
+		stats[i] = lastTwo.stats[r.curr]
+		stats[i].DevName = devName
+	}
+	r.prevTime = time.Now()
+	r.switchCurr()
+	return nil
+}
+
+// ReadAllRaw reads cumulative statistics about all the tracked devices and
+// appends them to stats[:0] like ReadAll.
+// The read is also used as the previous sample for the next Read or ReadAll.
+func (r *NetworkStatReader) ReadAllRaw(stats []RawNetworkStat) ([]RawNetworkStat, error) {
+	err := r.readAndParse()
+	if err != nil {
+		return stats, err
+	}
+
+	stats = stats[:0]
+	for i := 0; i < len(r.stats); i++ {
+		lastTwo := &r.stats[i]
+		if r.filter != nil && !lastTwo.selected {
+			continue
+		}
+		stats = append(stats, lastTwo.stats[r.curr])
+		stats[len(stats)-1].DevName = lastTwo.devName
+	}
+	r.prevTime = time.Now()
+	r.switchCurr()
+	return stats, nil
+}
+
+func (r *NetworkStatReader) readNetworkStat(stats []NetworkStat) error {
+	err := r.readAndParse()
 	if err != nil {
 		return err
 	}
@@ -113,11 +193,34 @@ func (r *NetworkStatReader) readNetworkStat(stats []NetworkStat) error {
 	return nil
 }
 
+func (r *NetworkStatReader) readAndParse() error {
+	buf, err := readFile(r.path, &r.buf)
+	if err != nil {
+		return err
+	}
+	if r.filter != nil {
+		return discoverDevices(r, r.filter, buf)
+	}
+	return r.parse(buf, r.stats)
+}
+
+func (r *NetworkStatReader) appendNetworkStats(stats []NetworkStat, intervalSeconds float64) []NetworkStat {
+	for i := 0; i < len(r.stats); i++ {
+		lastTwo := &r.stats[i]
+		if !r.isReady(lastTwo) {
+			continue
+		}
+		stats = append(stats, NetworkStat{DevName: lastTwo.devName})
+		r.fillNetworkStat(&stats[len(stats)-1], lastTwo, intervalSeconds)
+	}
+	return stats
+}
+
 func (r *NetworkStatReader) fillNetworkStats(stats []NetworkStat, intervalSeconds float64) error {
 	for i := 0; i < len(stats); i++ {
 		lastTwo := r.findLastTwoRawNetworkStats(stats[i].DevName)
-		if lastTwo == nil {
-			return errors.New("device name not found in disk stats")
+		if lastTwo == nil || !r.isReady(lastTwo) {
+			return errors.New("device name not found in network stats")
 		}
 
 		r.fillNetworkStat(&stats[i], lastTwo, intervalSeconds)
@@ -126,24 +229,27 @@ func (r *NetworkStatReader) fillNetworkStats(stats []NetworkStat, intervalSecond
 }
 
 func (r *NetworkStatReader) fillNetworkStat(s *NetworkStat, lastTwo *lastTwoRawNetworkStats, intervalSeconds float64) {
-	c := &lastTwo.stats[r.curr]
-	p := &lastTwo.stats[1-r.curr]
-	s.RecvBytesPerSec = r.llSpValue(p.RecvBytes, c.RecvBytes, intervalSeconds)
-	s.RecvPacketsPerSec = r.llSpValue(p.RecvPackets, c.RecvPackets, intervalSeconds)
-	s.RecvErrsPerSec = r.llSpValue(p.RecvErrs, c.RecvErrs, intervalSeconds)
-	s.RecvDropsPerSec = r.llSpValue(p.RecvDrops, c.RecvDrops, intervalSeconds)
-	s.TransBytesPerSec = r.llSpValue(p.TransBytes, c.TransBytes, intervalSeconds)
-	s.TransPacketsPerSec = r.llSpValue(p.TransPackets, c.TransPackets, intervalSeconds)
-	s.TransErrsPerSec = r.llSpValue(p.TransErrs, c.TransErrs, intervalSeconds)
-	s.TransDropsPerSec = r.llSpValue(p.TransDrops, c.TransDrops, intervalSeconds)
-	s.TransCollsPerSec = r.llSpValue(p.TransColls, c.TransColls, intervalSeconds)
+	calcNetworkStat(s, &lastTwo.stats[r.curr], &lastTwo.stats[1-r.curr], intervalSeconds)
 }
 
-func (r *NetworkStatReader) llSpValue(v1, v2 uint64, intervalSeconds float64) float64 {
-	if v2 < v1 {
-		return 0
-	}
-	return float64(v2-v1) / intervalSeconds
+// CalcNetworkStat calculates network statistics between two snapshots prev
+// and curr read elapsed apart, and stores them into s.
+// s.DevName is set to curr.DevName.
+func CalcNetworkStat(s *NetworkStat, prev, curr *RawNetworkStat, elapsed time.Duration) {
+	s.DevName = curr.DevName
+	calcNetworkStat(s, curr, prev, elapsed.Seconds())
+}
+
+func calcNetworkStat(s *NetworkStat, c, p *RawNetworkStat, intervalSeconds float64) {
+	s.RecvBytesPerSec = counterRate(p.RecvBytes, c.RecvBytes, intervalSeconds)
+	s.RecvPacketsPerSec = counterRate(p.RecvPackets, c.RecvPackets, intervalSeconds)
+	s.RecvErrsPerSec = counterRate(p.RecvErrs, c.RecvErrs, intervalSeconds)
+	s.RecvDropsPerSec = counterRate(p.RecvDrops, c.RecvDrops, intervalSeconds)
+	s.TransBytesPerSec = counterRate(p.TransBytes, c.TransBytes, intervalSeconds)
+	s.TransPacketsPerSec = counterRate(p.TransPackets, c.TransPackets, intervalSeconds)
+	s.TransErrsPerSec = counterRate(p.TransErrs, c.TransErrs, intervalSeconds)
+	s.TransDropsPerSec = counterRate(p.TransDrops, c.TransDrops, intervalSeconds)
+	s.TransCollsPerSec = counterRate(p.TransColls, c.TransColls, intervalSeconds)
 }
 
 func (r *NetworkStatReader) findLastTwoRawNetworkStats(devName string) *lastTwoRawNetworkStats {
@@ -155,6 +261,11 @@ func (r *NetworkStatReader) findLastTwoRawNetworkStats(devName string) *lastTwoR
 	return nil
 }
 
+// isReady reports whether rates of the device can be calculated.
+func (r *NetworkStatReader) isReady(lastTwo *lastTwoRawNetworkStats) bool {
+	return r.filter == nil || (lastTwo.selected && lastTwo.samples == 2)
+}
+
 func (r *NetworkStatReader) switchCurr() {
 	r.curr = 1 - r.curr
 }
@@ -178,7 +289,47 @@ func (r *NetworkStatReader) parse(buf []byte, stats []lastTwoRawNetworkStats) er
 	return nil
 }
 
-func (r *NetworkStatReader) parseLineAfterDevName(buf []byte, s *rawNetworkStat) error {
+// The methods below implement deviceTable.
+
+func (r *NetworkStatReader) numDevices() int {
+	return len(r.stats)
+}
+
+func (r *NetworkStatReader) device(i int) *trackedDevice {
+	return &r.stats[i].trackedDevice
+}
+
+func (r *NetworkStatReader) appendDevice(devName string, selected bool) {
+	r.stats = append(r.stats, lastTwoRawNetworkStats{
+		trackedDevice: trackedDevice{devName: devName, selected: selected},
+	})
+}
+
+func (r *NetworkStatReader) copyDevice(dst, src int) {
+	r.stats[dst] = r.stats[src]
+}
+
+func (r *NetworkStatReader) truncateDevices(n int) {
+	for i := n; i < len(r.stats); i++ {
+		r.stats[i] = lastTwoRawNetworkStats{}
+	}
+	r.stats = r.stats[:n]
+}
+
+func (r *NetworkStatReader) splitDevName(line []byte) (devName, rest []byte) {
+	start, end := ascii.NextField(line)
+	// Skip header lines which do not have a colon after the device name.
+	if end-start < 2 || line[end-1] != ':' {
+		return nil, nil
+	}
+	return line[start : end-1], line[end+1:] // -1 for colon character in eth0:
+}
+
+func (r *NetworkStatReader) parseDevice(i int, rest []byte) error {
+	return r.parseLineAfterDevName(rest, &r.stats[i].stats[r.curr])
+}
+
+func (r *NetworkStatReader) parseLineAfterDevName(buf []byte, s *RawNetworkStat) error {
 	var err error
 	s.RecvBytes, err = readUint64Field(&buf)
 	if err != nil {
@@ -4,6 +4,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestNetworkStatReader_parse(t *testing.T) {
@@ -128,3 +129,100 @@ func BenchmarkNetworkStatReader_Read(b *testing.B) {
 		}
 	}
 }
+
+func TestNetworkStatReader_discover(t *testing.T) {
+	buf1 := []byte(`Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+veth72350E: 8630270  113545    0    0    0     0          0         0 251802663  733421    0    0    0     0       0          0
+    lo: 17899045627 119002139    0    0    0     0          0         0 17899045627 119002139    0    0    0     0       0          0
+   br0: 329426402871 130478210    2    1    0     0          0         0 27152202131 88015716    3    4    5     0       0          0
+`)
+	buf2 := []byte(`Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo: 17899045627 119002139    0    0    0     0          0         0 17899045627 119002139    0    0    0     0       0          0
+   br0: 329426403871 130478220    2    1    0     0          0         0 27152202131 88015716    3    4    5     0       0          0
+vethN5B6AL: 25420504  340655    0    0    0     0          0         0 679492038  986355    0    0    0     0       0          0
+`)
+	// Note: To avoid actual disk read, we construct reader manually here
+	reader := &NetworkStatReader{filter: &DeviceFilter{Exclude: []string{"lo", "veth*"}}}
+	err := discoverDevices(reader, reader.filter, buf1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader.switchCurr()
+	err = discoverDevices(reader, reader.filter, buf2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		devName  string
+		selected bool
+		samples  int
+	}{
+		{"lo", false, 0},
+		{"br0", true, 2},
+		{"vethN5B6AL", false, 0},
+	}
+	if len(reader.stats) != len(testCases) {
+		t.Fatalf("tracked device count unmatch, got %d, want %d", len(reader.stats), len(testCases))
+	}
+	for i, c := range testCases {
+		s := &reader.stats[i]
+		if s.devName != c.devName || s.selected != c.selected || s.samples != c.samples {
+			t.Errorf("tracked device %d unmatch, got {%s %v %d}, want {%s %v %d}",
+				i, s.devName, s.selected, s.samples, c.devName, c.selected, c.samples)
+		}
+	}
+
+	stats := reader.appendNetworkStats(nil, 1)
+	if len(stats) != 1 || stats[0].DevName != "br0" {
+		t.Fatalf("network stats unmatch, got %+v", stats)
+	}
+	if stats[0].RecvBytesPerSec != 1000 {
+		t.Errorf("RecvBytesPerSec unmatch, got %g, want %g", stats[0].RecvBytesPerSec, 1000.0)
+	}
+	if stats[0].RecvPacketsPerSec != 10 {
+		t.Errorf("RecvPacketsPerSec unmatch, got %g, want %g", stats[0].RecvPacketsPerSec, 10.0)
+	}
+}
+
+func BenchmarkNetworkStatReader_ReadAll(b *testing.B) {
+	reader, err := NewNetworkStatReaderWithFilter(DeviceFilter{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	var stats []NetworkStat
+	for i := 0; i < b.N; i++ {
+		stats, err = reader.ReadAll(stats)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCalcNetworkStat(t *testing.T) {
+	prev := RawNetworkStat{DevName: "eth0", RecvBytes: 1000, RecvPackets: 10, TransBytes: 5000, TransPackets: 50}
+	curr := RawNetworkStat{DevName: "eth0", RecvBytes: 3000, RecvPackets: 30, TransBytes: 4000, TransPackets: 70}
+	var s NetworkStat
+	CalcNetworkStat(&s, &prev, &curr, 2*time.Second)
+	if s.DevName != "eth0" {
+		t.Errorf("DevName unmatch, got %s, want %s", s.DevName, "eth0")
+	}
+	testCases := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"RecvBytesPerSec", s.RecvBytesPerSec, 1000},
+		{"RecvPacketsPerSec", s.RecvPacketsPerSec, 10},
+		// counters going backward are treated as zero.
+		{"TransBytesPerSec", s.TransBytesPerSec, 0},
+		{"TransPacketsPerSec", s.TransPacketsPerSec, 10},
+	}
+	for _, c := range testCases {
+		if c.got != c.want {
+			t.Errorf("%s unmatch, got %g, want %g", c.name, c.got, c.want)
+		}
+	}
+}
@@ -0,0 +1,415 @@
+package sysstat
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/hnakamur/ascii"
+)
+
+// NFSMountStat is a statistics about an NFS mount, which is similar to
+// the one reported by nfsiostat.
+type NFSMountStat struct {
+	MountPoint string
+	// Device is the export like "server:/export".
+	Device string
+	// FSType is "nfs" or "nfs4".
+	FSType string
+
+	// ReadBytesPerSec and WriteBytesPerSec are the bytes read and written
+	// by applications per second including direct I/O.
+	ReadBytesPerSec  float64
+	WriteBytesPerSec float64
+	// ServerReadBytesPerSec and ServerWriteBytesPerSec are the bytes read
+	// from and written to the server per second.
+	ServerReadBytesPerSec  float64
+	ServerWriteBytesPerSec float64
+
+	// Ops is the statistics per operation type in the order of
+	// /proc/self/mountstats.
+	Ops []NFSOpStat
+}
+
+// NFSOpStat is a statistics about an operation type like READ or WRITE
+// of an NFS mount.
+type NFSOpStat struct {
+	// Op is the name of the operation like "READ".
+	Op        string
+	OpsPerSec float64
+	// RetransPerSec is the number of retransmissions per second.
+	RetransPerSec float64
+	// MajorTimeoutsPerSec is the number of major timeouts per second.
+	MajorTimeoutsPerSec float64
+	// BytesPerSec is the bytes sent and received per second including
+	// RPC headers.
+	BytesPerSec float64
+	// ErrorsPerSec is the number of operations which completed with an
+	// error status per second, which is available on Linux 5.3 or later.
+	ErrorsPerSec float64
+	// AvgQueueMillis is the average time in milliseconds that requests
+	// waited in the queue before being sent.
+	AvgQueueMillis float64
+	// AvgRTTMillis is the average round trip time in milliseconds from
+	// sending a request to receiving the reply.
+	AvgRTTMillis float64
+	// AvgExeMillis is the average time in milliseconds from queueing
+	// a request to completing it, which includes AvgQueueMillis and
+	// AvgRTTMillis.
+	AvgExeMillis float64
+}
+
+// rawNFSMountStat is the values of the "bytes:" line.
+type rawNFSMountStat struct {
+	NormalReadBytes  uint64
+	NormalWriteBytes uint64
+	DirectReadBytes  uint64
+	DirectWriteBytes uint64
+	ServerReadBytes  uint64
+	ServerWriteBytes uint64
+}
+
+// rawNFSOpStat is the values of a line in the per-op statistics.
+type rawNFSOpStat struct {
+	Ops           uint64
+	Trans         uint64
+	MajorTimeouts uint64
+	BytesSent     uint64
+	BytesRecv     uint64
+	QueueMillis   uint64
+	RTTMillis     uint64
+	ExecuteMillis uint64
+	Errors        uint64
+}
+
+type nfsMount struct {
+	mountPoint string
+	device     string
+	fsType     string
+	stats      [2]rawNFSMountStat
+	ops        []nfsOp
+	// seen is true if the mount is found in the current read.
+	seen bool
+	// samples is the number of reads of the mount, saturated at 2.
+	samples int
+}
+
+type nfsOp struct {
+	name  string
+	stats [2]rawNFSOpStat
+	// samples is the number of reads of the operation, saturated at 2.
+	samples int
+}
+
+// NFSStatReader is used for reading statistics of NFS mounts from
+// /proc/self/mountstats. Mounts of other filesystem types are ignored.
+// Use CIFSStatReader for CIFS mounts, which have no statistics in mountstats.
+// NFSStatReader is not safe for concurrent accesses from multiple goroutines.
+type NFSStatReader struct {
+	buf         []byte
+	unescapeBuf []byte
+	curr        int
+	mounts      []nfsMount
+	prevTime    time.Time
+	path        []byte
+}
+
+// NewNFSStatReader creates a NFSStatReader and does an initial read.
+func NewNFSStatReader(opts ...Option) (*NFSStatReader, error) {
+	o := newOptions(opts)
+	r := &NFSStatReader{path: o.procPath("self", "mountstats")}
+	err := r.readAndParse()
+	if err != nil {
+		return nil, err
+	}
+	r.prevTime = time.Now()
+	r.switchCurr()
+	return r, nil
+}
+
+// Read reads statistics of NFS mounts and appends them to stats[:0].
+// The capacity of stats and Ops of its elements are reused, so no memory
+// is allocated once they have grown enough. Mounts which appeared after
+// the previous read are included from the next read since rates need
+// two samples.
+func (r *NFSStatReader) Read(stats []NFSMountStat) ([]NFSMountStat, error) {
+	err := r.readAndParse()
+	if err != nil {
+		return stats, err
+	}
+
+	now := time.Now()
+	intervalSeconds := float64(now.Sub(r.prevTime)) / float64(time.Second)
+	stats = stats[:0]
+	for i := 0; i < len(r.mounts); i++ {
+		m := &r.mounts[i]
+		if m.samples < 2 {
+			continue
+		}
+		if len(stats) < cap(stats) {
+			stats = stats[:len(stats)+1]
+		} else {
+			stats = append(stats, NFSMountStat{})
+		}
+		r.fillNFSMountStat(&stats[len(stats)-1], m, intervalSeconds)
+	}
+	r.prevTime = now
+	r.switchCurr()
+	return stats, nil
+}
+
+func (r *NFSStatReader) readAndParse() error {
+	buf, err := readFile(r.path, &r.buf)
+	if err != nil {
+		return err
+	}
+	return r.parse(buf)
+}
+
+func (r *NFSStatReader) switchCurr() {
+	r.curr = 1 - r.curr
+}
+
+func (r *NFSStatReader) fillNFSMountStat(s *NFSMountStat, m *nfsMount, intervalSeconds float64) {
+	c, p := &m.stats[r.curr], &m.stats[1-r.curr]
+	s.MountPoint = m.mountPoint
+	s.Device = m.device
+	s.FSType = m.fsType
+	s.ReadBytesPerSec = counterRate(p.NormalReadBytes+p.DirectReadBytes, c.NormalReadBytes+c.DirectReadBytes, intervalSeconds)
+	s.WriteBytesPerSec = counterRate(p.NormalWriteBytes+p.DirectWriteBytes, c.NormalWriteBytes+c.DirectWriteBytes, intervalSeconds)
+	s.ServerReadBytesPerSec = counterRate(p.ServerReadBytes, c.ServerReadBytes, intervalSeconds)
+	s.ServerWriteBytesPerSec = counterRate(p.ServerWriteBytes, c.ServerWriteBytes, intervalSeconds)
+
+	s.Ops = s.Ops[:0]
+	for i := 0; i < len(m.ops); i++ {
+		op := &m.ops[i]
+		if op.samples < 2 {
+			continue
+		}
+		s.Ops = append(s.Ops, NFSOpStat{Op: op.name})
+		calcNFSOpStat(&s.Ops[len(s.Ops)-1], &op.stats[1-r.curr], &op.stats[r.curr], intervalSeconds)
+	}
+}
+
+// calcNFSOpStat calculates the statistics in the same way as nfsiostat.
+func calcNFSOpStat(s *NFSOpStat, p, c *rawNFSOpStat, intervalSeconds float64) {
+	s.OpsPerSec = counterRate(p.Ops, c.Ops, intervalSeconds)
+	s.RetransPerSec = 0
+	if c.Trans >= p.Trans && c.Ops >= p.Ops && c.Trans-p.Trans > c.Ops-p.Ops {
+		s.RetransPerSec = float64((c.Trans-p.Trans)-(c.Ops-p.Ops)) / intervalSeconds
+	}
+	s.MajorTimeoutsPerSec = counterRate(p.MajorTimeouts, c.MajorTimeouts, intervalSeconds)
+	s.BytesPerSec = counterRate(p.BytesSent+p.BytesRecv, c.BytesSent+c.BytesRecv, intervalSeconds)
+	s.ErrorsPerSec = counterRate(p.Errors, c.Errors, intervalSeconds)
+
+	s.AvgQueueMillis, s.AvgRTTMillis, s.AvgExeMillis = 0, 0, 0
+	if c.Ops > p.Ops {
+		// counterRate is used for averages per operation here.
+		ops := float64(c.Ops - p.Ops)
+		s.AvgQueueMillis = counterRate(p.QueueMillis, c.QueueMillis, ops)
+		s.AvgRTTMillis = counterRate(p.RTTMillis, c.RTTMillis, ops)
+		s.AvgExeMillis = counterRate(p.ExecuteMillis, c.ExecuteMillis, ops)
+	}
+}
+
+// parse parses /proc/self/mountstats like below. Lines of mounts other
+// than NFS ones have only the "device" line.
+//
+//	device server:/export mounted on /mnt/nfs with fstype nfs4 statvers=1.1
+//		opts:	rw,vers=4.2,rsize=1048576,wsize=1048576,...
+//		age:	1234
+//		...
+//		bytes:	1048576 0 0 0 1048576 0 256 0
+//		RPC iostats version: 1.1  p/v: 100003/4 (nfs)
+//		xprt:	tcp 0 1 2 0 11 1234 1234 0 12345 0 2 0 0
+//		per-op statistics
+//		        NULL: 1 1 0 44 24 0 0 0 0
+//		        READ: 16 16 0 2688 1051136 0 23 24 0
+//		...
+func (r *NFSStatReader) parse(buf []byte) error {
+	for i := 0; i < len(r.mounts); i++ {
+		r.mounts[i].seen = false
+	}
+	var m *nfsMount
+	inOps := false
+	mountHint, opHint := 0, 0
+	for len(buf) > 0 {
+		line := ascii.GetLine(buf)
+		buf = buf[len(line):]
+		start, end := ascii.NextField(line)
+		key := line[start:end]
+		rest := line[end:]
+		switch {
+		case bytes.Equal(key, []byte("device")):
+			i, err := r.parseDeviceLine(rest, mountHint)
+			if err != nil {
+				return err
+			}
+			m = nil
+			if i != -1 {
+				m = &r.mounts[i]
+				mountHint = i + 1
+			}
+			inOps = false
+			opHint = 0
+		case m == nil:
+		case bytes.Equal(key, []byte("bytes:")):
+			err := parseNFSBytes(rest, &m.stats[r.curr])
+			if err != nil {
+				return err
+			}
+		case bytes.Equal(key, []byte("per-op")):
+			inOps = true
+		case inOps && len(key) > 1 && key[len(key)-1] == ':':
+			i := m.opIndex(key[:len(key)-1], opHint)
+			if i == -1 {
+				m.ops = append(m.ops, nfsOp{name: string(key[:len(key)-1])})
+				i = len(m.ops) - 1
+			}
+			opHint = i + 1
+			op := &m.ops[i]
+			err := parseNFSOp(rest, &op.stats[r.curr])
+			if err != nil {
+				return err
+			}
+			if op.samples < 2 {
+				op.samples++
+			}
+		}
+	}
+	for i := 0; i < len(r.mounts); i++ {
+		m := &r.mounts[i]
+		if m.seen && m.samples < 2 {
+			m.samples++
+		}
+	}
+	r.removeUnseen()
+	return nil
+}
+
+// parseDeviceLine parses the rest of a "device" line and returns the index
+// of the tracked mount, or -1 if the mount is not an NFS one.
+func (r *NFSStatReader) parseDeviceLine(line []byte, hint int) (int, error) {
+	var fields [6][]byte
+	for i := range fields {
+		start, end := ascii.NextField(line)
+		if start == end {
+			return -1, ErrUnexpectedFormat
+		}
+		fields[i] = line[start:end]
+		line = line[end:]
+	}
+	// fields are: device "mounted" "on" mountPoint "with" "fstype" and
+	// the filesystem type follows.
+	start, end := ascii.NextField(line)
+	fsType := line[start:end]
+	if !bytes.Equal(fsType, []byte("nfs")) && !bytes.Equal(fsType, []byte("nfs4")) {
+		return -1, nil
+	}
+	device := fields[0]
+	r.unescapeBuf = unescapeOctal(r.unescapeBuf[:0], fields[3])
+	mountPoint := r.unescapeBuf
+
+	i := r.indexOfMount(device, mountPoint, fsType, hint)
+	if i == -1 {
+		r.mounts = append(r.mounts, nfsMount{
+			mountPoint: string(mountPoint),
+			device:     string(device),
+			fsType:     string(fsType),
+		})
+		i = len(r.mounts) - 1
+	}
+	m := &r.mounts[i]
+	m.seen = true
+	// Clear values in case the bytes line is missing.
+	m.stats[r.curr] = rawNFSMountStat{}
+	return i, nil
+}
+
+// indexOfMount returns the index of the mount in r.mounts, or -1 if not found.
+// Mounts in r.mounts are usually in the same order as in mountstats,
+// so the search starts at hint.
+func (r *NFSStatReader) indexOfMount(device, mountPoint, fsType []byte, hint int) int {
+	for i := hint; i < len(r.mounts); i++ {
+		if r.mounts[i].equals(device, mountPoint, fsType) {
+			return i
+		}
+	}
+	for i := 0; i < hint && i < len(r.mounts); i++ {
+		if r.mounts[i].equals(device, mountPoint, fsType) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *nfsMount) equals(device, mountPoint, fsType []byte) bool {
+	return string(device) == m.device && string(mountPoint) == m.mountPoint &&
+		string(fsType) == m.fsType
+}
+
+// opIndex returns the index of the operation in m.ops, or -1 if not found.
+func (m *nfsMount) opIndex(name []byte, hint int) int {
+	for i := hint; i < len(m.ops); i++ {
+		if string(name) == m.ops[i].name {
+			return i
+		}
+	}
+	for i := 0; i < hint && i < len(m.ops); i++ {
+		if string(name) == m.ops[i].name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *NFSStatReader) removeUnseen() {
+	j := 0
+	for i := 0; i < len(r.mounts); i++ {
+		if r.mounts[i].seen {
+			r.mounts[j] = r.mounts[i]
+			j++
+		}
+	}
+	for i := j; i < len(r.mounts); i++ {
+		r.mounts[i] = nfsMount{}
+	}
+	r.mounts = r.mounts[:j]
+}
+
+func parseNFSBytes(buf []byte, s *rawNFSMountStat) error {
+	for _, ptr := range []*uint64{
+		&s.NormalReadBytes, &s.NormalWriteBytes,
+		&s.DirectReadBytes, &s.DirectWriteBytes,
+		&s.ServerReadBytes, &s.ServerWriteBytes,
+	} {
+		var err error
+		*ptr, err = readUint64Field(&buf)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseNFSOp(buf []byte, s *rawNFSOpStat) error {
+	for _, ptr := range []*uint64{
+		&s.Ops, &s.Trans, &s.MajorTimeouts, &s.BytesSent, &s.BytesRecv,
+		&s.QueueMillis, &s.RTTMillis, &s.ExecuteMillis,
+	} {
+		var err error
+		*ptr, err = readUint64Field(&buf)
+		if err != nil {
+			return err
+		}
+	}
+	// The errors field is added in Linux 5.3.
+	s.Errors = 0
+	if hasNextField(buf) {
+		var err error
+		s.Errors, err = readUint64Field(&buf)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
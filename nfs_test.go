@@ -0,0 +1,111 @@
+package sysstat
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+const testMountStats1 = `device rootfs mounted on / with fstype rootfs
+device proc mounted on /proc with fstype proc
+device server:/export mounted on /mnt/nfs\040data with fstype nfs4 statvers=1.1
+	opts:	rw,vers=4.2,rsize=1048576,wsize=1048576,namlen=255,acregmin=3,acregmax=60,acdirmin=30,acdirmax=60,hard,proto=tcp,timeo=600,retrans=2,sec=sys
+	age:	1234
+	caps:	caps=0x3fffdf,wtmult=512,dtsize=32768,bsize=0,namlen=255
+	sec:	flavor=1,pseudoflavor=1
+	events:	3 38 0 2 4 5 47 0 0 2 0 0 2 0 0 0 0 0 0 0 0 0 0 0 0 0 0
+	bytes:	1000 2000 100 200 1100 2200 1 1
+	RPC iostats version: 1.1  p/v: 100003/4 (nfs)
+	xprt:	tcp 0 1 2 0 11 1234 1234 0 12345 0 2 0 0
+	per-op statistics
+	        NULL: 1 1 0 44 24 0 0 0 0
+	        READ: 10 10 0 1640 11280 5 20 30 0
+	       WRITE: 20 20 0 4000 3000 10 40 60 0
+device //fileserver/share mounted on /mnt/cifs with fstype cifs
+`
+
+const testMountStats2 = `device rootfs mounted on / with fstype rootfs
+device proc mounted on /proc with fstype proc
+device server:/export mounted on /mnt/nfs\040data with fstype nfs4 statvers=1.1
+	opts:	rw,vers=4.2,rsize=1048576,wsize=1048576,namlen=255,acregmin=3,acregmax=60,acdirmin=30,acdirmax=60,hard,proto=tcp,timeo=600,retrans=2,sec=sys
+	age:	1235
+	caps:	caps=0x3fffdf,wtmult=512,dtsize=32768,bsize=0,namlen=255
+	sec:	flavor=1,pseudoflavor=1
+	events:	3 38 0 2 4 5 47 0 0 2 0 0 2 0 0 0 0 0 0 0 0 0 0 0 0 0 0
+	bytes:	3000 2000 100 200 3100 2200 1 1
+	RPC iostats version: 1.1  p/v: 100003/4 (nfs)
+	xprt:	tcp 0 1 2 0 11 1234 1234 0 12345 0 2 0 0
+	per-op statistics
+	        NULL: 1 1 0 44 24 0 0 0 0
+	        READ: 14 16 1 2296 15792 13 40 70 1
+	       WRITE: 20 20 0 4000 3000 10 40 60 0
+device server2:/home mounted on /home with fstype nfs statvers=1.1
+	opts:	rw,vers=3
+	bytes:	0 0 0 0 0 0 0 0
+	per-op statistics
+	        NULL: 0 0 0 0 0 0 0 0
+`
+
+func TestNFSStatReader_Read(t *testing.T) {
+	procRoot := t.TempDir()
+	dir := filepath.Join(procRoot, "self")
+	writeFiles(t, dir, map[string]string{"mountstats": testMountStats1})
+	r, err := NewNFSStatReader(WithProcRoot(procRoot))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFiles(t, dir, map[string]string{"mountstats": testMountStats2})
+	stats, err := r.Read(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The mount of server2 is included from the next read.
+	if len(stats) != 1 {
+		t.Fatalf("number of mounts unmatch, got %d, want 1, stats=%+v", len(stats), stats)
+	}
+	s := &stats[0]
+	if s.MountPoint != "/mnt/nfs data" || s.Device != "server:/export" || s.FSType != "nfs4" {
+		t.Errorf("mount unmatch, got %+v", s)
+	}
+	if s.ReadBytesPerSec <= 0 || s.WriteBytesPerSec != 0 || s.ServerReadBytesPerSec <= 0 {
+		t.Errorf("bytes per second unmatch, got %+v", s)
+	}
+	if len(s.Ops) != 3 || s.Ops[0].Op != "NULL" || s.Ops[1].Op != "READ" || s.Ops[2].Op != "WRITE" {
+		t.Fatalf("ops unmatch, got %+v", s.Ops)
+	}
+	read := &s.Ops[1]
+	if read.OpsPerSec <= 0 || read.RetransPerSec <= 0 || read.MajorTimeoutsPerSec <= 0 || read.ErrorsPerSec <= 0 {
+		t.Errorf("READ rates unmatch, got %+v", read)
+	}
+	if read.AvgQueueMillis != 2 || read.AvgRTTMillis != 5 || read.AvgExeMillis != 10 {
+		t.Errorf("READ averages unmatch, got %+v", read)
+	}
+	if write := &s.Ops[2]; write.OpsPerSec != 0 || write.AvgRTTMillis != 0 {
+		t.Errorf("WRITE unmatch, got %+v", write)
+	}
+
+	stats, err = r.Read(stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 || stats[1].MountPoint != "/home" || stats[1].FSType != "nfs" || len(stats[1].Ops) != 1 {
+		t.Errorf("stats unmatch after new mount, got %+v", stats)
+	}
+}
+
+func BenchmarkNFSStatReader_Read(b *testing.B) {
+	procRoot := b.TempDir()
+	writeFiles(b, filepath.Join(procRoot, "self"), map[string]string{"mountstats": testMountStats2})
+	r, err := NewNFSStatReader(WithProcRoot(procRoot))
+	if err != nil {
+		b.Fatal(err)
+	}
+	var stats []NFSMountStat
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		stats, err = r.Read(stats)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
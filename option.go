@@ -0,0 +1,74 @@
+package sysstat
+
+import (
+	"path/filepath"
+	"time"
+)
+
+const (
+	defaultProcRoot = "/proc"
+	defaultSysRoot  = "/sys"
+)
+
+// Option is an option for creating readers.
+type Option func(*options)
+
+type options struct {
+	procRoot         string
+	sysRoot          string
+	memoryStatFields MemoryStatField
+	cpuNormalization CPUNormalization
+
+	mountRediscoveryInterval time.Duration
+	fsHistorySize            int
+	statfsTimeout            time.Duration
+	tcpListenerStats         bool
+}
+
+// WithProcRoot sets the directory where procfs is mounted.
+// The default is "/proc". This is useful for monitoring the host from
+// a container with the host's /proc mounted at another place like /host/proc.
+func WithProcRoot(dir string) Option {
+	return func(o *options) {
+		o.procRoot = dir
+	}
+}
+
+// WithSysRoot sets the directory where sysfs is mounted.
+// The default is "/sys".
+func WithSysRoot(dir string) Option {
+	return func(o *options) {
+		o.sysRoot = dir
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		procRoot:         defaultProcRoot,
+		sysRoot:          defaultSysRoot,
+		memoryStatFields: DefaultMemoryStatFields,
+
+		mountRediscoveryInterval: DefaultMountRediscoveryInterval,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// procPath returns the NUL-terminated path of the file under the procfs root.
+func (o *options) procPath(elem ...string) []byte {
+	return cPath(filepath.Join(o.procRoot, filepath.Join(elem...)))
+}
+
+// sysPath returns the NUL-terminated path of the file under the sysfs root.
+func (o *options) sysPath(elem ...string) []byte {
+	return cPath(filepath.Join(o.sysRoot, filepath.Join(elem...)))
+}
+
+// cPath returns a NUL-terminated path which can be passed to syscalls.
+func cPath(path string) []byte {
+	b := make([]byte, len(path)+1)
+	copy(b, path)
+	return b
+}
@@ -0,0 +1,37 @@
+package sysstat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithProcRoot(t *testing.T) {
+	procRoot := t.TempDir()
+	err := os.WriteFile(filepath.Join(procRoot, "loadavg"), []byte("1.31 1.39 1.43 2/1081 24188\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(procRoot, "uptime"), []byte("10654673.98 20455002.81\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var a LoadAvg
+	err = NewLoadAvgReader(WithProcRoot(procRoot)).Read(&a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Load1 != 1.31 {
+		t.Errorf("Load1 unmatch, got=%g, want=%g", a.Load1, 1.31)
+	}
+
+	var u Uptime
+	err = NewUptimeReader(WithProcRoot(procRoot)).Read(&u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Uptime != 10654673.98 {
+		t.Errorf("uptime unmatch, got %g, want %g", u.Uptime, 10654673.98)
+	}
+}
@@ -0,0 +1,337 @@
+package sysstat
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/hnakamur/ascii"
+	"github.com/hnakamur/bytesconv"
+)
+
+// ProcessStat is a statistics about a process.
+// The values are the same as ones reported by pidstat -u -r -d -w.
+type ProcessStat struct {
+	PID int
+	// Comm is the command name, which is truncated to 15 bytes by the kernel.
+	Comm string
+	// Exited is true when the process has exited. Other fields are zero
+	// when Exited is true.
+	Exited bool
+
+	// UserPercent, SysPercent and CPUPercent are percentages of CPU time
+	// relative to one CPU, so they can exceed 100 for multithreaded processes.
+	UserPercent float64
+	SysPercent  float64
+	CPUPercent  float64
+
+	// RSSBytes is the resident set size in bytes.
+	RSSBytes uint64
+	// VSZBytes is the virtual memory size in bytes.
+	VSZBytes uint64
+	// Threads is the number of threads.
+	Threads uint64
+
+	MinorFaultsPerSec float64
+	MajorFaultsPerSec float64
+
+	// ReadBytesPerSec and WriteBytesPerSec are bytes read from and written
+	// to the storage layer per second. They are zero when /proc/[pid]/io is
+	// not readable, that is, the process is owned by another user and the
+	// caller does not have CAP_SYS_PTRACE.
+	ReadBytesPerSec  float64
+	WriteBytesPerSec float64
+
+	VoluntaryCtxtSwitchesPerSec    float64
+	NonvoluntaryCtxtSwitchesPerSec float64
+}
+
+// rawProcessStat represents cumulative counters and gauges of a process
+// in /proc/[pid]/stat, /proc/[pid]/status and /proc/[pid]/io.
+// https://man7.org/linux/man-pages/man5/proc_pid_stat.5.html
+type rawProcessStat struct {
+	MinFlt     uint64
+	MajFlt     uint64
+	UTime      uint64
+	STime      uint64
+	NumThreads uint64
+	StartTime  uint64
+	VSize      uint64
+	RSS        uint64 // in pages
+
+	VoluntaryCtxtSwitches    uint64
+	NonvoluntaryCtxtSwitches uint64
+
+	ReadBytes  uint64
+	WriteBytes uint64
+}
+
+// pageSize is the page size used for converting RSS to bytes.
+var pageSize = uint64(os.Getpagesize())
+
+// ProcessStatReader reads statistics of processes.
+// ProcessStatReader is not safe for concurrent accesses from multiple goroutines.
+type ProcessStatReader struct {
+	buf      []byte
+	curr     int
+	procs    []trackedProcess
+	prevTime time.Time
+}
+
+type trackedProcess struct {
+	pid        int
+	comm       string
+	stats      [2]rawProcessStat
+	exited     bool
+	noIO       bool
+	statPath   []byte
+	statusPath []byte
+	ioPath     []byte
+}
+
+// NewProcessStatReader creates a ProcessStatReader for pids and does an
+// initial read. Processes which do not exist are reported as exited.
+func NewProcessStatReader(pids []int, opts ...Option) (*ProcessStatReader, error) {
+	o := newOptions(opts)
+	r := &ProcessStatReader{procs: make([]trackedProcess, len(pids))}
+	for i, pid := range pids {
+		p := &r.procs[i]
+		p.pid = pid
+		pidStr := strconv.Itoa(pid)
+		p.statPath = o.procPath(pidStr, "stat")
+		p.statusPath = o.procPath(pidStr, "status")
+		p.ioPath = o.procPath(pidStr, "io")
+	}
+	err := r.readProcessStats(nil)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Read reads statistics of processes.
+// stats[i] is filled with the statistics of the process whose pid is
+// pids[i] passed to NewProcessStatReader.
+// Elements of stats at index len(pids) or greater are left untouched.
+//
+// A process is reported as exited once it has exited, even if its pid is
+// reused by another process later.
+func (r *ProcessStatReader) Read(stats []ProcessStat) error {
+	return r.readProcessStats(stats)
+}
+
+func (r *ProcessStatReader) readProcessStats(stats []ProcessStat) error {
+	for i := range r.procs {
+		err := r.readProcess(&r.procs[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	if stats != nil {
+		intervalSeconds := float64(now.Sub(r.prevTime)) / float64(time.Second)
+		for i := 0; i < len(stats) && i < len(r.procs); i++ {
+			p := &r.procs[i]
+			s := &stats[i]
+			if p.exited {
+				*s = ProcessStat{PID: p.pid, Comm: p.comm, Exited: true}
+				continue
+			}
+			s.PID = p.pid
+			s.Comm = p.comm
+			s.Exited = false
+			calcProcessStat(s, &p.stats[r.curr], &p.stats[1-r.curr], intervalSeconds)
+		}
+	}
+	r.prevTime = now
+	r.switchCurr()
+	return nil
+}
+
+func (r *ProcessStatReader) switchCurr() {
+	r.curr = 1 - r.curr
+}
+
+// readProcess reads the files of the process p. It marks p as exited
+// instead of returning an error when the process has exited.
+func (r *ProcessStatReader) readProcess(p *trackedProcess) error {
+	if p.exited {
+		return nil
+	}
+	s := &p.stats[r.curr]
+	startTime := p.stats[1-r.curr].StartTime
+	exited, err := readRawProcessStat(p, s, &r.buf)
+	if err != nil {
+		return err
+	}
+	// A different start time means the pid is reused by another process.
+	if exited || (startTime != 0 && s.StartTime != startTime) {
+		p.exited = true
+	}
+	return nil
+}
+
+// readRawProcessStat reads /proc/[pid]/stat, status and io of p into s.
+// It returns true without an error when the process has exited.
+func readRawProcessStat(p *trackedProcess, s *rawProcessStat, buf *[]byte) (exited bool, err error) {
+	b, err := readFile(p.statPath, buf)
+	if err != nil {
+		return isProcessGone(err), ignoreProcessGone(err)
+	}
+	comm, err := parseProcessStat(b, s)
+	if err != nil {
+		return false, err
+	}
+	if string(comm) != p.comm {
+		p.comm = string(comm)
+	}
+
+	b, err = readFile(p.statusPath, buf)
+	if err != nil {
+		return isProcessGone(err), ignoreProcessGone(err)
+	}
+	err = parseProcessStatus(b, s)
+	if err != nil {
+		return false, err
+	}
+
+	if p.noIO {
+		return false, nil
+	}
+	b, err = readFile(p.ioPath, buf)
+	if err != nil {
+		if err == syscall.EACCES || err == syscall.EPERM {
+			p.noIO = true
+			return false, nil
+		}
+		return isProcessGone(err), ignoreProcessGone(err)
+	}
+	return false, parseProcessIO(b, s)
+}
+
+// isProcessGone returns whether err is returned for reading files of
+// a process which has exited.
+func isProcessGone(err error) bool {
+	return err == syscall.ENOENT || err == syscall.ESRCH
+}
+
+func ignoreProcessGone(err error) error {
+	if isProcessGone(err) {
+		return nil
+	}
+	return err
+}
+
+// parseProcessStat parses /proc/[pid]/stat and returns the command name.
+// The command name is enclosed in parentheses and may contain spaces and
+// parentheses, so the fields are parsed after the last ')'.
+func parseProcessStat(buf []byte, s *rawProcessStat) (comm []byte, err error) {
+	lp := bytes.IndexByte(buf, '(')
+	rp := bytes.LastIndexByte(buf, ')')
+	if lp == -1 || rp < lp {
+		return nil, ErrUnexpectedFormat
+	}
+	comm = buf[lp+1 : rp]
+	buf = buf[rp+1:]
+
+	// The indexes below are 0-based ones after the command name, that is,
+	// the field number in proc(5) minus three.
+	const (
+		minFltIndex     = 7
+		majFltIndex     = 9
+		uTimeIndex      = 11
+		sTimeIndex      = 12
+		numThreadsIndex = 17
+		startTimeIndex  = 19
+		vSizeIndex      = 20
+		rssIndex        = 21
+	)
+	fields := [...]struct {
+		index int
+		ptr   *uint64
+	}{
+		{minFltIndex, &s.MinFlt},
+		{majFltIndex, &s.MajFlt},
+		{uTimeIndex, &s.UTime},
+		{sTimeIndex, &s.STime},
+		{numThreadsIndex, &s.NumThreads},
+		{startTimeIndex, &s.StartTime},
+		{vSizeIndex, &s.VSize},
+		{rssIndex, &s.RSS},
+	}
+	prev := 0
+	for _, f := range fields {
+		*f.ptr, err = readNthUint64Field(&buf, f.index-prev)
+		if err != nil {
+			return nil, err
+		}
+		prev = f.index + 1
+	}
+	return comm, nil
+}
+
+// parseProcessStatus parses context switch counts in /proc/[pid]/status.
+func parseProcessStatus(buf []byte, s *rawProcessStat) error {
+	for len(buf) > 0 {
+		line := ascii.GetLine(buf)
+		buf = buf[len(line):]
+		var ptr *uint64
+		switch {
+		case bytes.HasPrefix(line, []byte("voluntary_ctxt_switches:")):
+			ptr = &s.VoluntaryCtxtSwitches
+		case bytes.HasPrefix(line, []byte("nonvoluntary_ctxt_switches:")):
+			ptr = &s.NonvoluntaryCtxtSwitches
+		default:
+			continue
+		}
+		start, end := ascii.NthField(line, 1)
+		val, err := bytesconv.ParseUint(line[start:end], 10, 64)
+		if err != nil {
+			return err
+		}
+		*ptr = val
+	}
+	return nil
+}
+
+// parseProcessIO parses /proc/[pid]/io.
+func parseProcessIO(buf []byte, s *rawProcessStat) error {
+	for len(buf) > 0 {
+		line := ascii.GetLine(buf)
+		buf = buf[len(line):]
+		var ptr *uint64
+		switch {
+		case bytes.HasPrefix(line, []byte("read_bytes:")):
+			ptr = &s.ReadBytes
+		case bytes.HasPrefix(line, []byte("write_bytes:")):
+			ptr = &s.WriteBytes
+		default:
+			continue
+		}
+		start, end := ascii.NthField(line, 1)
+		val, err := bytesconv.ParseUint(line[start:end], 10, 64)
+		if err != nil {
+			return err
+		}
+		*ptr = val
+	}
+	return nil
+}
+
+func calcProcessStat(s *ProcessStat, c, p *rawProcessStat, intervalSeconds float64) {
+	s.UserPercent = llSpValue(p.UTime, c.UTime, intervalSeconds, 1)
+	s.SysPercent = llSpValue(p.STime, c.STime, intervalSeconds, 1)
+	s.CPUPercent = s.UserPercent + s.SysPercent
+	s.RSSBytes = c.RSS * pageSize
+	s.VSZBytes = c.VSize
+	s.Threads = c.NumThreads
+	s.MinorFaultsPerSec = counterRate(p.MinFlt, c.MinFlt, intervalSeconds)
+	s.MajorFaultsPerSec = counterRate(p.MajFlt, c.MajFlt, intervalSeconds)
+	s.ReadBytesPerSec = counterRate(p.ReadBytes, c.ReadBytes, intervalSeconds)
+	s.WriteBytesPerSec = counterRate(p.WriteBytes, c.WriteBytes, intervalSeconds)
+	s.VoluntaryCtxtSwitchesPerSec = counterRate(p.VoluntaryCtxtSwitches, c.VoluntaryCtxtSwitches, intervalSeconds)
+	s.NonvoluntaryCtxtSwitchesPerSec = counterRate(p.NonvoluntaryCtxtSwitches, c.NonvoluntaryCtxtSwitches, intervalSeconds)
+}
@@ -0,0 +1,134 @@
+package sysstat
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestParseProcessStat(t *testing.T) {
+	buf := []byte("12345 (tmux: server) S 1 12345 12345 0 -1 4194560 180153 0 3 0 2167 6148 0 0 20 0 4 0 3164 25915392 1158 18446744073709551615 1 1 0 0 0 0 0 3674112 1266796039 0 0 0 17 1 0 0 0 0 0 0 0 0 0 0 0 0 0\n")
+	var s rawProcessStat
+	comm, err := parseProcessStat(buf, &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(comm), "tmux: server"; got != want {
+		t.Errorf("comm unmatch, got %q, want %q", got, want)
+	}
+	want := rawProcessStat{
+		MinFlt:     180153,
+		MajFlt:     3,
+		UTime:      2167,
+		STime:      6148,
+		NumThreads: 4,
+		StartTime:  3164,
+		VSize:      25915392,
+		RSS:        1158,
+	}
+	if s != want {
+		t.Errorf("stat unmatch, got %+v, want %+v", s, want)
+	}
+}
+
+func TestParseProcessStatusAndIO(t *testing.T) {
+	status := []byte(`Name:	bash
+State:	S (sleeping)
+Threads:	1
+voluntary_ctxt_switches:	150
+nonvoluntary_ctxt_switches:	13
+`)
+	io := []byte(`rchar: 323934931
+wchar: 323929600
+syscr: 632687
+syscw: 632675
+read_bytes: 4096
+write_bytes: 323932160
+cancelled_write_bytes: 0
+`)
+	var s rawProcessStat
+	err := parseProcessStatus(status, &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = parseProcessIO(io, &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := rawProcessStat{
+		VoluntaryCtxtSwitches:    150,
+		NonvoluntaryCtxtSwitches: 13,
+		ReadBytes:                4096,
+		WriteBytes:               323932160,
+	}
+	if s != want {
+		t.Errorf("stat unmatch, got %+v, want %+v", s, want)
+	}
+}
+
+func TestProcessStatReader(t *testing.T) {
+	procRoot := t.TempDir()
+	writeProcessFiles := func(pid int, startTime int, utime int) {
+		dir := filepath.Join(procRoot, strconv.Itoa(pid))
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stat := "1 (init) S 0 1 1 0 -1 4194560 100 0 0 0 " + strconv.Itoa(utime) +
+			" 0 0 0 20 0 1 0 " + strconv.Itoa(startTime) + " 4096 2 0\n"
+		err = os.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(dir, "status"), []byte("voluntary_ctxt_switches:\t1\nnonvoluntary_ctxt_switches:\t2\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(dir, "io"), []byte("read_bytes: 0\nwrite_bytes: 0\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeProcessFiles(1, 10, 100)
+	writeProcessFiles(2, 20, 100)
+
+	r, err := NewProcessStatReader([]int{1, 2, 3}, WithProcRoot(procRoot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeProcessFiles(1, 10, 200)
+	// pid 2 is reused by another process.
+	writeProcessFiles(2, 30, 100)
+
+	stats := make([]ProcessStat, 3)
+	err = r.Read(stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats[0].Exited || stats[0].Comm != "init" || stats[0].CPUPercent <= 0 ||
+		stats[0].RSSBytes != 2*pageSize || stats[0].Threads != 1 {
+		t.Errorf("stats[0] unmatch, got %+v", stats[0])
+	}
+	if !stats[1].Exited || stats[1].PID != 2 {
+		t.Errorf("stats[1] must be exited, got %+v", stats[1])
+	}
+	if !stats[2].Exited || stats[2].PID != 3 {
+		t.Errorf("stats[2] must be exited, got %+v", stats[2])
+	}
+}
+
+func BenchmarkProcessStatReader_Read(b *testing.B) {
+	r, err := NewProcessStatReader([]int{os.Getpid()})
+	if err != nil {
+		b.Fatal(err)
+	}
+	stats := make([]ProcessStat, 1)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err = r.Read(stats)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,466 @@
+// Package promexporter provides an http.Handler which serves system
+// statistics read with the sysstat readers in the Prometheus text
+// exposition format.
+//
+// Cumulative values like CPU times and disk or network I/O counts are
+// exported as counters, so rates should be calculated with rate() or
+// irate() in PromQL.
+package promexporter
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/hnakamur/sysstat"
+)
+
+// userHZ is the unit of CPU times in /proc/stat.
+const userHZ = 100
+
+// sectorBytes is the unit of sectors in /proc/diskstats.
+const sectorBytes = 512
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Config is a configuration for Handler.
+type Config struct {
+	// DiskFilter selects block devices to export.
+	DiskFilter sysstat.DeviceFilter
+	// NetworkFilter selects network devices to export.
+	NetworkFilter sysstat.DeviceFilter
+	// MountPoints is a list of mount points whose filesystem statistics
+	// are exported.
+	MountPoints []string
+	// MountFilter selects filesystems to export from mounts discovered in
+	// /proc/self/mountinfo. MountPoints is ignored if MountFilter is not nil.
+	MountFilter *sysstat.MountFilter
+	// FileSystemForecast is the number of samples used for forecasting
+	// when filesystems become full. The forecast is exported only if it is
+	// positive. See sysstat.WithFileSystemForecast.
+	FileSystemForecast int
+	// Options are passed to the reader constructors.
+	Options []sysstat.Option
+}
+
+// Handler is an http.Handler which serves system statistics in the
+// Prometheus text exposition format.
+// Handler is safe for concurrent accesses from multiple goroutines.
+type Handler struct {
+	mu sync.Mutex
+
+	cpuReader     *sysstat.CPUStatReader
+	memoryReader  *sysstat.MemoryStatReader
+	diskReader    *sysstat.DiskStatReader
+	networkReader *sysstat.NetworkStatReader
+	loadAvgReader *sysstat.LoadAvgReader
+	uptimeReader  *sysstat.UptimeReader
+	fsReader      *sysstat.FileSystemStatReader
+
+	cpuStat      sysstat.RawCPUStat
+	memoryStat   sysstat.MemoryStat
+	diskStats    []sysstat.RawDiskStat
+	networkStats []sysstat.RawNetworkStat
+	loadAvg      sysstat.LoadAvg
+	uptime       sysstat.Uptime
+	fsStats      []sysstat.FileSystemStat
+	fsForecast   bool
+
+	// errs is the errors of the last reads of collectors.
+	errs []error
+	w    expositionWriter
+}
+
+// NewHandler creates a Handler.
+func NewHandler(cfg Config) (*Handler, error) {
+	h := &Handler{
+		memoryReader:  sysstat.NewMemoryStatReader(cfg.Options...),
+		loadAvgReader: sysstat.NewLoadAvgReader(cfg.Options...),
+		uptimeReader:  sysstat.NewUptimeReader(cfg.Options...),
+		errs:          make([]error, len(collectors)),
+	}
+	var err error
+	h.cpuReader, err = sysstat.NewCPUStatReader(cfg.Options...)
+	if err != nil {
+		return nil, err
+	}
+	h.diskReader, err = sysstat.NewDiskStatReaderWithFilter(cfg.DiskFilter, cfg.Options...)
+	if err != nil {
+		return nil, err
+	}
+	h.networkReader, err = sysstat.NewNetworkStatReaderWithFilter(cfg.NetworkFilter, cfg.Options...)
+	if err != nil {
+		return nil, err
+	}
+	fsOpts := cfg.Options
+	if cfg.FileSystemForecast > 0 {
+		h.fsForecast = true
+		fsOpts = append(fsOpts[:len(fsOpts):len(fsOpts)], sysstat.WithFileSystemForecast(cfg.FileSystemForecast))
+	}
+	if cfg.MountFilter != nil {
+		h.fsReader, err = sysstat.NewFileSystemStatReaderWithFilter(*cfg.MountFilter, fsOpts...)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		h.fsReader = sysstat.NewFileSystemStatReader(cfg.MountPoints, fsOpts...)
+	}
+	return h, nil
+}
+
+// Close closes the filesystem statistics reader. The handler must not be
+// used after Close.
+func (h *Handler) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.fsReader.Close()
+}
+
+// ServeHTTP reads the statistics and writes them in the Prometheus text
+// exposition format. A metric family whose statistics cannot be read is
+// omitted, and the failure is reported in sysstat_scrape_collector_success.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.w.reset()
+	for i, c := range collectors {
+		h.errs[i] = c.read(h)
+		if h.errs[i] == nil {
+			c.write(h)
+		}
+	}
+	h.writeScrapeMetrics()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(h.w.buf)
+}
+
+// collectors are the metric families which are read and written
+// independently of each other.
+var collectors = []struct {
+	name  string
+	read  func(h *Handler) error
+	write func(h *Handler)
+}{
+	{"cpu", (*Handler).readCPU, (*Handler).writeCPUMetrics},
+	{"memory", (*Handler).readMemory, (*Handler).writeMemoryMetrics},
+	{"disk", (*Handler).readDisk, (*Handler).writeDiskMetrics},
+	{"network", (*Handler).readNetwork, (*Handler).writeNetworkMetrics},
+	{"loadavg", (*Handler).readLoadAvg, (*Handler).writeLoadAvgMetrics},
+	{"uptime", (*Handler).readUptime, (*Handler).writeUptimeMetrics},
+	{"filesystem", (*Handler).readFileSystem, (*Handler).writeFileSystemMetrics},
+}
+
+func (h *Handler) readCPU() error {
+	return h.cpuReader.ReadRaw(&h.cpuStat)
+}
+
+func (h *Handler) readMemory() error {
+	return h.memoryReader.Read(&h.memoryStat)
+}
+
+func (h *Handler) readDisk() (err error) {
+	h.diskStats, err = h.diskReader.ReadAllRaw(h.diskStats)
+	return err
+}
+
+func (h *Handler) readNetwork() (err error) {
+	h.networkStats, err = h.networkReader.ReadAllRaw(h.networkStats)
+	return err
+}
+
+func (h *Handler) readLoadAvg() error {
+	return h.loadAvgReader.Read(&h.loadAvg)
+}
+
+func (h *Handler) readUptime() error {
+	return h.uptimeReader.Read(&h.uptime)
+}
+
+func (h *Handler) readFileSystem() (err error) {
+	h.fsStats, err = h.fsReader.ReadAll(h.fsStats)
+	return err
+}
+
+func (h *Handler) writeScrapeMetrics() {
+	const name = "sysstat_scrape_collector_success"
+	h.w.header(name, "Whether the statistics of a collector were read successfully.", "gauge")
+	for i, c := range collectors {
+		var v float64
+		if h.errs[i] == nil {
+			v = 1
+		}
+		h.w.sample(name, "collector", c.name, v)
+	}
+}
+
+var cpuModes = []struct {
+	mode  string
+	value func(s *sysstat.RawCPUStat) uint64
+}{
+	// User and Nice include Guest and GuestNice respectively.
+	{"user", func(s *sysstat.RawCPUStat) uint64 { return s.UserWithoutGuest() }},
+	{"nice", func(s *sysstat.RawCPUStat) uint64 { return s.NiceWithoutGuestNice() }},
+	{"system", func(s *sysstat.RawCPUStat) uint64 { return s.Sys }},
+	{"idle", func(s *sysstat.RawCPUStat) uint64 { return s.Idle }},
+	{"iowait", func(s *sysstat.RawCPUStat) uint64 { return s.IOWait }},
+	{"irq", func(s *sysstat.RawCPUStat) uint64 { return s.HardIRQ }},
+	{"softirq", func(s *sysstat.RawCPUStat) uint64 { return s.SoftIRQ }},
+	{"steal", func(s *sysstat.RawCPUStat) uint64 { return s.Steal }},
+	{"guest", func(s *sysstat.RawCPUStat) uint64 { return s.Guest }},
+	{"guest_nice", func(s *sysstat.RawCPUStat) uint64 { return s.GuestNice }},
+}
+
+func (h *Handler) writeCPUMetrics() {
+	const name = "sysstat_cpu_seconds_total"
+	h.w.header(name, "Seconds all CPUs spent in each mode.", "counter")
+	for _, m := range cpuModes {
+		h.w.sample(name, "mode", m.mode, float64(m.value(&h.cpuStat))/userHZ)
+	}
+	for _, m := range kernelMetrics {
+		h.w.header(m.name, m.help, m.typ)
+		h.w.sample(m.name, "", "", float64(m.value(&h.cpuStat)))
+	}
+}
+
+var kernelMetrics = []struct {
+	name  string
+	help  string
+	typ   string
+	value func(s *sysstat.RawCPUStat) uint64
+}{
+	{"sysstat_context_switches_total", "Number of context switches.", "counter", func(s *sysstat.RawCPUStat) uint64 { return s.Ctxt }},
+	{"sysstat_interrupts_total", "Number of interrupts serviced.", "counter", func(s *sysstat.RawCPUStat) uint64 { return s.Intr }},
+	{"sysstat_forks_total", "Number of processes and threads created.", "counter", func(s *sysstat.RawCPUStat) uint64 { return s.Processes }},
+	{"sysstat_procs_running", "Number of runnable threads.", "gauge", func(s *sysstat.RawCPUStat) uint64 { return s.ProcsRunning }},
+	{"sysstat_procs_blocked", "Number of threads blocked waiting for I/O.", "gauge", func(s *sysstat.RawCPUStat) uint64 { return s.ProcsBlocked }},
+	{"sysstat_boot_time_seconds", "Boot time in seconds since the Unix epoch.", "gauge", func(s *sysstat.RawCPUStat) uint64 { return s.BootTime }},
+}
+
+var memoryMetrics = []struct {
+	name  string
+	help  string
+	value func(s *sysstat.MemoryStat) uint64
+}{
+	{"sysstat_memory_total_bytes", "Total usable memory in bytes.", func(s *sysstat.MemoryStat) uint64 { return s.MemTotal }},
+	{"sysstat_memory_free_bytes", "Free memory in bytes.", func(s *sysstat.MemoryStat) uint64 { return s.MemFree }},
+	{"sysstat_memory_available_bytes", "Estimated available memory for new applications in bytes.", func(s *sysstat.MemoryStat) uint64 { return s.MemAvailable }},
+	{"sysstat_memory_buffers_bytes", "Memory used for block device buffers in bytes.", func(s *sysstat.MemoryStat) uint64 { return s.Buffers }},
+	{"sysstat_memory_cached_bytes", "Memory used for page cache in bytes.", func(s *sysstat.MemoryStat) uint64 { return s.Cached }},
+	{"sysstat_memory_swap_cached_bytes", "Swapped out memory which is also in memory in bytes.", func(s *sysstat.MemoryStat) uint64 { return s.SwapCached }},
+	{"sysstat_memory_swap_total_bytes", "Total swap space in bytes.", func(s *sysstat.MemoryStat) uint64 { return s.SwapTotal }},
+	{"sysstat_memory_swap_free_bytes", "Free swap space in bytes.", func(s *sysstat.MemoryStat) uint64 { return s.SwapFree }},
+}
+
+func (h *Handler) writeMemoryMetrics() {
+	for _, m := range memoryMetrics {
+		h.w.header(m.name, m.help, "gauge")
+		h.w.sample(m.name, "", "", float64(m.value(&h.memoryStat)))
+	}
+}
+
+var diskMetrics = []struct {
+	name  string
+	help  string
+	typ   string
+	value func(s *sysstat.RawDiskStat) float64
+}{
+	{"sysstat_disk_reads_completed_total", "Number of reads completed successfully.", "counter",
+		func(s *sysstat.RawDiskStat) float64 { return float64(s.RdIOs) }},
+	{"sysstat_disk_reads_merged_total", "Number of reads merged.", "counter",
+		func(s *sysstat.RawDiskStat) float64 { return float64(s.RdMerges) }},
+	{"sysstat_disk_read_bytes_total", "Number of bytes read successfully.", "counter",
+		func(s *sysstat.RawDiskStat) float64 { return float64(s.RdSect) * sectorBytes }},
+	{"sysstat_disk_read_time_seconds_total", "Seconds spent by all reads.", "counter",
+		func(s *sysstat.RawDiskStat) float64 { return float64(s.RdTicks) / 1000 }},
+	{"sysstat_disk_writes_completed_total", "Number of writes completed successfully.", "counter",
+		func(s *sysstat.RawDiskStat) float64 { return float64(s.WrIOs) }},
+	{"sysstat_disk_writes_merged_total", "Number of writes merged.", "counter",
+		func(s *sysstat.RawDiskStat) float64 { return float64(s.WrMerges) }},
+	{"sysstat_disk_written_bytes_total", "Number of bytes written successfully.", "counter",
+		func(s *sysstat.RawDiskStat) float64 { return float64(s.WrSect) * sectorBytes }},
+	{"sysstat_disk_write_time_seconds_total", "Seconds spent by all writes.", "counter",
+		func(s *sysstat.RawDiskStat) float64 { return float64(s.WrTicks) / 1000 }},
+	{"sysstat_disk_io_now", "Number of I/Os currently in progress.", "gauge",
+		func(s *sysstat.RawDiskStat) float64 { return float64(s.IOsPgr) }},
+	{"sysstat_disk_io_time_seconds_total", "Seconds spent doing I/Os.", "counter",
+		func(s *sysstat.RawDiskStat) float64 { return float64(s.TotTicks) / 1000 }},
+	{"sysstat_disk_io_time_weighted_seconds_total", "Weighted seconds spent doing I/Os.", "counter",
+		func(s *sysstat.RawDiskStat) float64 { return float64(s.RqTicks) / 1000 }},
+	{"sysstat_disk_discards_completed_total", "Number of discards completed successfully.", "counter",
+		func(s *sysstat.RawDiskStat) float64 { return float64(s.DcIOs) }},
+	{"sysstat_disk_discards_merged_total", "Number of discards merged.", "counter",
+		func(s *sysstat.RawDiskStat) float64 { return float64(s.DcMerges) }},
+	{"sysstat_disk_discarded_bytes_total", "Number of bytes discarded successfully.", "counter",
+		func(s *sysstat.RawDiskStat) float64 { return float64(s.DcSect) * sectorBytes }},
+	{"sysstat_disk_discard_time_seconds_total", "Seconds spent by all discards.", "counter",
+		func(s *sysstat.RawDiskStat) float64 { return float64(s.DcTicks) / 1000 }},
+	{"sysstat_disk_flush_requests_total", "Number of flush requests completed successfully.", "counter",
+		func(s *sysstat.RawDiskStat) float64 { return float64(s.FlIOs) }},
+	{"sysstat_disk_flush_requests_time_seconds_total", "Seconds spent by all flush requests.", "counter",
+		func(s *sysstat.RawDiskStat) float64 { return float64(s.FlTicks) / 1000 }},
+}
+
+func (h *Handler) writeDiskMetrics() {
+	if len(h.diskStats) == 0 {
+		return
+	}
+	for _, m := range diskMetrics {
+		h.w.header(m.name, m.help, m.typ)
+		for i := range h.diskStats {
+			s := &h.diskStats[i]
+			h.w.sample(m.name, "device", s.DevName, m.value(s))
+		}
+	}
+}
+
+var networkMetrics = []struct {
+	name  string
+	help  string
+	value func(s *sysstat.RawNetworkStat) uint64
+}{
+	{"sysstat_network_receive_bytes_total", "Number of bytes received.", func(s *sysstat.RawNetworkStat) uint64 { return s.RecvBytes }},
+	{"sysstat_network_receive_packets_total", "Number of packets received.", func(s *sysstat.RawNetworkStat) uint64 { return s.RecvPackets }},
+	{"sysstat_network_receive_errs_total", "Number of receive errors.", func(s *sysstat.RawNetworkStat) uint64 { return s.RecvErrs }},
+	{"sysstat_network_receive_drop_total", "Number of received packets dropped.", func(s *sysstat.RawNetworkStat) uint64 { return s.RecvDrops }},
+	{"sysstat_network_transmit_bytes_total", "Number of bytes transmitted.", func(s *sysstat.RawNetworkStat) uint64 { return s.TransBytes }},
+	{"sysstat_network_transmit_packets_total", "Number of packets transmitted.", func(s *sysstat.RawNetworkStat) uint64 { return s.TransPackets }},
+	{"sysstat_network_transmit_errs_total", "Number of transmit errors.", func(s *sysstat.RawNetworkStat) uint64 { return s.TransErrs }},
+	{"sysstat_network_transmit_drop_total", "Number of transmitted packets dropped.", func(s *sysstat.RawNetworkStat) uint64 { return s.TransDrops }},
+	{"sysstat_network_transmit_colls_total", "Number of collisions on transmit.", func(s *sysstat.RawNetworkStat) uint64 { return s.TransColls }},
+}
+
+func (h *Handler) writeNetworkMetrics() {
+	if len(h.networkStats) == 0 {
+		return
+	}
+	for _, m := range networkMetrics {
+		h.w.header(m.name, m.help, "counter")
+		for i := range h.networkStats {
+			s := &h.networkStats[i]
+			h.w.sample(m.name, "device", s.DevName, float64(m.value(s)))
+		}
+	}
+}
+
+func (h *Handler) writeLoadAvgMetrics() {
+	h.w.header("sysstat_load1", "1 minute load average.", "gauge")
+	h.w.sample("sysstat_load1", "", "", h.loadAvg.Load1)
+	h.w.header("sysstat_load5", "5 minutes load average.", "gauge")
+	h.w.sample("sysstat_load5", "", "", h.loadAvg.Load5)
+	h.w.header("sysstat_load15", "15 minutes load average.", "gauge")
+	h.w.sample("sysstat_load15", "", "", h.loadAvg.Load15)
+}
+
+func (h *Handler) writeUptimeMetrics() {
+	h.w.header("sysstat_uptime_seconds", "Seconds elapsed since boot.", "gauge")
+	h.w.sample("sysstat_uptime_seconds", "", "", h.uptime.Uptime)
+}
+
+var fileSystemMetrics = []struct {
+	name  string
+	help  string
+	value func(s *sysstat.FileSystemStat) float64
+}{
+	{"sysstat_filesystem_size_bytes", "Filesystem size in bytes.",
+		func(s *sysstat.FileSystemStat) float64 { return float64(s.TotalBlocks * s.BlockSize) }},
+	{"sysstat_filesystem_free_bytes", "Filesystem free space in bytes.",
+		func(s *sysstat.FileSystemStat) float64 { return float64(s.FreeBlocks * s.BlockSize) }},
+	{"sysstat_filesystem_avail_bytes", "Filesystem space available to non-root users in bytes.",
+		func(s *sysstat.FileSystemStat) float64 { return float64(s.AvailableBlocks * s.BlockSize) }},
+	{"sysstat_filesystem_used_bytes", "Filesystem used space in bytes.",
+		func(s *sysstat.FileSystemStat) float64 { return float64(s.UsedBytes) }},
+	{"sysstat_filesystem_files", "Filesystem total file nodes.",
+		func(s *sysstat.FileSystemStat) float64 { return float64(s.TotalINodes) }},
+	{"sysstat_filesystem_files_free", "Filesystem free file nodes.",
+		func(s *sysstat.FileSystemStat) float64 { return float64(s.FreeINodes) }},
+	{"sysstat_filesystem_used_percent", "Filesystem used space in percent of the used space plus the space available to non-root users like Use% of df.",
+		func(s *sysstat.FileSystemStat) float64 { return s.UsedPercent }},
+	{"sysstat_filesystem_files_used_percent", "Filesystem used file nodes in percent.",
+		func(s *sysstat.FileSystemStat) float64 { return s.INodesUsedPercent }},
+}
+
+var fileSystemForecastMetrics = []struct {
+	name  string
+	help  string
+	value func(s *sysstat.FileSystemStat) float64
+}{
+	{"sysstat_filesystem_fill_bytes_per_second", "Estimated rate of decrease of the space available to non-root users in bytes per second.",
+		func(s *sysstat.FileSystemStat) float64 { return s.FillBytesPerSec }},
+	{"sysstat_filesystem_time_until_full_seconds", "Estimated seconds until no space is available to non-root users, or 0 if the available space is not decreasing.",
+		func(s *sysstat.FileSystemStat) float64 { return s.TimeUntilFull.Seconds() }},
+}
+
+func (h *Handler) writeFileSystemMetrics() {
+	if len(h.fsStats) == 0 {
+		return
+	}
+	for _, m := range fileSystemMetrics {
+		h.w.header(m.name, m.help, "gauge")
+		for i := range h.fsStats {
+			h.w.sample(m.name, "mountpoint", h.fsStats[i].MountPoint, m.value(&h.fsStats[i]))
+		}
+	}
+	if !h.fsForecast {
+		return
+	}
+	for _, m := range fileSystemForecastMetrics {
+		h.w.header(m.name, m.help, "gauge")
+		for i := range h.fsStats {
+			h.w.sample(m.name, "mountpoint", h.fsStats[i].MountPoint, m.value(&h.fsStats[i]))
+		}
+	}
+}
+
+// expositionWriter appends metrics in the Prometheus text exposition format
+// to buf, which is reused between writes.
+type expositionWriter struct {
+	buf []byte
+}
+
+func (w *expositionWriter) reset() {
+	w.buf = w.buf[:0]
+}
+
+func (w *expositionWriter) header(name, help, typ string) {
+	w.buf = append(w.buf, "# HELP "...)
+	w.buf = append(w.buf, name...)
+	w.buf = append(w.buf, ' ')
+	w.buf = append(w.buf, help...)
+	w.buf = append(w.buf, "\n# TYPE "...)
+	w.buf = append(w.buf, name...)
+	w.buf = append(w.buf, ' ')
+	w.buf = append(w.buf, typ...)
+	w.buf = append(w.buf, '\n')
+}
+
+// sample appends a sample. The label is omitted if labelName is empty.
+func (w *expositionWriter) sample(name, labelName, labelValue string, value float64) {
+	w.buf = append(w.buf, name...)
+	if labelName != "" {
+		w.buf = append(w.buf, '{')
+		w.buf = append(w.buf, labelName...)
+		w.buf = append(w.buf, `="`...)
+		w.appendEscapedLabelValue(labelValue)
+		w.buf = append(w.buf, `"}`...)
+	}
+	w.buf = append(w.buf, ' ')
+	w.buf = strconv.AppendFloat(w.buf, value, 'g', -1, 64)
+	w.buf = append(w.buf, '\n')
+}
+
+func (w *expositionWriter) appendEscapedLabelValue(v string) {
+	for i := 0; i < len(v); i++ {
+		switch c := v[i]; c {
+		case '\\':
+			w.buf = append(w.buf, `\\`...)
+		case '"':
+			w.buf = append(w.buf, `\"`...)
+		case '\n':
+			w.buf = append(w.buf, `\n`...)
+		default:
+			w.buf = append(w.buf, c)
+		}
+	}
+}
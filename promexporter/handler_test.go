@@ -0,0 +1,154 @@
+package promexporter
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hnakamur/sysstat"
+)
+
+func writeProcFiles(t *testing.T) string {
+	procRoot := t.TempDir()
+	files := map[string]string{
+		"stat": `cpu  70688924 148688 17620091 2036888025 2351467 0 1426771 0 18331249 0
+cpu0 35370168 74531 8761044 1019034230 1255954 0 443050 0 9172844 0
+ctxt 11431573079
+btime 1494729939
+procs_running 3
+`,
+		"meminfo": `MemTotal:       16260508 kB
+MemFree:          543220 kB
+MemAvailable:    6990124 kB
+Buffers:         1931976 kB
+Cached:          5597668 kB
+SwapCached:         7168 kB
+SwapTotal:      16600572 kB
+SwapFree:       16582724 kB
+`,
+		"diskstats": `   7       0 loop0 10373 0 25194 476 0 0 0 0 0 124 476
+   8       0 sda 18115828 30368 4557439074 74915904 2432358 2630 480699421 5326092 0 42767900 80233776
+`,
+		"net/dev": `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+   br0: 329426402871 130478210    2    1    0     0          0         0 27152202131 88015716    3    4    5     0       0          0
+`,
+		"loadavg": "1.31 1.39 1.43 2/1081 24188\n",
+		"uptime":  "10654673.98 20455002.81\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(procRoot, name)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return procRoot
+}
+
+func TestHandler(t *testing.T) {
+	h, err := NewHandler(Config{
+		DiskFilter:         sysstat.DeviceFilter{Exclude: []string{"loop*"}},
+		MountPoints:        []string{"/"},
+		FileSystemForecast: 10,
+		Options:            []sysstat.Option{sysstat.WithProcRoot(writeProcFiles(t))},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != 200 {
+		t.Fatalf("status code unmatch, got %d, want %d, body=%s", rec.Code, 200, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); got != contentType {
+		t.Errorf("content type unmatch, got %s, want %s", got, contentType)
+	}
+
+	body := rec.Body.String()
+	wantLines := []string{
+		"# TYPE sysstat_cpu_seconds_total counter",
+		`sysstat_cpu_seconds_total{mode="user"} 523576.75`,
+		`sysstat_cpu_seconds_total{mode="guest"} 183312.49`,
+		"# TYPE sysstat_context_switches_total counter",
+		"sysstat_context_switches_total 1.1431573079e+10",
+		"sysstat_procs_running 3",
+		"# TYPE sysstat_memory_total_bytes gauge",
+		"sysstat_memory_total_bytes 1.6650760192e+10",
+		"# TYPE sysstat_disk_reads_completed_total counter",
+		`sysstat_disk_reads_completed_total{device="sda"} 1.8115828e+07`,
+		`sysstat_disk_read_bytes_total{device="sda"} 2.333408805888e+12`,
+		`sysstat_network_receive_bytes_total{device="br0"} 3.29426402871e+11`,
+		"sysstat_load1 1.31",
+		"sysstat_uptime_seconds 1.065467398e+07",
+		"# TYPE sysstat_filesystem_size_bytes gauge",
+		"# TYPE sysstat_filesystem_used_percent gauge",
+		"# TYPE sysstat_filesystem_fill_bytes_per_second gauge",
+		"# TYPE sysstat_filesystem_time_until_full_seconds gauge",
+	}
+	for _, want := range wantLines {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("line not found: %s", want)
+		}
+	}
+	if strings.Contains(body, `device="loop0"`) {
+		t.Error("excluded device loop0 found")
+	}
+	if !strings.Contains(body, `sysstat_filesystem_size_bytes{mountpoint="/"} `) {
+		t.Error("filesystem size for / not found")
+	}
+	if !strings.Contains(body, `sysstat_filesystem_used_percent{mountpoint="/"} `) {
+		t.Error("filesystem used percent for / not found")
+	}
+}
+
+func TestExpositionWriter_appendEscapedLabelValue(t *testing.T) {
+	var w expositionWriter
+	w.appendEscapedLabelValue("a\\b\"c\nd")
+	want := `a\\b\"c\nd`
+	if got := string(w.buf); got != want {
+		t.Errorf("escaped label value unmatch, got %s, want %s", got, want)
+	}
+}
+
+func TestHandler_ReadError(t *testing.T) {
+	procRoot := writeProcFiles(t)
+	h, err := NewHandler(Config{
+		Options: []sysstat.Option{sysstat.WithProcRoot(procRoot)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	err = os.Remove(filepath.Join(procRoot, "loadavg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != 200 {
+		t.Fatalf("status code unmatch, got %d, want %d, body=%s", rec.Code, 200, rec.Body.String())
+	}
+
+	body := rec.Body.String()
+	wantLines := []string{
+		`sysstat_scrape_collector_success{collector="loadavg"} 0`,
+		`sysstat_scrape_collector_success{collector="uptime"} 1`,
+		"sysstat_uptime_seconds 1.065467398e+07",
+	}
+	for _, want := range wantLines {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("line not found: %s", want)
+		}
+	}
+	if strings.Contains(body, "sysstat_load1") {
+		t.Error("load average found despite the read error")
+	}
+}
@@ -0,0 +1,173 @@
+package sysstat
+
+import (
+	"bytes"
+	"syscall"
+	"time"
+
+	"github.com/hnakamur/ascii"
+	"github.com/hnakamur/bytesconv"
+)
+
+// PSIStat is Pressure Stall Information of CPU, memory and IO.
+// https://www.kernel.org/doc/html/latest/accounting/psi.html
+type PSIStat struct {
+	CPU    PressureStat
+	Memory PressureStat
+	IO     PressureStat
+}
+
+// PressureStat is the pressure of a resource.
+// Some is the share of time in which at least some tasks are stalled,
+// and Full is the share of time in which all non-idle tasks are stalled
+// simultaneously. Full of CPU is available on Linux 5.13 or later and is
+// zero on older kernels.
+type PressureStat struct {
+	Some PressureLine
+	Full PressureLine
+}
+
+// PressureLine is a line in a pressure file.
+type PressureLine struct {
+	// Avg10, Avg60 and Avg300 are stall time percentages averaged over
+	// 10, 60 and 300 seconds, computed by the kernel.
+	Avg10  float64
+	Avg60  float64
+	Avg300 float64
+	// Total is the cumulative stall time in microseconds.
+	Total uint64
+	// StallMicrosPerSec is the stall time in microseconds per second
+	// between the last two reads.
+	StallMicrosPerSec float64
+}
+
+// PSIReader reads Pressure Stall Information in /proc/pressure.
+// PSIReader is not safe for concurrent accesses from multiple goroutines.
+type PSIReader struct {
+	buf        []byte
+	prev       PSIStat
+	prevTime   time.Time
+	cpuPath    []byte
+	memoryPath []byte
+	ioPath     []byte
+}
+
+// NewPSIReader creates a PSIReader and does an initial read.
+// It returns ErrPSIUnavailable if PSI is not supported or disabled.
+func NewPSIReader(opts ...Option) (*PSIReader, error) {
+	o := newOptions(opts)
+	r := &PSIReader{
+		cpuPath:    o.procPath("pressure", "cpu"),
+		memoryPath: o.procPath("pressure", "memory"),
+		ioPath:     o.procPath("pressure", "io"),
+	}
+	err := r.readPSIStat(&r.prev)
+	if err != nil {
+		return nil, err
+	}
+	r.prevTime = time.Now()
+	return r, nil
+}
+
+// Read reads Pressure Stall Information.
+func (r *PSIReader) Read(s *PSIStat) error {
+	err := r.readPSIStat(s)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	intervalSeconds := float64(now.Sub(r.prevTime)) / float64(time.Second)
+	calcPressureStat(&s.CPU, &r.prev.CPU, intervalSeconds)
+	calcPressureStat(&s.Memory, &r.prev.Memory, intervalSeconds)
+	calcPressureStat(&s.IO, &r.prev.IO, intervalSeconds)
+	r.prev = *s
+	r.prevTime = now
+	return nil
+}
+
+func (r *PSIReader) readPSIStat(s *PSIStat) error {
+	err := readPressure(r.cpuPath, &r.buf, &s.CPU)
+	if err != nil {
+		return err
+	}
+	err = readPressure(r.memoryPath, &r.buf, &s.Memory)
+	if err != nil {
+		return err
+	}
+	return readPressure(r.ioPath, &r.buf, &s.IO)
+}
+
+// readPressure reads a pressure file at path, which must be terminated
+// with NUL. It is used for both /proc/pressure and cgroup v2 *.pressure files.
+func readPressure(path []byte, buf *[]byte, p *PressureStat) error {
+	b, err := readFile(path, buf)
+	if err != nil {
+		if err == syscall.ENOENT || err == syscall.EOPNOTSUPP {
+			return ErrPSIUnavailable
+		}
+		return err
+	}
+	return parsePressure(b, p)
+}
+
+// parsePressure parses the content of a pressure file like below.
+// StallMicrosPerSec is not modified.
+//
+//	some avg10=0.00 avg60=0.12 avg300=0.05 total=1234567
+//	full avg10=0.00 avg60=0.03 avg300=0.01 total=345678
+func parsePressure(buf []byte, p *PressureStat) error {
+	p.Full.Avg10, p.Full.Avg60, p.Full.Avg300, p.Full.Total = 0, 0, 0, 0
+	for len(buf) > 0 {
+		line := ascii.GetLine(buf)
+		buf = buf[len(line):]
+		start, end := ascii.NextField(line)
+		var l *PressureLine
+		switch string(line[start:end]) {
+		case "some":
+			l = &p.Some
+		case "full":
+			l = &p.Full
+		default:
+			continue
+		}
+		line = line[end:]
+		for {
+			start, end = ascii.NextField(line)
+			if start == end {
+				break
+			}
+			err := l.parseKeyValue(line[start:end])
+			if err != nil {
+				return err
+			}
+			line = line[end:]
+		}
+	}
+	return nil
+}
+
+func (l *PressureLine) parseKeyValue(field []byte) error {
+	i := bytes.IndexByte(field, '=')
+	if i == -1 {
+		return ErrUnexpectedFormat
+	}
+	key, val := field[:i], field[i+1:]
+	var err error
+	switch string(key) {
+	case "avg10":
+		l.Avg10, err = bytesconv.ParseFloat(val, 64)
+	case "avg60":
+		l.Avg60, err = bytesconv.ParseFloat(val, 64)
+	case "avg300":
+		l.Avg300, err = bytesconv.ParseFloat(val, 64)
+	case "total":
+		l.Total, err = bytesconv.ParseUint(val, 10, 64)
+	}
+	return err
+}
+
+func calcPressureStat(s, prev *PressureStat, intervalSeconds float64) {
+	s.Some.StallMicrosPerSec = counterRate(prev.Some.Total, s.Some.Total, intervalSeconds)
+	s.Full.StallMicrosPerSec = counterRate(prev.Full.Total, s.Full.Total, intervalSeconds)
+}
@@ -0,0 +1,92 @@
+package sysstat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParsePressure(t *testing.T) {
+	buf := []byte(`some avg10=1.53 avg60=0.87 avg300=0.25 total=4370213
+full avg10=0.50 avg60=0.21 avg300=0.06 total=1536578
+`)
+	var p PressureStat
+	err := parsePressure(buf, &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PressureStat{
+		Some: PressureLine{Avg10: 1.53, Avg60: 0.87, Avg300: 0.25, Total: 4370213},
+		Full: PressureLine{Avg10: 0.50, Avg60: 0.21, Avg300: 0.06, Total: 1536578},
+	}
+	if p != want {
+		t.Errorf("pressure unmatch, got %+v, want %+v", p, want)
+	}
+
+	// CPU pressure on kernels older than 5.13 has only the some line.
+	err = parsePressure([]byte("some avg10=0.00 avg60=0.00 avg300=0.00 total=100\n"), &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Some.Total != 100 || p.Full != (PressureLine{}) {
+		t.Errorf("pressure unmatch, got %+v", p)
+	}
+}
+
+func TestPSIReader(t *testing.T) {
+	procRoot := t.TempDir()
+	_, err := NewPSIReader(WithProcRoot(procRoot))
+	if err != ErrPSIUnavailable {
+		t.Errorf("error unmatch, got %v, want %v", err, ErrPSIUnavailable)
+	}
+
+	dir := filepath.Join(procRoot, "pressure")
+	err = os.Mkdir(dir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"cpu", "memory", "io"} {
+		err = os.WriteFile(filepath.Join(dir, name),
+			[]byte("some avg10=0.00 avg60=0.00 avg300=0.00 total=1000\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=500\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := NewPSIReader(WithProcRoot(procRoot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "io"),
+		[]byte("some avg10=0.00 avg60=0.00 avg300=0.00 total=2000\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=900\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s PSIStat
+	err = r.Read(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.IO.Some.StallMicrosPerSec <= 0 || s.IO.Full.StallMicrosPerSec <= 0 {
+		t.Errorf("IO stall rates must be positive, got %+v", s.IO)
+	}
+	if s.CPU.Some.StallMicrosPerSec != 0 {
+		t.Errorf("CPU some stall rate unmatch, got %g, want 0", s.CPU.Some.StallMicrosPerSec)
+	}
+}
+
+func BenchmarkPSIReader_Read(b *testing.B) {
+	r, err := NewPSIReader()
+	if err == ErrPSIUnavailable {
+		b.Skip(err)
+	}
+	if err != nil {
+		b.Fatal(err)
+	}
+	var s PSIStat
+	for i := 0; i < b.N; i++ {
+		err = r.Read(&s)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package sysstat
+
+import (
+	"github.com/hnakamur/ascii"
+	"github.com/hnakamur/bytesconv"
+)
+
+// SocketStat is a statistics about socket usage in /proc/net/sockstat and
+// /proc/net/sockstat6. The values are gauges at the time of reading.
+type SocketStat struct {
+	// SocketsUsed is the number of sockets in use of all protocols.
+	SocketsUsed uint64
+
+	// TCPInUse is the number of IPv4 TCP sockets in use including
+	// listening ones. IPv6 ones are counted in TCP6InUse, while the other
+	// TCP values include both IPv4 and IPv6 sockets.
+	TCPInUse uint64
+	// TCPOrphan is the number of TCP sockets not attached to any file
+	// descriptor, for example, ones closed by applications but still
+	// sending data or waiting for FIN.
+	TCPOrphan uint64
+	// TCPTimeWait is the number of TCP sockets in the TIME_WAIT state.
+	TCPTimeWait uint64
+	// TCPAlloc is the number of allocated TCP sockets including orphan ones.
+	TCPAlloc uint64
+	// TCPMemPages is the memory in pages used by TCP buffers, which is
+	// compared with net.ipv4.tcp_mem.
+	TCPMemPages uint64
+
+	// UDPInUse is the number of IPv4 UDP sockets in use.
+	UDPInUse uint64
+	// UDPMemPages is the memory in pages used by UDP buffers, which is
+	// compared with net.ipv4.udp_mem.
+	UDPMemPages uint64
+	// UDPLiteInUse is the number of IPv4 UDP-Lite sockets in use.
+	UDPLiteInUse uint64
+	// RawInUse is the number of IPv4 raw sockets in use.
+	RawInUse uint64
+	// FragInUse is the number of IPv4 fragment reassembly queues.
+	FragInUse uint64
+	// FragMemoryBytes is the memory in bytes used for IPv4 reassembly.
+	FragMemoryBytes uint64
+
+	// The following values are zero if IPv6 is disabled, in which case
+	// /proc/net/sockstat6 does not exist.
+	TCP6InUse        uint64
+	UDP6InUse        uint64
+	UDPLite6InUse    uint64
+	Raw6InUse        uint64
+	Frag6InUse       uint64
+	Frag6MemoryBytes uint64
+}
+
+// SocketStatReader is a reader for socket usage.
+// SocketStatReader is not safe for concurrent accesses from multiple goroutines.
+type SocketStatReader struct {
+	buf      []byte
+	path     []byte
+	ipv6Path []byte
+}
+
+// NewSocketStatReader creates a SocketStatReader.
+func NewSocketStatReader(opts ...Option) *SocketStatReader {
+	o := newOptions(opts)
+	return &SocketStatReader{
+		path:     o.procPath("net", "sockstat"),
+		ipv6Path: o.procPath("net", "sockstat6"),
+	}
+}
+
+// Read reads the socket usage.
+func (r *SocketStatReader) Read(s *SocketStat) error {
+	*s = SocketStat{}
+	buf, err := readFile(r.path, &r.buf)
+	if err != nil {
+		return err
+	}
+	err = s.parse(buf)
+	if err != nil {
+		return err
+	}
+
+	buf, err = readOptionalFile(r.ipv6Path, &r.buf)
+	if err != nil {
+		return err
+	}
+	return s.parse(buf)
+}
+
+// parse parses /proc/net/sockstat or /proc/net/sockstat6 like below.
+//
+//	sockets: used 19
+//	TCP: inuse 4 orphan 0 tw 0 alloc 4 mem 0
+//	UDP: inuse 0 mem 0
+//	FRAG: inuse 0 memory 0
+func (s *SocketStat) parse(buf []byte) error {
+	for len(buf) > 0 {
+		line := ascii.GetLine(buf)
+		buf = buf[len(line):]
+		start, end := ascii.NextField(line)
+		group := line[start:end]
+		line = line[end:]
+		for {
+			start, end := ascii.NextField(line)
+			if start == end {
+				break
+			}
+			key := line[start:end]
+			line = line[end:]
+			start, end = ascii.NextField(line)
+			if start == end {
+				return ErrUnexpectedFormat
+			}
+			value := line[start:end]
+			line = line[end:]
+
+			ptr := s.counterByName(group, key)
+			if ptr == nil {
+				continue
+			}
+			v, err := bytesconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return err
+			}
+			*ptr = v
+		}
+	}
+	return nil
+}
+
+// counterByName returns the pointer to the value for the group like "TCP:"
+// and key, or nil for the values not interested in.
+func (s *SocketStat) counterByName(group, key []byte) *uint64 {
+	switch string(group) {
+	case "sockets:":
+		if string(key) == "used" {
+			return &s.SocketsUsed
+		}
+	case "TCP:":
+		switch string(key) {
+		case "inuse":
+			return &s.TCPInUse
+		case "orphan":
+			return &s.TCPOrphan
+		case "tw":
+			return &s.TCPTimeWait
+		case "alloc":
+			return &s.TCPAlloc
+		case "mem":
+			return &s.TCPMemPages
+		}
+	case "UDP:":
+		switch string(key) {
+		case "inuse":
+			return &s.UDPInUse
+		case "mem":
+			return &s.UDPMemPages
+		}
+	case "UDPLITE:":
+		if string(key) == "inuse" {
+			return &s.UDPLiteInUse
+		}
+	case "RAW:":
+		if string(key) == "inuse" {
+			return &s.RawInUse
+		}
+	case "FRAG:":
+		switch string(key) {
+		case "inuse":
+			return &s.FragInUse
+		case "memory":
+			return &s.FragMemoryBytes
+		}
+	case "TCP6:":
+		if string(key) == "inuse" {
+			return &s.TCP6InUse
+		}
+	case "UDP6:":
+		if string(key) == "inuse" {
+			return &s.UDP6InUse
+		}
+	case "UDPLITE6:":
+		if string(key) == "inuse" {
+			return &s.UDPLite6InUse
+		}
+	case "RAW6:":
+		if string(key) == "inuse" {
+			return &s.Raw6InUse
+		}
+	case "FRAG6:":
+		switch string(key) {
+		case "inuse":
+			return &s.Frag6InUse
+		case "memory":
+			return &s.Frag6MemoryBytes
+		}
+	}
+	return nil
+}
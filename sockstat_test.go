@@ -0,0 +1,82 @@
+package sysstat
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSocketStatReader_Read(t *testing.T) {
+	procRoot := t.TempDir()
+	dir := filepath.Join(procRoot, "net")
+	writeFiles(t, dir, map[string]string{
+		"sockstat": `sockets: used 1019
+TCP: inuse 40 orphan 3 tw 2500 alloc 60 mem 120
+UDP: inuse 5 mem 7
+UDPLITE: inuse 1
+RAW: inuse 2
+FRAG: inuse 4 memory 8192
+`,
+		"sockstat6": `TCP6: inuse 11
+UDP6: inuse 12
+UDPLITE6: inuse 13
+RAW6: inuse 14
+FRAG6: inuse 15 memory 4096
+`,
+	})
+	r := NewSocketStatReader(WithProcRoot(procRoot))
+	var s SocketStat
+	err := r.Read(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := SocketStat{
+		SocketsUsed:      1019,
+		TCPInUse:         40,
+		TCPOrphan:        3,
+		TCPTimeWait:      2500,
+		TCPAlloc:         60,
+		TCPMemPages:      120,
+		UDPInUse:         5,
+		UDPMemPages:      7,
+		UDPLiteInUse:     1,
+		RawInUse:         2,
+		FragInUse:        4,
+		FragMemoryBytes:  8192,
+		TCP6InUse:        11,
+		UDP6InUse:        12,
+		UDPLite6InUse:    13,
+		Raw6InUse:        14,
+		Frag6InUse:       15,
+		Frag6MemoryBytes: 4096,
+	}
+	if s != want {
+		t.Errorf("stat unmatch,\n got=%+v,\nwant=%+v", s, want)
+	}
+}
+
+func TestSocketStatReader_ReadWithoutIPv6(t *testing.T) {
+	procRoot := t.TempDir()
+	writeFiles(t, filepath.Join(procRoot, "net"), map[string]string{
+		"sockstat": "sockets: used 3\nTCP: inuse 1 orphan 0 tw 0 alloc 1 mem 0\n",
+	})
+	r := NewSocketStatReader(WithProcRoot(procRoot))
+	s := SocketStat{TCP6InUse: 1}
+	err := r.Read(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.SocketsUsed != 3 || s.TCPInUse != 1 || s.TCP6InUse != 0 {
+		t.Errorf("stat unmatch, got %+v", s)
+	}
+}
+
+func BenchmarkSocketStatReader_Read(b *testing.B) {
+	var s SocketStat
+	r := NewSocketStatReader()
+	for i := 0; i < b.N; i++ {
+		err := r.Read(&s)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
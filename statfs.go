@@ -0,0 +1,107 @@
+package sysstat
+
+import (
+	"syscall"
+	"time"
+)
+
+// WithStatfsTimeout sets the timeout of statfs for FileSystemStatReader.
+// statfs on an unresponsive NFS server can block for a long time, so
+// statfs is called in a goroutine for each filesystem and ErrStatfsTimeout
+// is returned if it does not return within d. While statfs for
+// a filesystem is blocked, ErrStatfsTimeout is returned immediately for the
+// filesystem without calling statfs again. When the blocked statfs returns
+// later, its result is used for the next read. The default is zero, which
+// means statfs is called without a timeout in the goroutine of the caller.
+// Call Close of the reader to stop the goroutines.
+func WithStatfsTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.statfsTimeout = d
+	}
+}
+
+// statfsWorker calls statfs in a goroutine.
+type statfsWorker struct {
+	req chan struct{}
+	res chan statfsResult
+	// statfsFunc is statfs, which is replaced in tests.
+	statfsFunc func(path []byte, buf *syscall.Statfs_t) error
+	// pending is true if the result of the last request is not received yet.
+	pending bool
+}
+
+type statfsResult struct {
+	buf syscall.Statfs_t
+	err error
+}
+
+func newStatfsWorker(path []byte) *statfsWorker {
+	w := &statfsWorker{
+		req: make(chan struct{}),
+		// res is buffered so that the goroutine does not block when
+		// the request has timed out.
+		res:        make(chan statfsResult, 1),
+		statfsFunc: statfs,
+	}
+	go w.run(path)
+	return w
+}
+
+func (w *statfsWorker) run(path []byte) {
+	// r is reused since it escapes to the heap.
+	var r statfsResult
+	for range w.req {
+		r.err = w.statfsFunc(path, &r.buf)
+		w.res <- r
+	}
+}
+
+// statfs requests statfs to the goroutine and waits for the result up to
+// timeout. *timer is created at the first call and reused.
+// If the last request timed out, statfs returns its result if it has
+// arrived, or ErrStatfsTimeout without a new request otherwise.
+func (w *statfsWorker) statfs(buf *syscall.Statfs_t, timeout time.Duration, timer **time.Timer) error {
+	if w.pending {
+		select {
+		case r := <-w.res:
+			w.pending = false
+			*buf = r.buf
+			return r.err
+		default:
+			return ErrStatfsTimeout
+		}
+	}
+
+	w.req <- struct{}{}
+	if *timer == nil {
+		*timer = time.NewTimer(timeout)
+	} else {
+		resetTimer(*timer, timeout)
+	}
+	select {
+	case r := <-w.res:
+		*buf = r.buf
+		return r.err
+	case <-(*timer).C:
+		w.pending = true
+		return ErrStatfsTimeout
+	}
+}
+
+// close stops the goroutine. It is safe to call close for a nil worker.
+func (w *statfsWorker) close() {
+	if w != nil {
+		close(w.req)
+	}
+}
+
+// resetTimer stops t, drains its channel if needed and resets it to d.
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
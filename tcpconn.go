@@ -0,0 +1,296 @@
+package sysstat
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+
+	"github.com/hnakamur/ascii"
+	"github.com/hnakamur/bytesconv"
+)
+
+// TCPStateCounts is the numbers of TCP sockets per state.
+// Connection requests which have not completed the handshake yet are
+// counted in SynRecv.
+type TCPStateCounts struct {
+	Established uint64
+	SynSent     uint64
+	SynRecv     uint64
+	FinWait1    uint64
+	FinWait2    uint64
+	TimeWait    uint64
+	Close       uint64
+	CloseWait   uint64
+	LastAck     uint64
+	Listen      uint64
+	Closing     uint64
+}
+
+// TCPConnStat is a statistics about TCP connections in /proc/net/tcp and
+// /proc/net/tcp6.
+type TCPConnStat struct {
+	TCPStateCounts
+	// Listeners is the statistics per listening port sorted by port.
+	// It is set only for a reader created with WithTCPListenerStats.
+	Listeners []TCPListenerStat
+}
+
+// TCPListenerStat is a statistics about listening sockets of a local port
+// and connections to the port.
+type TCPListenerStat struct {
+	Port uint16
+	// Sockets is the number of listening sockets of the port, which is
+	// more than one for the port listened on multiple addresses, both
+	// IPv4 and IPv6, or with SO_REUSEPORT.
+	Sockets int
+	// AcceptQueue is the number of established connections waiting to be
+	// accepted, summed up for the listening sockets.
+	AcceptQueue uint64
+	// TCPStateCounts is the numbers of sockets other than listening ones
+	// whose local port is Port, that is, connections to the port.
+	TCPStateCounts
+}
+
+// WithTCPListenerStats makes TCPConnStatReader report statistics per
+// listening port in Listeners of TCPConnStat. The default is false.
+func WithTCPListenerStats(enabled bool) Option {
+	return func(o *options) {
+		o.tcpListenerStats = enabled
+	}
+}
+
+// tcpReadBufSize is the size of the buffer used by TCPConnStatReader.
+// /proc/net/tcp is read in chunks since it can be tens of megabytes on
+// hosts with many connections. A line is 150 bytes for IPv4 and 178 bytes
+// for IPv6.
+const tcpReadBufSize = 64 * 1024
+
+// tcpStateListen is the state of listening sockets in /proc/net/tcp.
+const tcpStateListen = 0x0A
+
+// TCPConnStatReader is a reader for TCP connection counts.
+// It reads /proc/net/tcp and /proc/net/tcp6 in chunks with a fixed size
+// buffer, so the memory usage does not depend on the number of sockets.
+// TCPConnStatReader is not safe for concurrent accesses from multiple goroutines.
+type TCPConnStatReader struct {
+	buf      []byte
+	path     []byte
+	ipv6Path []byte
+	// portIndex maps a port to the index in Listeners plus one, or zero
+	// for ports which are not listened on. It is allocated only for
+	// WithTCPListenerStats.
+	portIndex []uint16
+	// listenPorts is the ports set in portIndex.
+	listenPorts []uint16
+}
+
+// NewTCPConnStatReader creates a TCPConnStatReader.
+func NewTCPConnStatReader(opts ...Option) *TCPConnStatReader {
+	o := newOptions(opts)
+	r := &TCPConnStatReader{
+		buf:      make([]byte, tcpReadBufSize),
+		path:     o.procPath("net", "tcp"),
+		ipv6Path: o.procPath("net", "tcp6"),
+	}
+	if o.tcpListenerStats {
+		r.portIndex = make([]uint16, 1<<16)
+	}
+	return r
+}
+
+// Read reads the TCP connection counts. Listeners of s is reused, so no
+// memory is allocated once it has grown enough. /proc/net/tcp6 is ignored
+// if it does not exist because IPv6 is disabled.
+//
+// Connections are counted for a listening port in Listeners if they are
+// listed after the listening socket, which is the case since the kernel
+// lists listening sockets first in each file.
+func (r *TCPConnStatReader) Read(s *TCPConnStat) error {
+	s.TCPStateCounts = TCPStateCounts{}
+	s.Listeners = s.Listeners[:0]
+	for _, port := range r.listenPorts {
+		r.portIndex[port] = 0
+	}
+	r.listenPorts = r.listenPorts[:0]
+
+	err := r.readFile(r.path, s)
+	if err != nil {
+		return err
+	}
+	err = r.readFile(r.ipv6Path, s)
+	if err != nil && err != syscall.ENOENT {
+		return err
+	}
+
+	sortTCPListeners(s.Listeners)
+	return nil
+}
+
+// readFile reads the file at path in chunks and parses complete lines.
+func (r *TCPConnStatReader) readFile(path []byte, s *TCPConnStat) error {
+	fd, err := open(path, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	header := true
+	n := 0
+	for {
+		m, err := syscall.Read(fd, r.buf[n:])
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		n += m
+		eof := m == 0
+
+		buf := r.buf[:n]
+		for {
+			i := bytes.IndexByte(buf, '\n')
+			if i == -1 {
+				break
+			}
+			line := buf[:i]
+			buf = buf[i+1:]
+			if header {
+				header = false
+				continue
+			}
+			err := r.parseLine(line, s)
+			if err != nil {
+				return err
+			}
+		}
+		if eof {
+			if len(buf) > 0 {
+				return ErrUnexpectedFormat
+			}
+			return nil
+		}
+		// Move the incomplete line to the beginning of the buffer.
+		n = copy(r.buf, buf)
+		if n == len(r.buf) {
+			return ErrUnexpectedFormat
+		}
+	}
+}
+
+// parseLine parses a line in /proc/net/tcp or /proc/net/tcp6 like below.
+//
+//	sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+//	 0: 0100007F:BC8F 00000000:0000 0A 00000000:00000000 00:00000000 00000000 65534        0 917 1 ...
+//
+// For listening sockets, rx_queue is the length of the accept queue and
+// tx_queue is always zero. The maximum backlog is not available in this file.
+func (r *TCPConnStatReader) parseLine(line []byte, s *TCPConnStat) error {
+	var fields [5][]byte
+	for i := range fields {
+		start, end := ascii.NextField(line)
+		if start == end {
+			return ErrUnexpectedFormat
+		}
+		fields[i] = line[start:end]
+		line = line[end:]
+	}
+	state, err := bytesconv.ParseUint(fields[3], 16, 8)
+	if err != nil {
+		return err
+	}
+	if c := s.TCPStateCounts.counter(byte(state)); c != nil {
+		*c++
+	}
+	if r.portIndex == nil {
+		return nil
+	}
+
+	i := bytes.LastIndexByte(fields[1], ':')
+	if i == -1 {
+		return ErrUnexpectedFormat
+	}
+	port, err := bytesconv.ParseUint(fields[1][i+1:], 16, 16)
+	if err != nil {
+		return err
+	}
+	if state == tcpStateListen {
+		return r.addListener(s, uint16(port), fields[4])
+	}
+	if j := r.portIndex[port]; j != 0 {
+		if c := s.Listeners[j-1].counter(byte(state)); c != nil {
+			*c++
+		}
+	}
+	return nil
+}
+
+// addListener adds a listening socket of port to s.Listeners. queues is
+// the tx_queue:rx_queue field.
+func (r *TCPConnStatReader) addListener(s *TCPConnStat, port uint16, queues []byte) error {
+	i := bytes.IndexByte(queues, ':')
+	if i == -1 {
+		return ErrUnexpectedFormat
+	}
+	acceptQueue, err := bytesconv.ParseUint(queues[i+1:], 16, 64)
+	if err != nil {
+		return err
+	}
+
+	j := r.portIndex[port]
+	if j == 0 {
+		// j does not overflow since port 0 is never listened on.
+		s.Listeners = append(s.Listeners, TCPListenerStat{Port: port})
+		j = uint16(len(s.Listeners))
+		r.portIndex[port] = j
+		r.listenPorts = append(r.listenPorts, port)
+	}
+	l := &s.Listeners[j-1]
+	l.Sockets++
+	l.AcceptQueue += acceptQueue
+	return nil
+}
+
+// counter returns the pointer to the count for the state in /proc/net/tcp,
+// or nil for an unknown state.
+// https://github.com/torvalds/linux/blob/master/include/net/tcp_states.h
+func (c *TCPStateCounts) counter(state byte) *uint64 {
+	switch state {
+	case 0x01:
+		return &c.Established
+	case 0x02:
+		return &c.SynSent
+	case 0x03, 0x0C:
+		// TCP_NEW_SYN_RECV is shown as TCP_SYN_RECV, but is handled
+		// just in case.
+		return &c.SynRecv
+	case 0x04:
+		return &c.FinWait1
+	case 0x05:
+		return &c.FinWait2
+	case 0x06:
+		return &c.TimeWait
+	case 0x07:
+		return &c.Close
+	case 0x08:
+		return &c.CloseWait
+	case 0x09:
+		return &c.LastAck
+	case tcpStateListen:
+		return &c.Listen
+	case 0x0B:
+		return &c.Closing
+	}
+	return nil
+}
+
+// sortTCPListeners sorts listeners by port with insertion sort, which does
+// not allocate memory unlike sort.Slice. The number of listening ports is
+// usually small.
+func sortTCPListeners(listeners []TCPListenerStat) {
+	for i := 1; i < len(listeners); i++ {
+		for j := i; j > 0 && listeners[j].Port < listeners[j-1].Port; j-- {
+			listeners[j], listeners[j-1] = listeners[j-1], listeners[j]
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package sysstat
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testTCPHeader = "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
+
+const testTCP6Header = "  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
+
+func testTCPLine(sl int, localPort uint16, state byte, txQueue, rxQueue uint64) string {
+	return fmt.Sprintf("%4d: 0100007F:%04X 0100007F:C350 %02X %08X:%08X 00:00000000 00000000  1000        0 %d 1 0000000000000000 100 0 0 10 0\n",
+		sl, localPort, state, txQueue, rxQueue, 10000+sl)
+}
+
+func testTCP6Line(sl int, localPort uint16, state byte, txQueue, rxQueue uint64) string {
+	return fmt.Sprintf("%4d: 00000000000000000000000000000000:%04X 00000000000000000000000000000000:0000 %02X %08X:%08X 00:00000000 00000000     0        0 %d 1 0000000000000000 100 0 0 10 0\n",
+		sl, localPort, state, txQueue, rxQueue, 20000+sl)
+}
+
+func TestTCPConnStatReader_Read(t *testing.T) {
+	var tcp strings.Builder
+	tcp.WriteString(testTCPHeader)
+	tcp.WriteString(testTCPLine(0, 80, 0x0A, 0, 3))
+	tcp.WriteString(testTCPLine(1, 22, 0x0A, 0, 0))
+	// Enough connections for the file to be read in multiple chunks.
+	const established = 1000
+	for i := 0; i < established; i++ {
+		tcp.WriteString(testTCPLine(2+i, 80, 0x01, 0, 0))
+	}
+	tcp.WriteString(testTCPLine(established+2, 80, 0x06, 0, 0))
+	tcp.WriteString(testTCPLine(established+3, 80, 0x08, 0, 0))
+	tcp.WriteString(testTCPLine(established+4, 22, 0x03, 0, 0))
+	// An outgoing connection from an ephemeral port.
+	tcp.WriteString(testTCPLine(established+5, 50000, 0x01, 0, 0))
+	if tcp.Len() <= tcpReadBufSize {
+		t.Fatalf("test data should be larger than buffer, len=%d", tcp.Len())
+	}
+	tcp6 := testTCP6Header +
+		testTCP6Line(0, 80, 0x0A, 0, 1) +
+		testTCP6Line(1, 443, 0x0A, 0, 0) +
+		testTCP6Line(2, 443, 0x01, 0, 0)
+
+	procRoot := t.TempDir()
+	writeFiles(t, filepath.Join(procRoot, "net"), map[string]string{"tcp": tcp.String(), "tcp6": tcp6})
+	r := NewTCPConnStatReader(WithProcRoot(procRoot), WithTCPListenerStats(true))
+	var s TCPConnStat
+	// Read twice to check the listeners of the previous read are cleared.
+	for i := 0; i < 2; i++ {
+		err := r.Read(&s)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wantCounts := TCPStateCounts{Established: established + 2, SynRecv: 1, TimeWait: 1, CloseWait: 1, Listen: 4}
+	if s.TCPStateCounts != wantCounts {
+		t.Errorf("state counts unmatch,\n got=%+v,\nwant=%+v", s.TCPStateCounts, wantCounts)
+	}
+	wantListeners := []TCPListenerStat{
+		{Port: 22, Sockets: 1, TCPStateCounts: TCPStateCounts{SynRecv: 1}},
+		{Port: 80, Sockets: 2, AcceptQueue: 4,
+			TCPStateCounts: TCPStateCounts{Established: established, TimeWait: 1, CloseWait: 1}},
+		{Port: 443, Sockets: 1, TCPStateCounts: TCPStateCounts{Established: 1}},
+	}
+	if len(s.Listeners) != len(wantListeners) {
+		t.Fatalf("listeners unmatch, got %+v, want %+v", s.Listeners, wantListeners)
+	}
+	for i, want := range wantListeners {
+		if s.Listeners[i] != want {
+			t.Errorf("listener %d unmatch,\n got=%+v,\nwant=%+v", i, s.Listeners[i], want)
+		}
+	}
+}
+
+func TestTCPConnStatReader_ReadWithoutIPv6(t *testing.T) {
+	procRoot := t.TempDir()
+	writeFiles(t, filepath.Join(procRoot, "net"), map[string]string{
+		"tcp": testTCPHeader + testTCPLine(0, 80, 0x0A, 0, 0) + testTCPLine(1, 80, 0x01, 0, 0),
+	})
+	r := NewTCPConnStatReader(WithProcRoot(procRoot))
+	var s TCPConnStat
+	err := r.Read(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Listen != 1 || s.Established != 1 || len(s.Listeners) != 0 {
+		t.Errorf("stat unmatch, got %+v", s)
+	}
+}
+
+func BenchmarkTCPConnStatReader_Read(b *testing.B) {
+	var s TCPConnStat
+	r := NewTCPConnStatReader(WithTCPListenerStats(true))
+	for i := 0; i < b.N; i++ {
+		err := r.Read(&s)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package sysstat
+
+import (
+	"os"
+	"sort"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/hnakamur/bytesconv"
+)
+
+// TopProcessKey is the key for ranking processes.
+type TopProcessKey int
+
+const (
+	// TopByCPU ranks processes by CPUPercent.
+	TopByCPU TopProcessKey = iota
+	// TopByRSS ranks processes by RSSBytes.
+	TopByRSS
+	// TopByIO ranks processes by the sum of ReadBytesPerSec and WriteBytesPerSec.
+	TopByIO
+)
+
+// TopProcess is a statistics about a process ranked by TopProcessReader.
+type TopProcess struct {
+	PID  int
+	Comm string
+	// CPUPercent is the percentage of CPU time relative to one CPU.
+	CPUPercent       float64
+	RSSBytes         uint64
+	ReadBytesPerSec  float64
+	WriteBytesPerSec float64
+}
+
+// DefaultMaxProcesses is the default maximum number of processes tracked
+// by TopProcessReader. It is the lower bound of /proc/sys/kernel/pid_max,
+// which is often much larger, for example, 4194304 set by systemd on 64-bit
+// systems, so pass a larger value to NewTopProcessReader for hosts running
+// more processes.
+const DefaultMaxProcesses = 32768
+
+// maxCommLen is the maximum length of the command name, which is
+// TASK_COMM_LEN minus one for the NUL terminator.
+const maxCommLen = 15
+
+// TopProcessReader scans all processes in /proc and ranks them.
+// The memory used by TopProcessReader is bounded by the maximum number of
+// processes passed to NewTopProcessReader.
+// TopProcessReader is not safe for concurrent accesses from multiple goroutines.
+type TopProcessReader struct {
+	buf       []byte
+	direntBuf []byte
+	pathBuf   []byte
+	procRoot  []byte
+	curr      int
+	samples   [2][]processSample
+	rank      []rankedProcess
+	prevTime  time.Time
+}
+
+// processSample is a sample of a process. It has a fixed size array for
+// the command name, so samples for many processes can be kept without
+// allocating strings.
+type processSample struct {
+	pid        int
+	startTime  uint64
+	cpuTime    uint64
+	rss        uint64
+	readBytes  uint64
+	writeBytes uint64
+	commLen    int
+	comm       [maxCommLen]byte
+}
+
+type rankedProcess struct {
+	curr  int // index in the current samples
+	prev  int // index in the previous samples or -1
+	score float64
+}
+
+// NewTopProcessReader creates a TopProcessReader and does an initial scan.
+// maxProcs is the maximum number of processes tracked. If it is zero or
+// negative, DefaultMaxProcesses is used. When there are more processes than
+// maxProcs, processes listed later in /proc, that is, ones with larger pids,
+// are ignored and Read returns ErrTooManyProcesses.
+func NewTopProcessReader(maxProcs int, opts ...Option) (*TopProcessReader, error) {
+	if maxProcs <= 0 {
+		maxProcs = DefaultMaxProcesses
+	}
+	o := newOptions(opts)
+	procRoot := o.procPath()
+	r := &TopProcessReader{
+		direntBuf: make([]byte, 32*1024),
+		procRoot:  procRoot[:len(procRoot)-1],
+	}
+	r.samples[0] = make([]processSample, 0, maxProcs)
+	r.samples[1] = make([]processSample, 0, maxProcs)
+	err := r.scan()
+	if err != nil && err != ErrTooManyProcesses {
+		return nil, err
+	}
+	r.prevTime = time.Now()
+	r.switchCurr()
+	return r, nil
+}
+
+// Read scans all processes and fills top with the top len(top) processes
+// ranked by key in descending order. It returns the number of filled
+// elements, which is less than len(top) when there are fewer processes.
+// Processes which started after the previous Read have zero rates.
+// Comm of an element in top is reused when it is unchanged, so passing
+// the same top every time avoids allocating strings.
+// If there are more processes than the maximum, top is filled with the
+// tracked ones and ErrTooManyProcesses is returned.
+func (r *TopProcessReader) Read(top []TopProcess, key TopProcessKey) (int, error) {
+	err := r.scan()
+	if err != nil && err != ErrTooManyProcesses {
+		return 0, err
+	}
+	now := time.Now()
+	intervalSeconds := float64(now.Sub(r.prevTime)) / float64(time.Second)
+	n := r.rankProcesses(len(top), key, intervalSeconds)
+	for i := 0; i < n; i++ {
+		r.fillTopProcess(&top[i], &r.rank[i], intervalSeconds)
+	}
+	r.prevTime = now
+	r.switchCurr()
+	return n, err
+}
+
+func (r *TopProcessReader) switchCurr() {
+	r.curr = 1 - r.curr
+}
+
+// scan reads all processes into the current samples sorted by pid.
+// It returns ErrTooManyProcesses after reading the samples if processes
+// are ignored since the samples are full.
+func (r *TopProcessReader) scan() error {
+	r.pathBuf = append(append(r.pathBuf[:0], r.procRoot...), 0)
+	fd, err := open(r.pathBuf, os.O_RDONLY|syscall.O_DIRECTORY, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	samples := r.samples[r.curr][:0]
+	sorted := true
+	truncated := false
+	for {
+		n, err := syscall.Getdents(fd, r.direntBuf)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		buf := r.direntBuf[:n]
+		for len(buf) > 0 {
+			name, reclen := parseDirent(buf)
+			buf = buf[reclen:]
+			if len(name) == 0 || name[0] < '0' || name[0] > '9' {
+				continue
+			}
+			pid, err := bytesconv.ParseUint(name, 10, 32)
+			if err != nil {
+				continue
+			}
+			if len(samples) == cap(samples) {
+				truncated = true
+				continue
+			}
+			samples = samples[:len(samples)+1]
+			s := &samples[len(samples)-1]
+			ok, err := r.readProcessSample(s, name)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				samples = samples[:len(samples)-1]
+				continue
+			}
+			s.pid = int(pid)
+			if len(samples) > 1 && samples[len(samples)-2].pid > s.pid {
+				sorted = false
+			}
+		}
+	}
+	if !sorted {
+		// procfs lists processes in pid order, so this is not expected.
+		sort.Slice(samples, func(i, j int) bool { return samples[i].pid < samples[j].pid })
+	}
+	r.samples[r.curr] = samples
+	if truncated {
+		return ErrTooManyProcesses
+	}
+	return nil
+}
+
+// parseDirent parses a linux_dirent64 at the head of buf and returns
+// the name and the record length.
+func parseDirent(buf []byte) (name []byte, reclen int) {
+	const (
+		reclenOffset = 16
+		nameOffset   = 19
+	)
+	reclen = int(*(*uint16)(unsafe.Pointer(&buf[reclenOffset])))
+	name = buf[nameOffset:reclen]
+	for i, c := range name {
+		if c == 0 {
+			name = name[:i]
+			break
+		}
+	}
+	return name, reclen
+}
+
+// readProcessSample reads /proc/[pid]/stat and /proc/[pid]/io into s.
+// It returns false without an error when the process has exited.
+func (r *TopProcessReader) readProcessSample(s *processSample, pidName []byte) (ok bool, err error) {
+	var raw rawProcessStat
+	b, err := readFile(r.processPath(pidName, "stat"), &r.buf)
+	if err != nil {
+		return false, ignoreProcessGone(err)
+	}
+	comm, err := parseProcessStat(b, &raw)
+	if err != nil {
+		return false, err
+	}
+	s.commLen = copy(s.comm[:], comm)
+	s.startTime = raw.StartTime
+	s.cpuTime = raw.UTime + raw.STime
+	s.rss = raw.RSS * pageSize
+
+	b, err = readFile(r.processPath(pidName, "io"), &r.buf)
+	if err != nil {
+		s.readBytes, s.writeBytes = 0, 0
+		if err == syscall.EACCES || err == syscall.EPERM {
+			return true, nil
+		}
+		return false, ignoreProcessGone(err)
+	}
+	err = parseProcessIO(b, &raw)
+	if err != nil {
+		return false, err
+	}
+	s.readBytes = raw.ReadBytes
+	s.writeBytes = raw.WriteBytes
+	return true, nil
+}
+
+// processPath returns the NUL-terminated path of the file of the process.
+// The returned slice is valid until the next call.
+func (r *TopProcessReader) processPath(pidName []byte, name string) []byte {
+	b := append(r.pathBuf[:0], r.procRoot...)
+	b = append(b, '/')
+	b = append(b, pidName...)
+	b = append(b, '/')
+	b = append(b, name...)
+	b = append(b, 0)
+	r.pathBuf = b
+	return b
+}
+
+// rankProcesses ranks the current samples by key and keeps the top n
+// in r.rank. It returns the number of ranked processes.
+func (r *TopProcessReader) rankProcesses(n int, key TopProcessKey, intervalSeconds float64) int {
+	curr := r.samples[r.curr]
+	prev := r.samples[1-r.curr]
+	if cap(r.rank) < n {
+		r.rank = make([]rankedProcess, 0, n)
+	}
+	rank := r.rank[:0]
+	j := 0
+	for i := range curr {
+		c := &curr[i]
+		// Both samples are sorted by pid, so the previous sample of
+		// the same process is found by walking them together.
+		for j < len(prev) && prev[j].pid < c.pid {
+			j++
+		}
+		p := -1
+		if j < len(prev) && prev[j].pid == c.pid && prev[j].startTime == c.startTime {
+			p = j
+		}
+		e := rankedProcess{curr: i, prev: p, score: r.score(c, p, key, intervalSeconds)}
+		if len(rank) == n {
+			if n == 0 || e.score <= rank[n-1].score {
+				continue
+			}
+			rank = rank[:n-1]
+		}
+		k := len(rank)
+		rank = rank[:k+1]
+		for ; k > 0 && rank[k-1].score < e.score; k-- {
+			rank[k] = rank[k-1]
+		}
+		rank[k] = e
+	}
+	r.rank = rank
+	return len(rank)
+}
+
+func (r *TopProcessReader) score(c *processSample, prevIndex int, key TopProcessKey, intervalSeconds float64) float64 {
+	switch key {
+	case TopByRSS:
+		return float64(c.rss)
+	case TopByIO:
+		if prevIndex == -1 {
+			return 0
+		}
+		p := &r.samples[1-r.curr][prevIndex]
+		return counterRate(p.readBytes, c.readBytes, intervalSeconds) +
+			counterRate(p.writeBytes, c.writeBytes, intervalSeconds)
+	default:
+		if prevIndex == -1 {
+			return 0
+		}
+		p := &r.samples[1-r.curr][prevIndex]
+		return llSpValue(p.cpuTime, c.cpuTime, intervalSeconds, 1)
+	}
+}
+
+func (r *TopProcessReader) fillTopProcess(t *TopProcess, e *rankedProcess, intervalSeconds float64) {
+	c := &r.samples[r.curr][e.curr]
+	t.PID = c.pid
+	if comm := c.comm[:c.commLen]; string(comm) != t.Comm {
+		t.Comm = string(comm)
+	}
+	t.RSSBytes = c.rss
+	if e.prev == -1 {
+		t.CPUPercent, t.ReadBytesPerSec, t.WriteBytesPerSec = 0, 0, 0
+		return
+	}
+	p := &r.samples[1-r.curr][e.prev]
+	t.CPUPercent = llSpValue(p.cpuTime, c.cpuTime, intervalSeconds, 1)
+	t.ReadBytesPerSec = counterRate(p.readBytes, c.readBytes, intervalSeconds)
+	t.WriteBytesPerSec = counterRate(p.writeBytes, c.writeBytes, intervalSeconds)
+}
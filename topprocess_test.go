@@ -0,0 +1,135 @@
+package sysstat
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestTopProcessReader(t *testing.T) {
+	procRoot := t.TempDir()
+	writeProcessFiles := func(pid int, comm string, utime, rss, writeBytes int) {
+		dir := filepath.Join(procRoot, strconv.Itoa(pid))
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stat := strconv.Itoa(pid) + " (" + comm + ") S 0 1 1 0 -1 4194560 100 0 0 0 " + strconv.Itoa(utime) +
+			" 0 0 0 20 0 1 0 10 4096 " + strconv.Itoa(rss) + " 0\n"
+		err = os.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io := "read_bytes: 0\nwrite_bytes: " + strconv.Itoa(writeBytes) + "\n"
+		err = os.WriteFile(filepath.Join(dir, "io"), []byte(io), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeProcessFiles(1, "init", 100, 10, 0)
+	writeProcessFiles(20, "busy", 100, 20, 0)
+	writeProcessFiles(300, "writer", 100, 30, 0)
+
+	r, err := NewTopProcessReader(0, WithProcRoot(procRoot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeProcessFiles(20, "busy", 200, 20, 0)
+	writeProcessFiles(300, "writer", 150, 30, 1<<20)
+	// pid 4000 started after the previous read has zero rates.
+	writeProcessFiles(4000, "new", 1000, 1000, 1<<30)
+
+	top := make([]TopProcess, 2)
+	n, err := r.Read(top, TopByCPU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || top[0].PID != 20 || top[0].Comm != "busy" || top[1].PID != 300 || top[1].Comm != "writer" {
+		t.Errorf("top by CPU unmatch, got %+v", top[:n])
+	}
+	if top[0].CPUPercent <= top[1].CPUPercent {
+		t.Errorf("CPUPercent must be in descending order, got %+v", top[:n])
+	}
+
+	n, err = r.Read(top, TopByRSS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || top[0].PID != 4000 || top[0].RSSBytes != 1000*pageSize || top[1].PID != 300 {
+		t.Errorf("top by RSS unmatch, got %+v", top[:n])
+	}
+
+	top = make([]TopProcess, 5)
+	n, err = r.Read(top, TopByIO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Errorf("number of processes unmatch, got %d, want %d", n, 4)
+	}
+}
+
+func TestTopProcessReader_TooManyProcesses(t *testing.T) {
+	procRoot := t.TempDir()
+	for _, pid := range []int{1, 20, 300} {
+		dir := filepath.Join(procRoot, strconv.Itoa(pid))
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stat := strconv.Itoa(pid) + " (sh) S 0 1 1 0 -1 4194560 100 0 0 0 100 0 0 0 20 0 1 0 10 4096 10 0\n"
+		err = os.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(dir, "io"), []byte("read_bytes: 0\nwrite_bytes: 0\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := NewTopProcessReader(2, WithProcRoot(procRoot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	top := make([]TopProcess, 3)
+	n, err := r.Read(top, TopByRSS)
+	if err != ErrTooManyProcesses {
+		t.Errorf("error unmatch, got %v, want %v", err, ErrTooManyProcesses)
+	}
+	if n != 2 {
+		t.Errorf("number of processes unmatch, got %d, want %d", n, 2)
+	}
+}
+
+func TestParseDirent(t *testing.T) {
+	buf := make([]byte, 48)
+	buf[16] = 24 // d_reclen
+	copy(buf[19:], "1234\x00")
+	buf[24+16] = 24
+	copy(buf[24+19:], "self\x00")
+	name, reclen := parseDirent(buf)
+	if string(name) != "1234" || reclen != 24 {
+		t.Errorf("dirent unmatch, got name=%q, reclen=%d", name, reclen)
+	}
+	name, _ = parseDirent(buf[reclen:])
+	if string(name) != "self" {
+		t.Errorf("dirent name unmatch, got %q, want %q", name, "self")
+	}
+}
+
+func BenchmarkTopProcessReader_Read(b *testing.B) {
+	r, err := NewTopProcessReader(0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	top := make([]TopProcess, 10)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err = r.Read(top, TopByCPU)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -13,17 +13,19 @@ type Uptime struct {
 // UptimeReader is used for reading uptime.
 // UptimeReader is not safe for concurrent accesses.
 type UptimeReader struct {
-	buf [80]byte
+	buf  [80]byte
+	path []byte
 }
 
 // NewUptimeReader creates a UptimeReader
-func NewUptimeReader() *UptimeReader {
-	return new(UptimeReader)
+func NewUptimeReader(opts ...Option) *UptimeReader {
+	o := newOptions(opts)
+	return &UptimeReader{path: o.procPath("uptime")}
 }
 
 // Read reads the uptime
 func (r *UptimeReader) Read(u *Uptime) error {
-	fd, err := open([]byte("/proc/uptime"), os.O_RDONLY, 0)
+	fd, err := open(r.path, os.O_RDONLY, 0)
 	if err != nil {
 		return err
 	}
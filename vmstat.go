@@ -0,0 +1,218 @@
+package sysstat
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/hnakamur/ascii"
+	"github.com/hnakamur/bytesconv"
+)
+
+// VMStat is a statistics about paging and swapping.
+// The values are the same as ones reported by sar -B and sar -W.
+type VMStat struct {
+	// PageInKBPerSec is kilobytes paged in from disk per second (pgpgin/s).
+	PageInKBPerSec float64
+	// PageOutKBPerSec is kilobytes paged out to disk per second (pgpgout/s).
+	PageOutKBPerSec float64
+	// FaultsPerSec is page faults, both minor and major, per second (fault/s).
+	FaultsPerSec float64
+	// MajorFaultsPerSec is major page faults per second (majflt/s).
+	MajorFaultsPerSec float64
+	// FreedPagesPerSec is pages placed on the free list per second (pgfree/s).
+	FreedPagesPerSec float64
+	// ScanKswapdPagesPerSec is pages scanned by kswapd per second (pgscank/s).
+	ScanKswapdPagesPerSec float64
+	// ScanDirectPagesPerSec is pages scanned directly per second (pgscand/s).
+	ScanDirectPagesPerSec float64
+	// StealKswapdPagesPerSec is pages reclaimed by kswapd per second.
+	StealKswapdPagesPerSec float64
+	// StealDirectPagesPerSec is pages reclaimed directly per second.
+	StealDirectPagesPerSec float64
+	// VMEffPercent is reclaimed pages over scanned pages in percent (%vmeff).
+	// It is zero when no pages are scanned.
+	VMEffPercent float64
+	// SwapInPagesPerSec is pages swapped in per second (pswpin/s).
+	SwapInPagesPerSec float64
+	// SwapOutPagesPerSec is pages swapped out per second (pswpout/s).
+	SwapOutPagesPerSec float64
+	// OOMKillsPerSec is processes killed by the OOM killer per second.
+	// It is available on Linux 4.13 or later.
+	OOMKillsPerSec float64
+}
+
+// RawVMStat represents cumulative counters in /proc/vmstat.
+// Counters per memory zone on older kernels like pgscan_kswapd_normal
+// are summed up.
+// https://github.com/torvalds/linux/blob/master/include/linux/vm_event_item.h
+type RawVMStat struct {
+	PgPgIn        uint64
+	PgPgOut       uint64
+	PSwpIn        uint64
+	PSwpOut       uint64
+	PgFault       uint64
+	PgMajFault    uint64
+	PgFree        uint64
+	PgScanKswapd  uint64
+	PgScanDirect  uint64
+	PgStealKswapd uint64
+	PgStealDirect uint64
+	OOMKill       uint64
+}
+
+// VMStatReader reads the paging and swapping statistics.
+// VMStatReader is not safe for concurrent accesses from multiple goroutines.
+type VMStatReader struct {
+	buf      []byte
+	curr     int
+	stats    [2]RawVMStat
+	prevTime time.Time
+	path     []byte
+}
+
+// NewVMStatReader creates a VMStatReader and does an initial read.
+func NewVMStatReader(opts ...Option) (*VMStatReader, error) {
+	o := newOptions(opts)
+	r := &VMStatReader{path: o.procPath("vmstat")}
+	err := r.readVMStat(nil)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Read reads the paging and swapping statistics.
+func (r *VMStatReader) Read(s *VMStat) error {
+	return r.readVMStat(s)
+}
+
+// ReadRaw reads cumulative counters.
+// The read is also used as the previous sample for the next Read.
+func (r *VMStatReader) ReadRaw(s *RawVMStat) error {
+	buf, err := readFile(r.path, &r.buf)
+	if err != nil {
+		return err
+	}
+	err = r.parse(buf, &r.stats[r.curr])
+	if err != nil {
+		return err
+	}
+	*s = r.stats[r.curr]
+	r.prevTime = time.Now()
+	r.switchCurr()
+	return nil
+}
+
+func (r *VMStatReader) readVMStat(s *VMStat) error {
+	buf, err := readFile(r.path, &r.buf)
+	if err != nil {
+		return err
+	}
+	err = r.parse(buf, &r.stats[r.curr])
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if s != nil {
+		intervalSeconds := float64(now.Sub(r.prevTime)) / float64(time.Second)
+		calcVMStat(s, &r.stats[r.curr], &r.stats[1-r.curr], intervalSeconds)
+	}
+	r.prevTime = now
+	r.switchCurr()
+	return nil
+}
+
+func (r *VMStatReader) switchCurr() {
+	r.curr = 1 - r.curr
+}
+
+func (r *VMStatReader) parse(buf []byte, s *RawVMStat) error {
+	*s = RawVMStat{}
+	for len(buf) > 0 {
+		line := ascii.GetLine(buf)
+		buf = buf[len(line):]
+		start, end := ascii.NextField(line)
+		name := line[start:end]
+		ptr := s.counterByName(name)
+		if ptr == nil {
+			continue
+		}
+		line = line[end:]
+		start, end = ascii.NextField(line)
+		val, err := bytesconv.ParseUint(line[start:end], 10, 64)
+		if err != nil {
+			return err
+		}
+		*ptr += val
+	}
+	return nil
+}
+
+// counterByName returns the pointer to the counter for the name in
+// /proc/vmstat, or nil for the counters not interested in.
+func (s *RawVMStat) counterByName(name []byte) *uint64 {
+	switch string(name) {
+	case "pgpgin":
+		return &s.PgPgIn
+	case "pgpgout":
+		return &s.PgPgOut
+	case "pswpin":
+		return &s.PSwpIn
+	case "pswpout":
+		return &s.PSwpOut
+	case "pgfault":
+		return &s.PgFault
+	case "pgmajfault":
+		return &s.PgMajFault
+	case "pgfree":
+		return &s.PgFree
+	case "oom_kill":
+		return &s.OOMKill
+	case "pgscan_direct_throttle":
+		// Not a number of scanned pages. See read_vmstat_paging in rd_stats.c of sysstat.
+		return nil
+	}
+
+	// Kernels older than 4.8 have counters per memory zone like
+	// pgscan_kswapd_normal, and newer ones have pgscan_kswapd.
+	switch {
+	case bytes.HasPrefix(name, []byte("pgscan_kswapd")):
+		return &s.PgScanKswapd
+	case bytes.HasPrefix(name, []byte("pgscan_direct")):
+		return &s.PgScanDirect
+	case bytes.HasPrefix(name, []byte("pgsteal_kswapd")):
+		return &s.PgStealKswapd
+	case bytes.HasPrefix(name, []byte("pgsteal_direct")):
+		return &s.PgStealDirect
+	}
+	return nil
+}
+
+// CalcVMStat calculates the paging and swapping statistics between two
+// snapshots prev and curr read elapsed apart, and stores them into s.
+func CalcVMStat(s *VMStat, prev, curr *RawVMStat, elapsed time.Duration) {
+	calcVMStat(s, curr, prev, elapsed.Seconds())
+}
+
+func calcVMStat(s *VMStat, c, p *RawVMStat, intervalSeconds float64) {
+	s.PageInKBPerSec = counterRate(p.PgPgIn, c.PgPgIn, intervalSeconds)
+	s.PageOutKBPerSec = counterRate(p.PgPgOut, c.PgPgOut, intervalSeconds)
+	s.FaultsPerSec = counterRate(p.PgFault, c.PgFault, intervalSeconds)
+	s.MajorFaultsPerSec = counterRate(p.PgMajFault, c.PgMajFault, intervalSeconds)
+	s.FreedPagesPerSec = counterRate(p.PgFree, c.PgFree, intervalSeconds)
+	s.ScanKswapdPagesPerSec = counterRate(p.PgScanKswapd, c.PgScanKswapd, intervalSeconds)
+	s.ScanDirectPagesPerSec = counterRate(p.PgScanDirect, c.PgScanDirect, intervalSeconds)
+	s.StealKswapdPagesPerSec = counterRate(p.PgStealKswapd, c.PgStealKswapd, intervalSeconds)
+	s.StealDirectPagesPerSec = counterRate(p.PgStealDirect, c.PgStealDirect, intervalSeconds)
+	s.SwapInPagesPerSec = counterRate(p.PSwpIn, c.PSwpIn, intervalSeconds)
+	s.SwapOutPagesPerSec = counterRate(p.PSwpOut, c.PSwpOut, intervalSeconds)
+	s.OOMKillsPerSec = counterRate(p.OOMKill, c.OOMKill, intervalSeconds)
+
+	scanned := s.ScanKswapdPagesPerSec + s.ScanDirectPagesPerSec
+	if scanned > 0 {
+		s.VMEffPercent = (s.StealKswapdPagesPerSec + s.StealDirectPagesPerSec) / scanned * 100
+	} else {
+		s.VMEffPercent = 0
+	}
+}
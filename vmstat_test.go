@@ -0,0 +1,129 @@
+package sysstat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVMStatReader_parse(t *testing.T) {
+	buf := []byte(`nr_free_pages 1063472
+nr_zone_inactive_anon 11208
+pgpgin 2360512
+pgpgout 9386300
+pswpin 12
+pswpout 34
+pgalloc_dma 0
+pgfree 225880374
+pgfault 233706123
+pgmajfault 9081
+pgsteal_kswapd 311298
+pgsteal_direct 2001
+pgscan_kswapd 332087
+pgscan_direct 2150
+pgscan_direct_throttle 7
+oom_kill 1
+`)
+	var s RawVMStat
+	r := new(VMStatReader)
+	err := r.parse(buf, &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name string
+		ptr  *uint64
+		want uint64
+	}{
+		{"PgPgIn", &s.PgPgIn, 2360512},
+		{"PgPgOut", &s.PgPgOut, 9386300},
+		{"PSwpIn", &s.PSwpIn, 12},
+		{"PSwpOut", &s.PSwpOut, 34},
+		{"PgFault", &s.PgFault, 233706123},
+		{"PgMajFault", &s.PgMajFault, 9081},
+		{"PgFree", &s.PgFree, 225880374},
+		{"PgScanKswapd", &s.PgScanKswapd, 332087},
+		{"PgScanDirect", &s.PgScanDirect, 2150},
+		{"PgStealKswapd", &s.PgStealKswapd, 311298},
+		{"PgStealDirect", &s.PgStealDirect, 2001},
+		{"OOMKill", &s.OOMKill, 1},
+	}
+	for _, c := range testCases {
+		if *c.ptr != c.want {
+			t.Errorf("%s unmatch, got %d, want %d", c.name, *c.ptr, c.want)
+		}
+	}
+}
+
+func TestVMStatReader_parsePerZone(t *testing.T) {
+	buf := []byte(`pgsteal_kswapd_dma 0
+pgsteal_kswapd_dma32 1000
+pgsteal_kswapd_normal 2000
+pgsteal_direct_normal 30
+pgscan_kswapd_dma32 1500
+pgscan_kswapd_normal 2500
+pgscan_direct_dma32 10
+pgscan_direct_normal 40
+pgscan_direct_throttle 7
+`)
+	var s RawVMStat
+	r := new(VMStatReader)
+	err := r.parse(buf, &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.PgScanKswapd != 4000 || s.PgScanDirect != 50 || s.PgStealKswapd != 3000 || s.PgStealDirect != 30 {
+		t.Errorf("stat unmatch, got %+v", s)
+	}
+}
+
+func TestVMStatReader_parseExtraSpaces(t *testing.T) {
+	buf := []byte("pgpgin  2360512\n  pgpgout\t9386300\n")
+	var s RawVMStat
+	r := new(VMStatReader)
+	err := r.parse(buf, &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.PgPgIn != 2360512 || s.PgPgOut != 9386300 {
+		t.Errorf("stat unmatch, got %+v", s)
+	}
+}
+
+func TestCalcVMStat(t *testing.T) {
+	prev := RawVMStat{PgPgIn: 1000, PgFault: 5000, PgScanKswapd: 100, PgScanDirect: 100, PgStealKswapd: 50, PgStealDirect: 50}
+	curr := RawVMStat{PgPgIn: 3000, PgFault: 7000, PgScanKswapd: 400, PgScanDirect: 200, PgStealKswapd: 350, PgStealDirect: 50, OOMKill: 2}
+	var s VMStat
+	CalcVMStat(&s, &prev, &curr, 2*time.Second)
+	testCases := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"PageInKBPerSec", s.PageInKBPerSec, 1000},
+		{"FaultsPerSec", s.FaultsPerSec, 1000},
+		{"ScanKswapdPagesPerSec", s.ScanKswapdPagesPerSec, 150},
+		{"ScanDirectPagesPerSec", s.ScanDirectPagesPerSec, 50},
+		{"StealKswapdPagesPerSec", s.StealKswapdPagesPerSec, 150},
+		{"VMEffPercent", s.VMEffPercent, 75},
+		{"OOMKillsPerSec", s.OOMKillsPerSec, 1},
+	}
+	for _, c := range testCases {
+		if c.got != c.want {
+			t.Errorf("%s unmatch, got %g, want %g", c.name, c.got, c.want)
+		}
+	}
+}
+
+func BenchmarkVMStatReader_Read(b *testing.B) {
+	var s VMStat
+	r, err := NewVMStatReader()
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < b.N; i++ {
+		err = r.Read(&s)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}